@@ -0,0 +1,191 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// adminGuard пропускає лише запити з заголовком X-Admin-Token, що збігається
+// з ADMIN_TOKEN. Без ADMIN_TOKEN адмінські ендпоінти вимкнені
+func (a *API) adminGuard(c *fiber.Ctx) error {
+	token := c.Get("X-Admin-Token")
+	if a.config.AdminToken == "" || token == "" ||
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.config.AdminToken)) != 1 {
+		log.Warn().Str("path", c.Path()).Str("ip", c.IP()).Msg("невалідний адмінський токен")
+		return fiber.NewError(fiber.StatusForbidden, "admin token required")
+	}
+	return c.Next()
+}
+
+// handleGetFileAudit віддає файл будь-якого ключа разом з User-Agent і IP
+// клієнта, який його завантажив
+func (a *API) handleGetFileAudit(c *fiber.Ctx) error {
+	fileID, err := c.ParamsInt("fileID")
+	if err != nil || fileID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid file id")
+	}
+
+	file, err := a.requestDB(c).GetFileByID(uint(fileID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		log.Err(err).Int("fileID", fileID).Msg("помилка отримання фалу з бази")
+		return dbError(err, "failed to get file")
+	}
+
+	return c.JSON(FileAudit{
+		ID:          file.ID,
+		FileName:    file.FileName,
+		Status:      file.Status,
+		OwnerAPIKey: file.OwnerAPIKey,
+		CreatedAt:   file.CreatedAt,
+		UserAgent:   file.UploadUserAgent,
+		IP:          file.UploadIP,
+	})
+}
+
+// handleTransferFile передає файл від одного ключа іншому (наприклад, при міграції акаунта)
+func (a *API) handleTransferFile(c *fiber.Ctx) error {
+	fileID, err := c.ParamsInt("fileID")
+	if err != nil || fileID <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid file id")
+	}
+
+	var req RequestTransferFile
+	if err := c.BodyParser(&req); err != nil || req.To == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "to key is required")
+	}
+
+	err = a.db.TransferFile(uint(fileID), req.From, req.To)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return fiber.NewError(fiber.StatusNotFound, "file not found")
+	case errors.Is(err, db.ErrKeyNotFound):
+		return fiber.NewError(fiber.StatusBadRequest, "unknown api key")
+	case errors.Is(err, db.ErrNotOwner):
+		return fiber.NewError(fiber.StatusConflict, "file is not owned by the from key")
+	case err != nil:
+		log.Err(err).Int("fileID", fileID).Msg("помилка передачі файлу")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to transfer file")
+	}
+
+	if req.From != "" {
+		a.updateKeyUsage(db.HashKey(req.From))
+	}
+	a.updateKeyUsage(db.HashKey(req.To))
+	log.Info().Int("fileID", fileID).Msg("файл передано іншому ключу")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleRevokeKey відкликає ключ за його hash (sha256 в hex) і залежно від
+// KEY_DELETION_POLICY видаляє його файли або зберігає їх для передачі
+func (a *API) handleRevokeKey(c *fiber.Ctx) error {
+	hash := strings.ToLower(c.Params("hash"))
+	if _, err := hex.DecodeString(hash); err != nil || len(hash) != sha256.Size*2 {
+		return fiber.NewError(fiber.StatusBadRequest, "key hash must be a hex sha256")
+	}
+	return a.revokeKey(c, hash)
+}
+
+// revokeKey відкликає ключ за hash і обробляє його файли за KEY_DELETION_POLICY
+func (a *API) revokeKey(c *fiber.Ctx, hash string) error {
+	cascade := a.config.KeyDeletionPolicy == config.KeyDeletionCascade
+	files, err := a.requestDB(c).RevokeAPIKey(hash, cascade)
+	if errors.Is(err, db.ErrKeyNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "key not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("помилка відкликання ключа")
+		return dbError(err, "failed to revoke key")
+	}
+
+	policy := config.KeyDeletionRetain
+	if cascade {
+		policy = config.KeyDeletionCascade
+	}
+	a.updateKeyUsage(hash)
+	log.Info().Str("policy", policy).Int64("files", files).Msg("ключ відкликано")
+	return c.JSON(KeyRevoked{Policy: policy, Files: files})
+}
+
+// handleGetConfig віддає налаштування, з якими працює сервер, без секретів
+func (a *API) handleGetConfig(c *fiber.Ctx) error {
+	cfg := a.config
+	return c.JSON(EffectiveConfig{
+		ChunkSize:           a.chunkSize,
+		StorageBackend:      cfg.StorageBackend,
+		StorageDir:          cfg.StorageDir,
+		UploadWorkers:       cfg.UploadWorkers,
+		RecoverPanics:       cfg.RecoverPanics,
+		FairQueue:           cfg.FairQueue,
+		SharedQueue:         cfg.SharedQueue,
+		InstanceID:          cfg.InstanceID,
+		StorageConcurrency:  cfg.StorageConcurrency,
+		TelegramRate:        cfg.TelegramRate,
+		TelegramBurst:       cfg.TelegramBurst,
+		MaxConcurrentParts:  cfg.MaxConcurrentParts,
+		MaxPartSize:         cfg.MaxPartSize,
+		ChunkCacheBytes:     cfg.ChunkCacheBytes,
+		ExportConcurrency:   cfg.ExportConcurrency,
+		DownloadConcurrency: cfg.DownloadConcurrency,
+
+		MaxUploadSize:       cfg.MaxUploadSize,
+		UploadMinRate:       cfg.UploadMinRate,
+		MinFreeDisk:         cfg.MinFreeDisk,
+		AllowedContentTypes: cfg.AllowedContentTypes,
+		SniffContentType:    cfg.SniffContentType,
+		FilenameHeaderLimit: cfg.FilenameHeaderLimit,
+		DuplicatePolicy:     cfg.DuplicatePolicy,
+		KeyDeletionPolicy:   cfg.KeyDeletionPolicy,
+		AbortedUploadPolicy: cfg.AbortedUploadPolicy,
+		TransformMaxSize:    cfg.TransformMaxSize,
+
+		ChecksumAlgorithm: checksum.Normalize(cfg.ChecksumAlgorithm),
+		ChunkCaptions:     cfg.ChunkCaptions,
+		Parity:            cfg.Parity,
+		VerifyChunkOrder:  cfg.VerifyChunkOrder,
+		DedupChunks:       cfg.DedupChunks,
+		CompressChunks:    cfg.CompressChunks,
+		StreamUploads:     cfg.StreamUploads,
+
+		MaxRetries:       cfg.MaxRetries,
+		RetryQueue:       cfg.RetryQueue,
+		RetryMaxAttempts: cfg.RetryMaxAttempts,
+
+		AllowPublicKeyCreation: cfg.AllowPublicKeyCreation,
+		RejectWhenStorageDown:  cfg.RejectWhenStorageDown,
+		ReadOnly:               cfg.ReadOnly,
+		AdminTokenSet:          cfg.AdminToken != "",
+		ResumeSecretSet:        cfg.ResumeSecret != "",
+		StorageKeySet:          len(cfg.StorageKey) > 0,
+		Pprof:                  cfg.Pprof,
+		DebugBodies:            cfg.DebugBodies,
+		DirectURLs:             cfg.DirectURLs,
+		KeyMetrics:             cfg.KeyMetrics,
+		KeyMetricsLimit:        cfg.KeyMetricsLimit,
+
+		SweepInterval:        cfg.SweepInterval.String(),
+		StaleUploadsInterval: cfg.StaleUploadsInterval.String(),
+		StaleUploadAfter:     cfg.StaleUploadAfter.String(),
+		SlowUploadAfter:      cfg.SlowUploadAfter.String(),
+		RetryDelay:           cfg.RetryDelay.String(),
+		RetryInterval:        cfg.RetryInterval.String(),
+		PurgeInterval:        cfg.PurgeInterval.String(),
+		PurgeDeletedAfter:    cfg.PurgeDeletedAfter.String(),
+		DBQueryTimeout:       cfg.DBQueryTimeout.String(),
+		ShutdownTimeout:      cfg.ShutdownTimeout.String(),
+		StorageCheckTTL:      cfg.StorageCheckTTL.String(),
+	})
+}
@@ -0,0 +1,273 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestPprofRequiresAdminToken(t *testing.T) {
+	a, _, _ := newTestAPI(t, func(cfg *config.Config) {
+		cfg.Pprof = true
+		cfg.AdminToken = "secret"
+	})
+
+	tests := []struct {
+		token string
+		want  int
+	}{
+		{"", 403},
+		{"wrong", 403},
+		{"secret", 200},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+		if tt.token != "" {
+			req.Header.Set("X-Admin-Token", tt.token)
+		}
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("token %q: status = %d, want %d", tt.token, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestPprofDisabledByDefault(t *testing.T) {
+	a, _, _ := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AdminToken = "secret"
+	})
+
+	req := httptest.NewRequest("GET", "/debug/pprof/", nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestAdminTransferFile(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AdminToken = "secret"
+	})
+	newKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileID := storeFile(t, a, storage, key, "a.txt", []byte("data"))
+
+	transfer := func(token string) int {
+		body := fmt.Sprintf(`{"from":%q,"to":%q}`, key, newKey)
+		req := httptest.NewRequest("POST", fmt.Sprintf("/admin/files/%d/transfer", fileID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Admin-Token", token)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := transfer("wrong"); status != 403 {
+		t.Fatalf("status without admin token = %d, want 403", status)
+	}
+	if status := transfer("secret"); status != 204 {
+		t.Fatalf("status = %d, want 204", status)
+	}
+	// файл вже не належить старому ключу
+	if status := transfer("secret"); status != 409 {
+		t.Fatalf("repeated transfer status = %d, want 409", status)
+	}
+
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.OwnerAPIKey != db.HashKey(newKey) {
+		t.Fatal("owner was not changed")
+	}
+}
+
+func TestAdminRevokeKey(t *testing.T) {
+	for _, policy := range []string{config.KeyDeletionRetain, config.KeyDeletionCascade} {
+		t.Run(policy, func(t *testing.T) {
+			a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.AdminToken = "secret"
+				cfg.KeyDeletionPolicy = policy
+			})
+			fileID := storeFile(t, a, storage, key, "a.txt", []byte("data"))
+
+			req := httptest.NewRequest("DELETE", "/admin/keys/"+db.HashKey(key), nil)
+			req.Header.Set("X-Admin-Token", "secret")
+			resp, err := a.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var revoked KeyRevoked
+			if err := json.NewDecoder(resp.Body).Decode(&revoked); err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 200 || revoked.Policy != policy || revoked.Files != 1 {
+				t.Fatalf("status = %d, response = %+v", resp.StatusCode, revoked)
+			}
+
+			req = httptest.NewRequest("GET", "/files", nil)
+			req.Header.Set("X-API-Key", key)
+			if resp, _ := a.app.Test(req); resp.StatusCode != 401 {
+				t.Fatalf("revoked key status = %d, want 401", resp.StatusCode)
+			}
+
+			file, err := a.db.GetFileByID(fileID)
+			if policy == config.KeyDeletionRetain && (err != nil || file.OwnerAPIKey != db.RetainedOwner) {
+				t.Fatalf("retained file = %+v, err = %v", file, err)
+			}
+			if policy == config.KeyDeletionCascade && err == nil {
+				t.Fatal("file of the revoked key was not deleted")
+			}
+		})
+	}
+}
+
+func TestGetAPIKeyRequiresAdminToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		public bool
+		token  string
+		want   int
+	}{
+		{"disabled without token", false, "", 403},
+		{"disabled with wrong token", false, "wrong", 403},
+		{"disabled with admin token", false, "secret", 200},
+		{"enabled without token", true, "", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, _ := newTestAPI(t, func(cfg *config.Config) {
+				cfg.AdminToken = "secret"
+				cfg.AllowPublicKeyCreation = tt.public
+			})
+
+			req := httptest.NewRequest("GET", "/get_api_key", nil)
+			if tt.token != "" {
+				req.Header.Set("X-Admin-Token", tt.token)
+			}
+			resp, err := a.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestAdminConfigHidesSecrets(t *testing.T) {
+	a, _, _ := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AdminToken = "admin-secret-token"
+		cfg.ResumeSecret = "resume-hmac-secret"
+		cfg.MaxUploadSize = 1 << 30
+	})
+
+	req := httptest.NewRequest("GET", "/admin/config", nil)
+	req.Header.Set("X-Admin-Token", "admin-secret-token")
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(body, []byte("admin-secret-token")) || bytes.Contains(body, []byte("resume-hmac-secret")) {
+		t.Fatalf("secrets leaked: %s", body)
+	}
+
+	var cfg EffectiveConfig
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ChunkSize != config.DefaultChunkSize || cfg.MaxUploadSize != 1<<30 || !cfg.AdminTokenSet || !cfg.ResumeSecretSet {
+		t.Fatalf("config = %+v", cfg)
+	}
+}
+
+func TestUploadClientAudit(t *testing.T) {
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AdminToken = "secret"
+	})
+
+	req := newUploadRequest(t, key, "audit.txt", []byte("audit"))
+	req.Header.Set("User-Agent", "backup-tool/2.1")
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	fileID := files[0].ID
+
+	audit := func(token string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/admin/files/%d", fileID), nil)
+		req.Header.Set("X-Admin-Token", token)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp = audit("secret")
+	var got FileAudit
+	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.UserAgent == nil || *got.UserAgent != "backup-tool/2.1" {
+		t.Fatalf("user agent = %v, want backup-tool/2.1", got.UserAgent)
+	}
+	// app.Test не має справжнього з'єднання, тож fiber бачить адресу 0.0.0.0
+	if got.IP == nil || *got.IP != "0.0.0.0" {
+		t.Fatalf("ip = %v, want 0.0.0.0", got.IP)
+	}
+	if got.OwnerAPIKey != db.HashKey(key) || got.FileName != "audit.txt" {
+		t.Fatalf("audit = %+v", got)
+	}
+
+	if resp := audit(key); resp.StatusCode != 403 {
+		t.Fatalf("audit with an api key = %d, want 403", resp.StatusCode)
+	}
+
+	// власник файлу клієнта завантаження не бачить
+	req = httptest.NewRequest("GET", "/files", nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.Contains(string(body), "backup-tool") || strings.Contains(string(body), "0.0.0.0") {
+		t.Fatalf("file list exposes the upload client: %s", body)
+	}
+}
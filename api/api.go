@@ -3,46 +3,93 @@ package api
 
 import (
 	"bufio"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
-	"math"
 	"mime"
 	"mime/multipart"
-	"sort"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
 	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/disk"
+	"github.com/ZaViBiS/infinity-storage/storage"
 	"github.com/ZaViBiS/infinity-storage/tgbot"
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/pprof"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 type API struct {
-	app   *fiber.App
-	tgbot *tgbot.TGBot
-	db    *db.DataBase
-	queue chan *db.Chunk
+	app       *fiber.App
+	storage   storage.Backend
+	db        *db.DataBase
+	queue     *fairQueue
+	shared    *sharedQueue // nil, якщо SHARED_QUEUE вимкнено
+	config    config.Config
+	clock     clock.Clock
+	scheduler *scheduler
+	workers   sync.WaitGroup
+	pending   sync.Map // *db.Chunk -> *sync.WaitGroup файлу, з якого chunk
+	auth      Authenticator
+	metrics   *keyMetrics // nil, якщо KEY_METRICS вимкнено
+	// tusUploads - стан незавершених tus завантажень, fileID -> *tusUpload
+	tusUploads sync.Map
+	// chunkSize - розмір chunk з CHUNK_SIZE
+	chunkSize int
+	cache     *chunkCache // nil, якщо CHUNK_CACHE_BYTES = 0
+	uploads   inflightUploads
+	shutdown  shutdown
+	// resumeSecret підписує токени продовження завантаження
+	resumeSecret []byte
+	// freeSpace повертає вільне місце на диску з path (disk.Free)
+	freeSpace func(path string) (uint64, error)
+	// aead шифрує chunks ключем STORAGE_KEY, nil - без шифрування
+	aead cipher.AEAD
+	// storageCheck - кеш перевірки доступності сховища перед завантаженням
+	storageCheck storageCheck
+	// throughput - середня швидкість відправки chunks workers, для ETA
+	throughput throughput
+	// transformers створюють похідні файли із завершених завантажень
+	transformers []Transformer
 }
 
 const (
-	ChunkSize        = 20 * 1024 * 1024
 	ChunksBufferSize = 7 // 140 MB
 )
 
-func NewServer(TGBot tgbot.TGBot, database *db.DataBase) *API {
+// NewServer створює сервер. auth може бути nil, тоді запити перевіряються
+// API ключами з бази
+func NewServer(cfg config.Config, backend storage.Backend, database *db.DataBase, auth Authenticator) *API {
+	return newAPI(cfg, backend, database, clock.Real{}, auth)
+}
+
+func newAPI(cfg config.Config, backend storage.Backend, database *db.DataBase, clk clock.Clock, auth Authenticator) *API {
+	cfg.UploadWorkers = max(cfg.UploadWorkers, 1)
 	app := fiber.New(fiber.Config{
 		DisablePreParseMultipartForm: true,
 		StreamRequestBody:            true,
 		BodyLimit:                    -1,
+		ErrorHandler:                 errorHandler,
 	})
 
 	// CORS middleware
 	app.Use(func(c *fiber.Ctx) error {
 		// Set CORS headers
 		c.Set("Access-Control-Allow-Origin", "*")
-		c.Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-API-Key")
+		c.Set("Access-Control-Allow-Methods", "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Set("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-API-Key, Tus-Resumable, Upload-Length, Upload-Offset, Upload-Metadata, Content-Range")
+		c.Set("Access-Control-Expose-Headers", "Location, Tus-Resumable, Upload-Offset, Upload-Length")
 		c.Set("Access-Control-Max-Age", "86400")
 
 		// Handle preflight requests
@@ -75,25 +122,117 @@ func NewServer(TGBot tgbot.TGBot, database *db.DataBase) *API {
 	})
 
 	api := &API{
-		app:   app,
-		tgbot: &TGBot,
-		db:    database,
-		queue: make(chan *db.Chunk, 5),
+		app:     app,
+		storage: storage.Limit(backend, cfg.StorageConcurrency),
+		db:      database,
+		queue:   newFairQueue(5),
+		config:  cfg,
+		clock:   clk,
+		auth:    auth,
+
+		freeSpace: disk.Free,
+	}
+	api.chunkSize = cfg.ChunkSize
+	if api.chunkSize <= 0 {
+		api.chunkSize = config.DefaultChunkSize
+	}
+	if cfg.ChunkCacheBytes > 0 {
+		api.cache = newChunkCache(cfg.ChunkCacheBytes)
+	}
+	if cfg.SharedQueue {
+		api.shared = newSharedQueue(database, clk, cfg.InstanceID, cfg.QueueClaimTimeout, cfg.QueuePollInterval)
+	}
+	api.resumeSecret = resumeSecret(cfg.ResumeSecret)
+	api.aead = newChunkCipher(cfg.StorageKey)
+	if api.auth == nil {
+		api.auth = APIKeyAuthenticator{DB: database, Clock: clk}
+	}
+
+	if cfg.KeyMetrics {
+		api.metrics = newKeyMetrics(cfg.KeyMetricsLimit)
+		api.loadKeyUsage()
+		api.registerUploadMetrics()
+		api.registerQueueMetrics()
 	}
 
 	api.setupRoutes()
 
-	go api.uploaderWorker()
+	// chunks несуть свою позицію, тож порядок, у якому workers їх
+	// відправляють, не важливий
+	api.workers.Add(cfg.UploadWorkers)
+	for range cfg.UploadWorkers {
+		go api.uploaderWorker()
+	}
+
+	api.scheduler = newScheduler(api.clock)
+	api.scheduler.add("stale-uploads", cfg.StaleUploadsInterval, api.sweepStaleUploads)
+	api.scheduler.add("purge-deleted", cfg.PurgeInterval, api.purgeDeletedFiles)
+	if cfg.SlowUploadAfter > 0 {
+		api.scheduler.add("slow-uploads", cfg.SlowUploadsInterval, api.checkSlowUploads)
+	}
+	if cfg.RetryQueue {
+		api.scheduler.add("retry-chunks", cfg.RetryInterval, api.retryFailedChunks)
+	}
+	api.scheduler.start()
 
 	return api
 }
 
 func (a *API) setupRoutes() {
+	a.app.Use(a.trackWrites)
+	if a.config.ReadOnly {
+		a.app.Use(a.rejectWrites)
+	}
+	if a.config.DebugBodies {
+		a.app.Use(a.debugBodyLogger)
+	}
+	if a.config.Pprof {
+		a.app.Use("/debug/pprof", a.adminGuard)
+		a.app.Use(pprof.New())
+	}
+	if a.metrics != nil {
+		a.app.Use(a.countResponses)
+		a.app.Get("/metrics", a.adminGuard, a.metricsHandler())
+	}
+
 	a.app.Get("/", a.handleMain)
-	a.app.Get("/get_api_key", a.handleGetAPIKey)
-	a.app.Post("/upload", a.handleUpload)
+	a.app.Get("/health", a.handleHealth)
+	if a.config.AllowPublicKeyCreation {
+		a.app.Get("/get_api_key", a.handleGetAPIKey)
+	} else {
+		a.app.Get("/get_api_key", a.adminGuard, a.handleGetAPIKey)
+	}
+	a.app.Get("/validate_key", a.handleValidateKey)
+	a.app.Delete("/api_key", a.handleRevokeOwnKey)
+	a.app.Post("/upload", a.trackUpload, a.handleUpload)
+	a.app.Post("/upload/validate", a.handleValidateUpload)
+	a.app.Post("/upload/resume", a.trackUpload, a.handleResumeUpload)
 	a.app.Get("/list", a.handleGetFilesList)
+	a.app.Get("/files", a.handleGetFilesList)
 	a.app.Get("/get_file", a.handleGetFile)
+	a.app.Get("/download/:fileID", a.handleDownload)
+	a.app.Get("/files/:fileID", a.handleGetFileDetails)
+	a.app.Patch("/files/:fileID", a.handleUpdateFile)
+	a.app.Delete("/files/:fileID", a.handleDeleteFile)
+	a.app.Get("/files/:fileID/status", a.handleGetFileStatus)
+	a.app.Get("/files/:fileID/chunks", a.handleGetFileChunks)
+	a.app.Get("/files/:fileID/checksum", a.handleGetFileChecksum)
+	a.app.Post("/files/:fileID/verify", a.handleVerifyFile)
+	if a.config.DirectURLs {
+		a.app.Get("/files/:fileID/urls", a.handleGetFileURLs)
+	}
+	a.app.Get("/export", a.handleExport)
+	a.app.Post("/uploads", a.handleCreateUpload)
+	a.app.Put("/uploads/:fileID/chunks/:position", a.trackUpload, a.handleUploadChunk)
+	a.app.Post("/tus", a.handleTusCreate)
+	a.app.Head("/tus/:fileID", a.handleTusHead)
+	a.app.Patch("/tus/:fileID", a.trackUpload, a.handleTusPatch)
+
+	admin := a.app.Group("/admin", a.adminGuard)
+	admin.Get("/files/:fileID", a.handleGetFileAudit)
+	admin.Post("/files/:fileID/transfer", a.handleTransferFile)
+	admin.Get("/config", a.handleGetConfig)
+	admin.Delete("/keys/:hash", a.handleRevokeKey)
 }
 
 func (a *API) handleMain(c *fiber.Ctx) error {
@@ -101,6 +240,21 @@ func (a *API) handleMain(c *fiber.Ctx) error {
 }
 
 func (a *API) handleGetAPIKey(c *fiber.Ctx) error {
+	// ?ttl=24h - ключ для тимчасової інтеграції, який сам перестане діяти
+	if raw := c.Query("ttl"); raw != "" {
+		ttl, err := time.ParseDuration(raw)
+		if err != nil || ttl <= 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid ttl")
+		}
+		expiresAt := a.clock.Now().Add(ttl)
+		newKey, err := a.db.NewExpiringAPIKey(expiresAt)
+		if err != nil {
+			log.Err(err).Msg("помилка створення api ключа")
+			return c.SendStatus(500)
+		}
+		return c.JSON(fiber.Map{"key": newKey, "expires_at": expiresAt})
+	}
+
 	newKey, err := a.db.NewAPIKey()
 	if err != nil {
 		log.Err(err).Msg("помилка створення api ключа")
@@ -109,6 +263,44 @@ func (a *API) handleGetAPIKey(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"key": newKey})
 }
 
+// handleValidateKey перевіряє ключ без інших дій і повертає його стан
+func (a *API) handleValidateKey(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		return err
+	}
+
+	// з іншим Authenticator власника може не бути серед ключів у базі
+	validKey, err := a.db.GetKeyByHash(key)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Err(err).Msg("помилка отримання api ключа")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to get key")
+	}
+
+	status := KeyStatus{Enabled: true, ExpiresAt: validKey.ExpiresAt}
+	if validKey.QuotaBytes > 0 {
+		used, err := a.db.UsedBytes(key)
+		if err != nil {
+			log.Err(err).Msg("помилка підрахунку використаного місця")
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to get usage")
+		}
+		remaining := max(validKey.QuotaBytes-used, 0)
+		status.QuotaRemaining = &remaining
+	}
+	return c.JSON(status)
+}
+
+// handleRevokeOwnKey відкликає ключ, яким підписано запит, наприклад якщо він
+// витік. Після цього ключ не проходить перевірку, тож файли ним не скачати
+func (a *API) handleRevokeOwnKey(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+	return a.revokeKey(c, key)
+}
+
 func (a *API) handleUpload(c *fiber.Ctx) error {
 	// Перевірка API ключа
 	key, err := a.validateAPIKey(c)
@@ -116,124 +308,460 @@ func (a *API) handleUpload(c *fiber.Ctx) error {
 		log.Warn().Err(err).Msg("невалідний API ключ")
 		return err
 	}
-	log.Debug().Str("key", key[:10]+"...").Msg("API ключ валідний")
-
-	req := c.Context().Request
+	log.Debug().Str("key", shortKey(key)).Msg("API ключ валідний")
 
-	ct := string(req.Header.ContentType())
-	if !strings.HasPrefix(ct, "multipart/form-data") {
-		return fiber.NewError(400, "multipart required")
+	declared, err := declaredSize(c)
+	if err != nil {
+		return err
 	}
-
-	_, params, err := mime.ParseMediaType(ct)
+	priority, err := uploadPriority(c)
 	if err != nil {
 		return err
 	}
-	boundary := params["boundary"]
+	mr, stopDeadline, err := a.multipartReader(c)
+	if err != nil {
+		return err
+	}
+	defer stopDeadline()
 
-	mr := multipart.NewReader(req.BodyStream(), boundary)
+	tags, err := parseTags(c.Get("X-Tags"))
+	if err != nil {
+		return err
+	}
 
-	// Create an initial file entry with placeholder metadata
-	fileID, err := a.db.CreateNewFile("", 0, key, 0)
+	// запис першого файлу створюється до читання тіла, щоб обрив до першого
+	// chunk було видно за ABORTED_UPLOAD_POLICY
+	fileID, err := a.newUploadFile(c, key, tags, declared)
 	if err != nil {
-		log.Err(err).Msg("помилка створення файлу")
-		return fiber.NewError(fiber.StatusInternalServerError, "failed to create file")
+		return err
 	}
+	defer a.updateKeyUsage(key)
 
+	var timings UploadTimings
+	parts := newPartLimiter(a.config.MaxConcurrentParts)
+	received := false
 	for {
 		part, err := mr.NextPart()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return err
+			// зіпсоване тіло або відключення до першого файлу: інакше запис
+			// лишився б "uploading"
+			if !received {
+				a.abortFile(fileID)
+			}
+			return uploadError(err)
 		}
 
 		if part.FormName() != "file" {
 			continue
 		}
-
-		filename := part.FileName()
-		log.Info().Str("file", filename).Msg("отримано файл")
-
-		readBuf := make([]byte, 64*1024)
-		chunk := make([]byte, 0, ChunkSize)
-		chunkIndex := 1
-		var total int64
-
-		for {
-			n, err := part.Read(readBuf)
-			if n > 0 {
-				data := readBuf[:n]
-				total += int64(n)
-
-				for len(data) > 0 {
-					space := ChunkSize - len(chunk)
-
-					if space > len(data) {
-						chunk = append(chunk, data...)
-						data = nil
-					} else {
-						chunk = append(chunk, data[:space]...)
-						data = data[space:]
-
-						// 🚀 ОБРОБКА ЛОГІЧНОГО ЧАНКУ
-						log.Debug().
-							Int("chunk", chunkIndex).
-							Int("size", len(chunk)).
-							Msg("processing chunk")
-
-						a.queue <- &db.Chunk{
-							FileID:   fileID, // Corrected case
-							Position: chunkIndex,
-							Size:     int64(len(chunk)),
-							Data:     chunk,
-						}
-
-						chunkIndex++
-						chunk = chunk[:0]
-					}
-				}
-			}
-
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
+		// кожна частина "file" - окремий файл зі своїми chunks
+		if received {
+			if fileID, err = a.newUploadFile(c, key, tags, declared); err != nil {
 				return err
 			}
 		}
+		pending := parts.acquire()
+		err = a.receiveFile(key, fileID, part, 0, declared, priority, &timings, pending)
+		pending.Done()
+		if err != nil {
+			return err
+		}
+		received = true
+	}
 
-		// хвіст
-		if len(chunk) > 0 {
-			log.Debug().
-				Int("chunk", chunkIndex).
-				Int("size", len(chunk)).
-				Msg("processing last chunk")
-
-			a.queue <- &db.Chunk{ // Add this to send the last chunk
-				FileID:   fileID,
-				Position: chunkIndex,
-				Size:     int64(len(chunk)),
-				Data:     chunk,
-			}
+	if !received {
+		// без частини "file" лишився б порожній запис, якого ніхто не завантажить
+		if err := a.db.DeleteFile(fileID); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка видалення порожнього файлу")
 		}
+		return fiber.NewError(fiber.StatusBadRequest, "no file part")
+	}
+	return a.uploadAccepted(c, timings)
+}
 
-		// Update file metadata after upload is finished
-		totalChunks := int(math.Ceil(float64(total) / float64(ChunkSize)))
-		if err := a.db.UpdateFileMetadata(fileID, filename, total, totalChunks); err != nil {
-			log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення метаданих файлу")
-			// Decide how to handle this error, maybe return an error to client or just log
+// newUploadFile створює запис файлу завантаження з порожніми метаданими,
+// клієнтом, мітками і оголошеним розміром declared
+func (a *API) newUploadFile(c *fiber.Ctx, key string, tags []string, declared int64) (uint, error) {
+	fileID, err := a.requestDB(c).CreateNewFile("", 0, key, 0)
+	if err != nil {
+		log.Err(err).Msg("помилка створення файлу")
+		return 0, dbError(err, "failed to create file")
+	}
+	if err := a.db.SetFileClient(fileID, c.Get(fiber.HeaderUserAgent), c.IP()); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка збереження клієнта завантаження")
+	}
+	if err := a.db.TagFile(fileID, tags); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка додавання міток")
+		a.failFile(fileID)
+		return 0, fiber.NewError(fiber.StatusInternalServerError, "failed to tag file")
+	}
+	if declared != unknownUploadSize {
+		if err := a.db.SetFileDeclaredSize(fileID, declared); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження оголошеного розміру")
 		}
+	}
+	return fileID, nil
+}
+
+// declaredSize повертає розмір файлу з X-Total-Size, оголошений до відправки
+// тіла, або unknownUploadSize, якщо заголовка немає
+func declaredSize(c *fiber.Ctx) (int64, error) {
+	raw := c.Get("X-Total-Size")
+	if raw == "" {
+		return unknownUploadSize, nil
+	}
+	size, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || size < 0 {
+		return 0, fiber.NewError(fiber.StatusBadRequest, "invalid X-Total-Size")
+	}
+	return size, nil
+}
+
+// uploadPriority повертає пріоритет відправки chunks завантаження з заголовка
+// X-Priority (high, normal або low), без заголовка - db.PriorityNormal
+func uploadPriority(c *fiber.Ctx) (int, error) {
+	switch strings.ToLower(c.Get("X-Priority")) {
+	case "", "normal":
+		return db.PriorityNormal, nil
+	case "high":
+		return db.PriorityHigh, nil
+	case "low":
+		return db.PriorityLow, nil
+	}
+	return 0, fiber.NewError(fiber.StatusBadRequest, "invalid X-Priority")
+}
+
+// multipartReader перевіряє, що тіло - multipart, і повертає потоковий reader,
+// який обриває занадто повільні завантаження. stop треба викликати, коли
+// тіло більше не читається
+func (a *API) multipartReader(c *fiber.Ctx) (mr *multipart.Reader, stop func(), err error) {
+	req := &c.Context().Request
+
+	ct := string(req.Header.ContentType())
+	if !strings.HasPrefix(ct, "multipart/form-data") {
+		return nil, nil, fiber.NewError(400, "multipart required")
+	}
+
+	_, params, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return nil, nil, err
+	}
+	boundary := params["boundary"]
 
-		log.Info().
-			Str("file", filename).
+	body := req.BodyStream()
+	stop = func() {}
+	if a.config.UploadMinRate > 0 {
+		// клієнт, що зовсім замовк, блокує читання з'єднання: read deadline
+		// у минулому змушує його повернути помилку
+		conn := c.Context().Conn()
+		deadline := newDeadlineReader(body, a.clock, int64(req.Header.ContentLength()), a.config.UploadMinRate, func() {
+			conn.SetReadDeadline(time.Now())
+		})
+		body, stop = deadline, deadline.Stop
+	}
+	return multipart.NewReader(body, boundary), stop, nil
+}
+
+// receiveFile читає файл з multipart і ділить його на chunks, починаючи після
+// позиції confirmed (0 для нового завантаження, більше - для продовження).
+// declared - оголошений клієнтом розмір усього файлу або unknownUploadSize,
+// priority - пріоритет chunks у черзі відправки.
+// Chunks, поставлені в чергу, враховуються в pending, якщо він заданий
+func (a *API) receiveFile(key string, fileID uint, part *multipart.Part, confirmed int, declared int64, priority int, timings *UploadTimings, pending *sync.WaitGroup) error {
+	filename := part.FileName()
+	log.Info().Str("file", filename).Msg("отримано файл")
+
+	// у продовженні частина файлу вже врахована в квоті, тож оголошений
+	// розмір перевіряється наперед лише для нового завантаження
+	size := int64(unknownUploadSize)
+	if confirmed == 0 {
+		size = declared
+	}
+	reason, err := a.checkUpload(key, uploadMeta{
+		FileName:    filename,
+		ContentType: part.Header.Get("Content-Type"),
+		Size:        size,
+	})
+	if err != nil {
+		log.Err(err).Msg("помилка перевірки завантаження")
+		a.failFile(fileID)
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to validate upload")
+	}
+	if reason != "" {
+		a.failFile(fileID)
+		return rejectionError(reason)
+	}
+
+	// усі chunks до confirmed повні, тому файл продовжується з цього зсуву
+	offset := int64(confirmed) * int64(a.chunkSize)
+	limit, err := a.uploadSizeLimit(key)
+	if err != nil {
+		log.Err(err).Msg("помилка перевірки квоти")
+		a.failFile(fileID)
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to validate upload")
+	}
+	var partBody io.Reader = part
+	if limit >= 0 {
+		partBody = &sizeLimitReader{r: part, limit: max(limit-offset, 0)}
+	}
+	// без Content-Type тип визначається за початком файлу, який є лише
+	// в першій спробі, а не в продовженні. Так при завантаженні файлу
+	// не треба тягнути його перший chunk зі сховища
+	contentType, hasType := normalizeContentType(part.Header.Get("Content-Type"))
+	var sniffer *sniffReader
+	if !hasType && confirmed == 0 && a.config.SniffContentType {
+		sniffer = &sniffReader{r: partBody}
+		partBody = sniffer
+	}
+	// checksum усього файлу можна порахувати, лише якщо всі дані пройшли через цей запит
+	var digest hash.Hash
+	if confirmed == 0 {
+		digest = sha256.New()
+		partBody = io.TeeReader(partBody, digest)
+	}
+
+	var total int64
+	var positions []int
+	started := time.Now()
+	body := &timedReader{r: partBody}
+	sender, streaming := a.streamSender()
+	if streaming {
+		total, positions, err = a.streamPart(sender, fileID, filename, body, confirmed+1)
+	} else {
+		total, positions, err = a.bufferPart(key, fileID, filename, body, confirmed+1, priority, pending)
+	}
+	var interrupted *interruptedError
+	if errors.As(err, &interrupted) && confirmed+len(positions) > 0 {
+		return a.resumableError(key, fileID, confirmed+len(positions), interrupted)
+	}
+	if interrupted != nil {
+		// жоден chunk не прийнято, тож продовжувати нічого: новий chunk у чергу
+		// вже не потрапить, а файл прибирається, щоб не висів "uploading"
+		log.Warn().Err(interrupted.err).Uint("fileID", fileID).Msg("завантаження обірвано до першого chunk")
+		a.abortFile(fileID)
+		var fiberErr *fiber.Error
+		if errors.As(interrupted.err, &fiberErr) {
+			return fiberErr
+		}
+		return fiber.NewError(fiber.StatusBadRequest, interrupted.Error())
+	}
+	if err != nil {
+		a.failFile(fileID)
+		return err
+	}
+
+	// усе, що не читання тіла, - це відправка (потоково) або нарізка на chunks
+	timings.ReadBody += body.elapsed
+	if streaming {
+		timings.Upload += time.Since(started) - body.elapsed
+	} else {
+		timings.Chunking += time.Since(started) - body.elapsed
+	}
+
+	// Update file metadata after upload is finished
+	// кількість береться з реально створених chunks, а не з розміру,
+	// щоб вона завжди збігалась з рядками в базі
+	total += offset
+	totalChunks := confirmed + len(positions)
+	if declared != unknownUploadSize && total != declared {
+		log.Warn().
+			Uint("fileID", fileID).
+			Int64("declared", declared).
 			Int64("size", total).
-			Msg("upload finished")
+			Msg("розмір файлу не збігається з X-Total-Size")
+		a.failFile(fileID)
+		return fiber.NewError(fiber.StatusBadRequest, "file size does not match X-Total-Size")
+	}
+	// checksum і тип записуються до метаданих: з ними файл може одразу
+	// стати completed, і перетворення мають бачити його повністю
+	if digest != nil {
+		if err := a.db.SetFileChecksum(fileID, hex.EncodeToString(digest.Sum(nil))); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження checksum файлу")
+		}
+	}
+	if sniffer != nil {
+		contentType, hasType = normalizeContentType(sniffer.contentType())
+	}
+	if hasType {
+		if err := a.db.SetFileContentType(fileID, contentType); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження типу файлу")
+		}
+	}
+	if err := a.db.UpdateFileMetadata(fileID, filename, total, totalChunks); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення метаданих файлу")
+		// Decide how to handle this error, maybe return an error to client or just log
+	}
+	// файл прийнято, але chunks з черги ще можуть відправлятись
+	a.recomputeFileStatus(fileID)
+	mismatch, err := a.checkStoredChunkOrder(fileID, totalChunks)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка перевірки позицій chunks")
+	}
+	if mismatch != nil {
+		return &responseError{status: fiber.StatusInternalServerError, body: mismatch}
+	}
+
+	log.Info().
+		Str("file", filename).
+		Int64("size", total).
+		Msg("upload finished")
+	return nil
+}
+
+func (a *API) uploadAccepted(c *fiber.Ctx, timings UploadTimings) error {
+	if c.QueryBool("timings") {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{"timings": timings})
 	}
 	return c.SendStatus(fiber.StatusAccepted)
 }
 
+// bufferPart ділить файл filename з multipart на chunks у пам'яті і ставить їх у чергу
+// відправки від імені owner з пріоритетом priority, нумеруючи з first, і повертає
+// розмір файлу і позиції створених chunks
+func (a *API) bufferPart(owner string, fileID uint, filename string, part io.Reader, first, priority int, pending *sync.WaitGroup) (int64, []int, error) {
+	readBuf := make([]byte, 64*1024)
+	chunk := make([]byte, 0, a.chunkSize)
+	chunkIndex := first
+	var total int64
+	var parity []byte
+	var positions []int
+
+	for {
+		n, err := part.Read(readBuf)
+		if n > 0 {
+			data := readBuf[:n]
+			total += int64(n)
+
+			for len(data) > 0 {
+				space := a.chunkSize - len(chunk)
+
+				if space > len(data) {
+					chunk = append(chunk, data...)
+					data = nil
+				} else {
+					chunk = append(chunk, data[:space]...)
+					data = data[space:]
+
+					// 🚀 ОБРОБКА ЛОГІЧНОГО ЧАНКУ
+					log.Debug().
+						Int("chunk", chunkIndex).
+						Int("size", len(chunk)).
+						Msg("processing chunk")
+
+					if a.config.Parity {
+						parity = xorInto(parity, chunk)
+					}
+
+					a.enqueue(owner, &db.Chunk{
+						FileID:   fileID, // Corrected case
+						FileName: filename,
+						Priority: priority,
+						Position: chunkIndex,
+						Size:     int64(len(chunk)),
+						Data:     chunk,
+					}, pending)
+					positions = append(positions, chunkIndex)
+
+					// буфер тепер належить черзі: worker відправляє його асинхронно,
+					// тож наступний chunk пишеться в новий, а не поверх ще не відправленого
+					chunkIndex++
+					chunk = make([]byte, 0, a.chunkSize)
+				}
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return total, positions, interruptUpload(err)
+		}
+	}
+
+	// хвіст
+	if len(chunk) > 0 {
+		log.Debug().
+			Int("chunk", chunkIndex).
+			Int("size", len(chunk)).
+			Msg("processing last chunk")
+
+		if a.config.Parity {
+			parity = xorInto(parity, chunk)
+		}
+
+		a.enqueue(owner, &db.Chunk{ // Add this to send the last chunk
+			FileID:   fileID,
+			FileName: filename,
+			Priority: priority,
+			Position: chunkIndex,
+			Size:     int64(len(chunk)),
+			Data:     chunk,
+		}, pending)
+		positions = append(positions, chunkIndex)
+	}
+
+	if len(parity) > 0 {
+		a.enqueue(owner, &db.Chunk{
+			FileID:   fileID,
+			FileName: filename,
+			Priority: priority,
+			Parity:   true,
+			Size:     int64(len(parity)),
+			Data:     parity,
+		}, pending)
+	}
+	return total, positions, nil
+}
+
+// timedReader рахує, скільки часу пішло на читання тіла запиту
+type timedReader struct {
+	r       io.Reader
+	elapsed time.Duration
+}
+
+func (r *timedReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	n, err := r.r.Read(p)
+	r.elapsed += time.Since(start)
+	return n, err
+}
+
+// responseError - помилка, відповіддю на яку є JSON body зі статусом status
+type responseError struct {
+	status int
+	body   any
+}
+
+func (e *responseError) Error() string {
+	return fmt.Sprintf("%d: %v", e.status, e.body)
+}
+
+// errorHandler відповідає на responseError його JSON, на інші помилки - як fiber
+func errorHandler(c *fiber.Ctx, err error) error {
+	var resp *responseError
+	if errors.As(err, &resp) {
+		return c.Status(resp.status).JSON(resp.body)
+	}
+	return fiber.DefaultErrorHandler(c, err)
+}
+
+// uploadError перетворює помилку читання тіла в відповідь клієнту
+func uploadError(err error) error {
+	if errors.Is(err, errUploadTooSlow) {
+		return fiber.NewError(fiber.StatusRequestTimeout, "upload too slow")
+	}
+	if errors.Is(err, errUploadTooLarge) {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "upload exceeds the size limit or quota")
+	}
+	return err
+}
+
+// fileStatuses - статуси, за якими можна фільтрувати список файлів
+var fileStatuses = []string{"uploading", "processing", "completed", "failed"}
+
 func (a *API) handleGetFilesList(c *fiber.Ctx) error {
 	// Перевірка API ключа
 	key, err := a.validateAPIKey(c)
@@ -241,15 +769,34 @@ func (a *API) handleGetFilesList(c *fiber.Ctx) error {
 		log.Warn().Err(err).Msg("невалідний API ключ")
 		return err
 	}
-	log.Debug().Str("key", key[:10]+"...").Msg("API ключ валідний")
+	log.Debug().Str("key", shortKey(key)).Msg("API ключ валідний")
 
-	files := a.db.GetFilesListByKey(key)
+	filter := db.FileFilter{Tag: c.Query("tag"), Status: c.Query("status")}
+	if filter.Status != "" && !slices.Contains(fileStatuses, filter.Status) {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown status: "+filter.Status)
+	}
+	fields, err := parseFields(c.Query("fields"), &filter)
+	if err != nil {
+		return err
+	}
+	if c.Query("format") == "ndjson" {
+		return a.streamFilesList(c, key, filter, fields)
+	}
 
-	for _, file := range files {
-		println(file.FileName)
+	files, err := a.requestDB(c).ListFilesByOwner(key, filter)
+	if err != nil {
+		log.Err(err).Msg("помилка отримання списку файлів")
+		return dbError(err, "failed to list files")
 	}
 
-	return c.Status(200).JSON(fiber.Map{"files": files})
+	if fields == nil {
+		return c.Status(200).JSON(fiber.Map{"files": files})
+	}
+	projected := make([]any, len(files))
+	for i, file := range files {
+		projected[i] = projectFile(file, fields)
+	}
+	return c.Status(200).JSON(fiber.Map{"files": projected})
 }
 
 func (a *API) handleGetFile(c *fiber.Ctx) error {
@@ -259,65 +806,300 @@ func (a *API) handleGetFile(c *fiber.Ctx) error {
 		log.Warn().Err(err).Msg("невалідний API ключ")
 		return err
 	}
-	log.Debug().Str("key", key[:10]+"...").Msg("API ключ валідний")
+	log.Debug().Str("key", shortKey(key)).Msg("API ключ валідний")
 
-	fileID := c.QueryInt("file_id")
+	file, err := a.ownedFileByID(c, key, c.QueryInt("file_id"))
+	if err != nil {
+		return err
+	}
+	return a.sendFile(c, file)
+}
 
-	file, err := a.db.GetFileByID(uint(fileID))
+// handleDownload віддає файл лише ключу-власнику
+func (a *API) handleDownload(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
 	if err != nil {
-		log.Err(err).Msg("помилка отримання фалу з бази")
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err})
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
 	}
 
-	chunks := a.db.GetChunksByFileID(file.ID)
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+	return a.sendFile(c, file)
+}
+
+// sendFile збирає файл з його chunks у сховищі і віддає клієнту,
+// підтримуючи один діапазон з заголовка Range. Віддаються лише завершені
+// файли, і до заголовків відповіді, щоб клієнт не отримав обрізаний файл з 200
+func (a *API) sendFile(c *fiber.Ctx, file db.File) error {
+	if file.Status != "completed" {
+		return fiber.NewError(fiber.StatusConflict, "file is not completed")
+	}
+
+	// відповідь будується з реальних chunks, TotalChunks лише для перевірки
+	all, err := a.db.GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return dbError(err, "failed to get chunks")
+	}
+	chunks, parity := splitParity(all)
 	if len(chunks) != file.TotalChunks {
-		panic(fmt.Errorf("кількість чанків не збігаєтся"))
+		log.Error().
+			Uint("fileID", file.ID).
+			Int("chunks", len(chunks)).
+			Int("totalChunks", file.TotalChunks).
+			Msg("кількість chunks не збігається з TotalChunks")
+		return fiber.NewError(fiber.StatusInternalServerError, "file chunks are incomplete")
 	}
-	// сортування за позицією
-	sort.Slice(chunks, func(i, j int) bool {
-		return chunks[i].Position < chunks[j].Position
-	})
 
-	c.Set("Content-Type", "application/octet-stream")
-	c.Set("Content-Disposition", "attachment; filename="+file.FileName)
-	c.Set("Content-Length", fmt.Sprintf("%d", file.Size))
+	contentType := file.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Set("Content-Type", contentType)
+	c.Set("Content-Disposition", contentDisposition(file.FileName, a.config.FilenameHeaderLimit))
+	c.Set("Accept-Ranges", "bytes")
+	c.Set(fiber.HeaderETag, fileETag(file))
+	if file.Checksum != "" {
+		c.Set(checksumHeader, file.Checksum)
+	}
+
+	// повертаємо весь файл, якщо Range немає або він не підтримується
+	start, end := int64(0), file.Size-1
+	if header := c.Get(fiber.HeaderRange); header != "" {
+		rangeStart, rangeEnd, ok, err := parseRange(header, file.Size)
+		if err != nil {
+			c.Set("Content-Range", fmt.Sprintf("bytes */%d", file.Size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+		if ok {
+			start, end = rangeStart, rangeEnd
+			c.Status(fiber.StatusPartialContent)
+			c.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, file.Size))
+		}
+	}
+
+	// зі сховища завантажуються лише chunks, що перекривають діапазон
+	wanted, wantedStart := chunksInRange(chunks, start, end)
+
+	// перший chunk завантажуємо до початку відповіді, щоб помилку сховища
+	// можна було повернути клієнту статусом, а не обірваним тілом
+	var first []byte
+	if len(wanted) > 0 {
+		first, err = a.fetchChunk(file.ID, wanted[0], chunks, parity)
+		if err != nil {
+			return storageError(err)
+		}
+	}
+
+	// весь файл звіряється з checksum з бази по ходу віддачі: при розбіжності
+	// останні дані не віддаються, і клієнт отримує обірване тіло, а не тихо
+	// зіпсований файл. Trailer тут не передати: довжина відповіді відома
+	// наперед, тож тіло не chunked
+	var digest hash.Hash
+	if file.Checksum != "" && start == 0 && end == file.Size-1 {
+		digest = sha256.New()
+	}
 
 	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-		for _, chunk := range chunks {
-			rawData, err := a.tgbot.GetFileByID(chunk.TelegramFileID)
-			if err != nil {
-				panic(err)
+		// решта chunks завантажується наперед, поки попередні пишуться у відповідь
+		done := make(chan struct{})
+		defer close(done)
+		var next func() chunkResult
+		if len(wanted) > 1 {
+			next = a.prefetchChunks(file.ID, wanted[1:], chunks, parity, done)
+		}
+
+		offset := wantedStart
+		for i, chunk := range wanted {
+			rawData := first
+			if i > 0 {
+				res := next()
+				rawData, err = res.data, res.err
+				if err != nil {
+					log.Err(err).
+						Uint("fileID", file.ID).
+						Int("position", chunk.Position).
+						Str("class", string(tgbot.ClassifyError(err))).
+						Msg("помилка отримання chunk, відповідь обірвано")
+					return
+				}
 			}
 
-			if _, err := w.Write(rawData); err != nil {
-				panic(err)
+			if digest != nil {
+				digest.Write(rawData)
+				if i == len(wanted)-1 {
+					if actual := hex.EncodeToString(digest.Sum(nil)); actual != file.Checksum {
+						log.Error().
+							Uint("fileID", file.ID).
+							Str("expected", file.Checksum).
+							Str("actual", actual).
+							Msg("checksum файлу не збігається, відповідь обірвано")
+						return
+					}
+				}
+			}
+
+			// пропускаємо байти поза запитаним діапазоном
+			chunkStart := offset
+			offset += int64(len(rawData))
+			if offset <= start || chunkStart > end {
+				continue
+			}
+			from := max(start-chunkStart, 0)
+			to := min(end-chunkStart+1, int64(len(rawData)))
+
+			if _, err := w.Write(rawData[from:to]); err != nil {
+				log.Err(err).Uint("fileID", file.ID).Msg("помилка запису відповіді")
+				return
 			}
 
 			// w.Flush()
 		}
 	})
+	c.Response().Header.SetContentLength(int(end - start + 1))
 	return nil
 }
 
-func (a *API) validateAPIKey(c *fiber.Ctx) (string, error) {
-	key := c.Get("Authorization")
-	if key != "" {
-		key = strings.TrimPrefix(key, "Bearer ")
-	} else {
-		key = c.Get("X-API-Key")
+// chunksInRange повертає chunks, що перекривають байти файлу [start, end],
+// і зсув першого з них у файлі. Межі рахуються з Size chunks; якщо розмір
+// якогось chunk невідомий, повертаються всі chunks з нуля
+func chunksInRange(chunks []db.Chunk, start, end int64) ([]db.Chunk, int64) {
+	var offset, wantedStart int64
+	from, to := -1, len(chunks)
+	for i, chunk := range chunks {
+		if chunk.Size <= 0 {
+			return chunks, 0
+		}
+		if offset > end {
+			to = i
+			break
+		}
+		if from < 0 && offset+chunk.Size > start {
+			from, wantedStart = i, offset
+		}
+		offset += chunk.Size
+	}
+	if from < 0 {
+		return nil, 0
+	}
+	return chunks[from:to], wantedStart
+}
+
+func (a *API) handleGetFileDetails(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
 	}
 
-	if key == "" {
-		return "", fiber.NewError(fiber.StatusUnauthorized, "no API key")
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
 	}
 
-	validKey, err := a.db.GetAPIKey(key)
+	storedSize, err := a.requestDB(c).StoredSize(file.ID)
 	if err != nil {
-		return "", fiber.NewError(fiber.StatusUnauthorized, "no API key")
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка підрахунку розміру в сховищі")
+		return dbError(err, "failed to get stored size")
+	}
+
+	c.Set(fiber.HeaderETag, fileETag(file))
+	return c.JSON(FileDetails{
+		ID:          file.ID,
+		FileName:    file.FileName,
+		Size:        file.Size,
+		StoredSize:  storedSize,
+		TotalChunks: file.TotalChunks,
+		ContentType: file.ContentType,
+		Status:      file.Status,
+		Checksum:    file.Checksum,
+		CreatedAt:   file.CreatedAt,
+		UpdatedAt:   file.UpdatedAt,
+	})
+}
+
+// fetchChunk завантажує chunk зі сховища, а якщо він недоступний - відновлює з parity
+func (a *API) fetchChunk(fileID uint, chunk db.Chunk, chunks []db.Chunk, parity *db.Chunk) ([]byte, error) {
+	rawData, err := a.loadChunk(chunk)
+	if err != nil && parity != nil {
+		log.Warn().Err(err).
+			Uint("fileID", fileID).
+			Int("position", chunk.Position).
+			Msg("chunk недоступний, відновлюємо з parity")
+		return a.reconstructChunk(chunk, chunks, *parity)
+	}
+	return rawData, err
+}
+
+// storageError перетворює помилку сховища у відповідь клієнту
+func storageError(err error) error {
+	class := tgbot.ClassifyError(err)
+	log.Err(err).Str("class", string(class)).Msg("помилка отримання chunk зі сховища")
+
+	switch class {
+	case tgbot.ErrorRateLimited:
+		return fiber.NewError(fiber.StatusServiceUnavailable, "storage is rate limited, retry later")
+	case tgbot.ErrorTransient:
+		return fiber.NewError(fiber.StatusBadGateway, "storage is temporarily unavailable")
+	case tgbot.ErrorNotFound:
+		return fiber.NewError(fiber.StatusNotFound, "file data is missing in storage")
+	}
+	return fiber.NewError(fiber.StatusInternalServerError, "failed to read file from storage")
+}
+
+// requestDB повертає базу, запити до якої скасовуються разом із запитом клієнта
+func (a *API) requestDB(c *fiber.Ctx) *db.DataBase {
+	return a.db.WithContext(c.UserContext())
+}
+
+// dbError перетворює помилку бази у відповідь клієнту: 503, якщо запит не
+// встиг за DB_QUERY_TIMEOUT, інакше 500 з message
+func dbError(err error, message string) error {
+	if db.IsTimeout(err) {
+		return fiber.NewError(fiber.StatusServiceUnavailable, "database timeout")
 	}
-	return validKey.Key, nil
+	return fiber.NewError(fiber.StatusInternalServerError, message)
+}
+
+// ownedFile повертає файл з параметра :fileID, якщо він належить key
+func (a *API) ownedFile(c *fiber.Ctx, key string) (db.File, error) {
+	fileID, err := c.ParamsInt("fileID")
+	if err != nil {
+		return db.File{}, fiber.NewError(fiber.StatusBadRequest, "invalid file id")
+	}
+	return a.ownedFileByID(c, key, fileID)
+}
+
+// ownedFileByID - те саме, що ownedFile, для id, переданого не в шляху
+func (a *API) ownedFileByID(c *fiber.Ctx, key string, fileID int) (db.File, error) {
+	if fileID <= 0 {
+		return db.File{}, fiber.NewError(fiber.StatusBadRequest, "invalid file id")
+	}
+
+	file, err := a.requestDB(c).GetFileByID(uint(fileID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return db.File{}, fiber.NewError(fiber.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("помилка отримання фалу з бази")
+		return db.File{}, dbError(err, "failed to get file")
+	}
+
+	if file.OwnerAPIKey != key {
+		return db.File{}, fiber.NewError(fiber.StatusForbidden, "file belongs to another key")
+	}
+	return file, nil
+}
+
+// validateAPIKey повертає ключ власника запиту через налаштований Authenticator
+func (a *API) validateAPIKey(c *fiber.Ctx) (string, error) {
+	return a.auth.Authenticate(c)
 }
 
-func (a *API) Start() {
-	log.Fatal().Err(a.app.Listen(":8081")).Msg("помилка запуску http серверу")
+// Start запускає http сервер і повертає керування після Shutdown
+func (a *API) Start() error {
+	return a.app.Listen(":8081")
 }
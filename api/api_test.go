@@ -0,0 +1,866 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeStorage - сховище в пам'яті замість телеграму
+type fakeStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	delay time.Duration // імітація затримки мережі в GetFileByID
+	// getErr, якщо задано, повертається з GetFileByID
+	getErr error
+	// sendErrs повертаються з SendFile по одній, після них - sendErr
+	sendErrs []error
+	sendErr  error
+	// streamed - скільки chunks прийшло через SendFileStream
+	streamed int
+	// names - імена файлів усіх успішних відправок
+	names []string
+	// gets - скільки разів викликано GetFileByID
+	gets int
+	// messages - id файлу за id повідомлення, deleted - id видалених повідомлень
+	messages map[int]string
+	deleted  []int
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{files: make(map[string][]byte), messages: make(map[int]string)}
+}
+
+func (s *fakeStorage) SendFile(fileName string, data []byte, caption string) (string, error) {
+	id, _, err := s.SendFileMessage(fileName, data, caption)
+	return id, err
+}
+
+func (s *fakeStorage) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sendErrs) > 0 {
+		err := s.sendErrs[0]
+		s.sendErrs = s.sendErrs[1:]
+		return "", 0, err
+	}
+	if s.sendErr != nil {
+		return "", 0, s.sendErr
+	}
+
+	// повідомлення не забуваються й після видалення, тому id не повторюються
+	messageID := len(s.messages) + 1
+	id := fmt.Sprintf("tg-%d", messageID)
+	s.files[id] = append([]byte(nil), data...)
+	s.names = append(s.names, fileName)
+	s.messages[messageID] = id
+	return id, messageID, nil
+}
+
+func (s *fakeStorage) DeleteFile(fileID string, messageID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id, ok := s.messages[messageID]
+	if !ok || id != fileID {
+		return fmt.Errorf("повідомлення %d з файлом %s не знайдено", messageID, fileID)
+	}
+	delete(s.files, id)
+	s.deleted = append(s.deleted, messageID)
+	return nil
+}
+
+func (s *fakeStorage) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	id, err := s.SendFile(fileName, data, "")
+	if err == nil {
+		s.mu.Lock()
+		s.streamed++
+		s.mu.Unlock()
+	}
+	return id, err
+}
+
+func (s *fakeStorage) DirectURL(fileID string) (string, error) {
+	return "https://files.test/" + fileID, nil
+}
+
+func (s *fakeStorage) GetFileByID(fileID string) ([]byte, error) {
+	time.Sleep(s.delay)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.gets++
+	if s.getErr != nil {
+		return nil, s.getErr
+	}
+	data, ok := s.files[fileID]
+	if !ok {
+		return nil, fmt.Errorf("файл %s не знайдено", fileID)
+	}
+	return data, nil
+}
+
+// newTestAPI створює сервер з фейковим сховищем, годинником і новим ключем,
+// options змінюють конфіг до створення сервера
+func newTestAPI(t testing.TB, options ...func(cfg *config.Config)) (*API, *fakeStorage, string) {
+	t.Helper()
+
+	var cfg config.Config
+	for _, option := range options {
+		option(&cfg)
+	}
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newFakeStorage()
+	a := newAPI(cfg, storage, database, clock.NewFake(time.Now()), nil)
+	t.Cleanup(func() {
+		a.Stop(context.Background())
+	})
+	return a, storage, key
+}
+
+// storeFile записує файл у сховище і базу так, ніби його вже завантажили
+func storeFile(t testing.TB, a *API, storage *fakeStorage, key, name string, chunks ...[]byte) uint {
+	t.Helper()
+
+	fileID, err := a.db.CreateNewFile("", 0, db.HashKey(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var size int64
+	for i, data := range chunks {
+		telegramID, err := storage.SendFile(name, data, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = a.db.AddChunkToFile(&db.Chunk{
+			FileID:         fileID,
+			Position:       i + 1,
+			Size:           int64(len(data)),
+			StoredSize:     int64(len(data)),
+			Status:         "completed",
+			TelegramFileID: telegramID,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		size += int64(len(data))
+	}
+
+	if err := a.db.UpdateFileMetadata(fileID, name, size, len(chunks)); err != nil {
+		t.Fatal(err)
+	}
+	return fileID
+}
+
+// newUploadRequest будує multipart запит на /upload з одним файлом
+func newUploadRequest(t testing.TB, key, name string, data []byte) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := part.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+	return req
+}
+
+func TestGetFileRanges(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "hello.txt", []byte("hello "), []byte("world"))
+	url := fmt.Sprintf("/get_file?file_id=%d", fileID)
+
+	req := httptest.NewRequest("GET", url, nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 || string(body) != "hello world" {
+		t.Fatalf("full GET = %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+		t.Fatalf("Accept-Ranges = %q, want bytes", got)
+	}
+
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set("Range", "bytes=4-7")
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	if resp.StatusCode != 206 || string(body) != "o wo" {
+		t.Fatalf("ranged GET = %d %q", resp.StatusCode, body)
+	}
+	if got := resp.Header.Get("Content-Range"); got != "bytes 4-7/11" {
+		t.Fatalf("Content-Range = %q", got)
+	}
+
+	req = httptest.NewRequest("GET", url, nil)
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set("Range", "bytes=50-")
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 416 {
+		t.Fatalf("unsatisfiable GET = %d, want 416", resp.StatusCode)
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header     string
+		start, end int64
+		ok         bool
+		err        bool
+	}{
+		{header: "bytes=0-4", start: 0, end: 4, ok: true},
+		{header: "bytes=5-", start: 5, end: 9, ok: true},
+		{header: "bytes=-3", start: 7, end: 9, ok: true},
+		{header: "bytes=8-100", start: 8, end: 9, ok: true},
+		{header: "bytes=0-1,4-5"},
+		{header: "items=0-1"},
+		{header: "bytes=5-2"},
+		{header: "bytes=10-", err: true},
+		{header: "bytes=-0", err: true},
+	}
+
+	for _, tt := range tests {
+		start, end, ok, err := parseRange(tt.header, 10)
+		if (err != nil) != tt.err || ok != tt.ok || start != tt.start || end != tt.end {
+			t.Errorf("parseRange(%q) = %d, %d, %v, %v", tt.header, start, end, ok, err)
+		}
+	}
+}
+
+func TestGetFileDetails(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "report.csv", []byte("aaaaaaaaaa"))
+	// chunk стиснений до 4 байтів
+	if err := a.db.DB.Model(&db.Chunk{}).Where("file_id = ?", fileID).Update("stored_size", 4).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := a.db.SetFileChecksum(fileID, "abc123"); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"id", "filename", "size", "stored_size", "total_chunks", "content_type", "status", "checksum", "created_at", "updated_at"} {
+		if _, ok := fields[name]; !ok {
+			t.Errorf("details have no %q: %s", name, body)
+		}
+	}
+	var details FileDetails
+	if err := json.Unmarshal(body, &details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Size != 10 || details.StoredSize != 4 || details.FileName != "report.csv" ||
+		details.TotalChunks != 1 || details.Status != "completed" || details.CreatedAt.IsZero() {
+		t.Fatalf("details = %+v", details)
+	}
+
+	req = httptest.NewRequest("GET", fmt.Sprintf("/files/%d", fileID+1), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 {
+		t.Fatalf("missing file status = %d, want 404", resp.StatusCode)
+	}
+
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", fmt.Sprintf("/files/%d", fileID), nil)
+	req.Header.Set("X-API-Key", otherKey)
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 403 {
+		t.Fatalf("other key status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestGetFileStorageErrors(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "hello.txt", []byte("hello"))
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{&tgbotapi.Error{Code: 429, Message: "Too Many Requests"}, 503},
+		{&tgbot.HTTPStatusError{StatusCode: 502}, 502},
+		{&tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file_id"}, 404},
+		{&tgbotapi.Error{Code: 401, Message: "Unauthorized"}, 500},
+	}
+	for _, tt := range tests {
+		storage.getErr = tt.err
+
+		req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%v: status = %d, want %d", tt.err, resp.StatusCode, tt.want)
+		}
+	}
+}
+
+func TestUploadTimings(t *testing.T) {
+	a, _, key := newTestAPI(t)
+
+	req := newUploadRequest(t, key, "a.txt", bytes.Repeat([]byte("data"), 1024))
+	req.RequestURI = "/upload?timings=true"
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Timings map[string]int64 `json:"timings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"read_body_ns", "chunking_ns"} {
+		if body.Timings[field] <= 0 {
+			t.Errorf("%s = %d, want positive", field, body.Timings[field])
+		}
+	}
+}
+
+// waitForChunks чекає, поки воркер збереже n chunks файлу
+func waitForChunks(t *testing.T, a *API, fileID uint, n int) []db.Chunk {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		chunks, err := a.db.GetChunksByFileID(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) >= n {
+			return chunks
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("got %d chunks, want %d", len(chunks), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForStatus чекає, поки workers доведуть файл до статусу status
+func waitForStatus(t *testing.T, a *API, fileID uint, status string) db.File {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		file, err := a.db.GetFileByID(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.Status == status {
+			return file
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("file status = %q, want %q", file.Status, status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestUploadTotalChunksAtBoundaries(t *testing.T) {
+	tests := []struct {
+		name      string
+		chunkSize int // 0 - CHUNK_SIZE не задано
+		size      int
+		chunks    int
+	}{
+		{"1x", 0, config.DefaultChunkSize, 1},
+		{"2x", 0, 2 * config.DefaultChunkSize, 2},
+		{"2.5x", 0, 2*config.DefaultChunkSize + config.DefaultChunkSize/2, 3},
+		{"1x+1", 0, config.DefaultChunkSize + 1, 2},
+		{"configured", 1000, 2500, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.ChunkSize = tt.chunkSize
+			})
+
+			resp, err := a.app.Test(newUploadRequest(t, key, "big.bin", make([]byte, tt.size)), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].TotalChunks != tt.chunks {
+				t.Fatalf("files = %+v, want %d chunks", files, tt.chunks)
+			}
+
+			chunks := waitForChunks(t, a, files[0].ID, tt.chunks)
+			if len(chunks) != files[0].TotalChunks {
+				t.Fatalf("%d chunk rows, TotalChunks %d", len(chunks), files[0].TotalChunks)
+			}
+			if chunks[0].Size != int64(a.chunkSize) && tt.size >= a.chunkSize {
+				t.Fatalf("first chunk is %d bytes, chunk size %d", chunks[0].Size, a.chunkSize)
+			}
+		})
+	}
+}
+
+func TestGetFileRequiresWholeFile(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "hello.txt", []byte("hello "), []byte("world"))
+	get := func() (int, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	// TotalChunks розійшовся з рядками в базі: віддати файл цілим не вийде
+	if err := a.db.DB.Model(&db.File{}).Where("id = ?", fileID).Update("total_chunks", 3).Error; err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get(); status != 500 || strings.Contains(body, "hello") {
+		t.Fatalf("GET with missing chunks = %d %q, want 500 without data", status, body)
+	}
+
+	// незавершений файл не віддається, навіть якщо частина chunks уже є
+	err := a.db.DB.Model(&db.File{}).Where("id = ?", fileID).
+		Updates(map[string]any{"total_chunks": 2, "status": "processing"}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status, body := get(); status != 409 {
+		t.Fatalf("GET of a processing file = %d %q, want 409", status, body)
+	}
+}
+
+func TestDownloadChecksOwner(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "hello.txt", []byte("hello "), []byte("world"))
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes := map[string]string{
+		"download": "/download/%d",
+		"get_file": "/get_file?file_id=%d",
+	}
+	for name, route := range routes {
+		t.Run(name, func(t *testing.T) {
+			download := func(key string, fileID uint) *http.Response {
+				t.Helper()
+				req := httptest.NewRequest("GET", fmt.Sprintf(route, fileID), nil)
+				req.Header.Set("X-API-Key", key)
+				resp, err := a.app.Test(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return resp
+			}
+
+			resp := download(key, fileID)
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 200 || string(body) != "hello world" {
+				t.Fatalf("download = %d %q", resp.StatusCode, body)
+			}
+			if resp.ContentLength != 11 || resp.Header.Get("Content-Disposition") != "attachment; filename=hello.txt" {
+				t.Fatalf("headers = length %d, disposition %q", resp.ContentLength, resp.Header.Get("Content-Disposition"))
+			}
+
+			if resp := download(otherKey, fileID); resp.StatusCode != 403 {
+				t.Fatalf("foreign key status = %d, want 403", resp.StatusCode)
+			}
+			if resp := download(key, fileID+100); resp.StatusCode != 404 {
+				t.Fatalf("missing file status = %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestBufferPartDoesNotReuseQueuedChunks(t *testing.T) {
+	a := &API{queue: newFairQueue(4), chunkSize: 1024}
+
+	// кожен chunk заповнений своїм байтом, щоб перезапис був помітний
+	data := append(bytes.Repeat([]byte{'a'}, a.chunkSize), bytes.Repeat([]byte{'b'}, a.chunkSize)...)
+	data = append(data, []byte("tail")...)
+	if _, _, err := a.bufferPart("owner", 1, "data.bin", bytes.NewReader(data), 1, db.PriorityNormal, nil); err != nil {
+		t.Fatal(err)
+	}
+	a.queue.close()
+
+	var got []byte
+	for {
+		chunk, ok := a.queue.pop()
+		if !ok {
+			break
+		}
+		got = append(got, chunk.Data...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("queued chunks were overwritten by later data")
+	}
+}
+
+func TestListFilesNDJSON(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	var want []uint
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		want = append(want, storeFile(t, a, storage, key, name, []byte(name)))
+	}
+
+	req := httptest.NewRequest("GET", "/files?format=ndjson", nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+		t.Fatalf("content type = %q", ct)
+	}
+
+	var got []uint
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var file db.File
+		if err := json.Unmarshal(scanner.Bytes(), &file); err != nil {
+			t.Fatalf("line %q: %v", scanner.Text(), err)
+		}
+		got = append(got, file.ID)
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("streamed files %v, want %v", got, want)
+	}
+}
+
+func TestUploadWithoutFilePart(t *testing.T) {
+	a, _, key := newTestAPI(t)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writer.WriteField("comment", "forgot the file"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+	req.Header.Set("X-Tags", "orphan")
+
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+
+	var count int64
+	if err := a.db.DB.Model(&db.File{}).Unscoped().Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Fatalf("%d file records left after a request without a file part", count)
+	}
+}
+
+func TestUploadDeclaredSize(t *testing.T) {
+	tests := []struct {
+		declared string
+		want     int
+		status   string
+	}{
+		{"3000", 202, "completed"},
+		{"2999", 400, "failed"},
+		{"4000", 400, "failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.declared, func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) { cfg.ChunkSize = 1024 })
+
+			req := newUploadRequest(t, key, "sized.bin", make([]byte, 3000))
+			req.Header.Set("X-Total-Size", tt.declared)
+			resp, err := a.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != 1 {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+			waitForStatus(t, a, files[0].ID, tt.status)
+		})
+	}
+
+	a, _, key := newTestAPI(t)
+	req := newUploadRequest(t, key, "sized.bin", []byte("data"))
+	req.Header.Set("X-Total-Size", "-1")
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("negative size status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestDownloadRangeFetchesOnlyOverlappingChunks(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "abc.txt", []byte("aaaa"), []byte("bbbb"), []byte("cccc"))
+
+	download := func(header string) (*http.Response, string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("Range", header)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, string(body)
+	}
+
+	tests := []struct {
+		header, want, contentRange string
+		gets                       int
+	}{
+		{"bytes=5-6", "bb", "bytes 5-6/12", 1},
+		{"bytes=3-8", "abbbbc", "bytes 3-8/12", 3},
+		{"bytes=4-7", "bbbb", "bytes 4-7/12", 1},
+		{"bytes=-2", "cc", "bytes 10-11/12", 1},
+	}
+	for _, tt := range tests {
+		storage.mu.Lock()
+		storage.gets = 0
+		storage.mu.Unlock()
+
+		resp, body := download(tt.header)
+		if resp.StatusCode != 206 || body != tt.want {
+			t.Errorf("%s: %d %q, want 206 %q", tt.header, resp.StatusCode, body, tt.want)
+		}
+		if got := resp.Header.Get("Content-Range"); got != tt.contentRange {
+			t.Errorf("%s: Content-Range = %q, want %q", tt.header, got, tt.contentRange)
+		}
+		storage.mu.Lock()
+		gets := storage.gets
+		storage.mu.Unlock()
+		if gets != tt.gets {
+			t.Errorf("%s: fetched %d chunks, want %d", tt.header, gets, tt.gets)
+		}
+	}
+
+	if resp, _ := download("bytes=12-"); resp.StatusCode != 416 || resp.Header.Get("Content-Range") != "bytes */12" {
+		t.Fatalf("unsatisfiable range = %d %q, want 416", resp.StatusCode, resp.Header.Get("Content-Range"))
+	}
+}
+
+// gatedFetchStorage віддає кожен chunk, лише коли тест пропустить його через gate
+type gatedFetchStorage struct {
+	*fakeStorage
+	gate    chan struct{}
+	fetches atomic.Int32
+}
+
+func (s *gatedFetchStorage) GetFileByID(fileID string) ([]byte, error) {
+	s.fetches.Add(1)
+	<-s.gate
+	return s.fakeStorage.GetFileByID(fileID)
+}
+
+func TestDownloadStreamsChunkByChunk(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &gatedFetchStorage{fakeStorage: newFakeStorage(), gate: make(chan struct{})}
+	a := newAPI(config.Config{}, storage, database, clock.NewFake(time.Now()), nil)
+
+	// chunks більші за буфер з'єднання fasthttp, тож нічого не чекає в ньому
+	const chunkSize, chunkCount = 64 * 1024, 8
+	var chunks [][]byte
+	for i := range chunkCount {
+		chunks = append(chunks, bytes.Repeat([]byte{byte('a' + i)}, chunkSize))
+	}
+	fileID := storeFile(t, a, storage.fakeStorage, key, "big.bin", chunks...)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go a.app.Listener(ln)
+	released := false
+	t.Cleanup(func() {
+		if !released {
+			close(storage.gate)
+		}
+		a.app.Shutdown()
+		a.Stop(context.Background())
+	})
+
+	responses := make(chan *http.Response, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("http://%s/download/%d", ln.Addr(), fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			close(responses)
+			return
+		}
+		responses <- resp
+	}()
+
+	storage.gate <- struct{}{}
+	var resp *http.Response
+	select {
+	case resp = <-responses:
+	case <-time.After(10 * time.Second):
+		t.Fatal("no response after the first chunk was fetched")
+	}
+	if resp == nil {
+		t.FailNow()
+	}
+	defer resp.Body.Close()
+
+	// перший chunk доходить до клієнта, поки другий ще не завантажено зі сховища
+	first := make([]byte, chunkSize)
+	read := make(chan error, 1)
+	go func() {
+		_, err := io.ReadFull(resp.Body, first)
+		read <- err
+	}()
+	select {
+	case err := <-read:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("first chunk was not streamed before the rest of the file was fetched")
+	}
+	if !bytes.Equal(first, chunks[0]) {
+		t.Fatal("first chunk differs")
+	}
+	if fetches := storage.fetches.Load(); fetches > 2 {
+		t.Fatalf("fetched %d chunks ahead of the client, want at most 2", fetches)
+	}
+
+	close(storage.gate)
+	released = true
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rest, bytes.Join(chunks[1:], nil)) {
+		t.Fatal("rest of the file differs")
+	}
+}
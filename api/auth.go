@@ -0,0 +1,59 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Authenticator визначає, від чийого імені виконується запит. Повернутий
+// рядок - власник файлів (OwnerAPIKey), помилка - відповідь клієнту (зазвичай 401).
+// Дозволяє підключити іншу автентифікацію (JWT, OAuth) без змін у handlers
+type Authenticator interface {
+	Authenticate(c *fiber.Ctx) (string, error)
+}
+
+// APIKeyAuthenticator - стандартна автентифікація API ключами з бази
+// (заголовок Authorization: Bearer або X-API-Key)
+type APIKeyAuthenticator struct {
+	DB    *db.DataBase
+	Clock clock.Clock
+}
+
+func (a APIKeyAuthenticator) Authenticate(c *fiber.Ctx) (string, error) {
+	key := requestAPIKey(c)
+	if key == "" {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "no API key")
+	}
+
+	validKey, err := a.DB.WithContext(c.UserContext()).GetAPIKey(key)
+	if db.IsTimeout(err) {
+		return "", dbError(err, "")
+	}
+	if err != nil {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "no API key")
+	}
+	if !validKey.Active(a.Clock.Now()) {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "API key is revoked or expired")
+	}
+	// власником файлів є hash ключа, сам ключ у базі не зберігається
+	return validKey.Hash, nil
+}
+
+// requestAPIKey повертає ключ з Authorization: Bearer або X-API-Key, не перевіряючи його
+func requestAPIKey(c *fiber.Ctx) string {
+	if key := c.Get("Authorization"); key != "" {
+		return strings.TrimPrefix(key, "Bearer ")
+	}
+	return c.Get("X-API-Key")
+}
+
+// shortKey обрізає ключ для логів, короткі ідентифікатори не показуються зовсім
+func shortKey(key string) string {
+	if len(key) <= 10 {
+		return "..."
+	}
+	return key[:10] + "..."
+}
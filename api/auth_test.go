@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// staticTokenAuth пускає лише запити з одним bearer токеном
+type staticTokenAuth struct {
+	token string
+	owner string
+}
+
+func (s staticTokenAuth) Authenticate(c *fiber.Ctx) (string, error) {
+	if c.Get("Authorization") != "Bearer "+s.token {
+		return "", fiber.NewError(fiber.StatusUnauthorized, "invalid token")
+	}
+	return s.owner, nil
+}
+
+func TestCustomAuthenticator(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	a.auth = staticTokenAuth{token: "static-token", owner: db.HashKey(key)}
+	fileID := storeFile(t, a, storage, key, "a.txt", []byte("data"))
+
+	request := func(header, value string) int {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d", fileID), nil)
+		req.Header.Set(header, value)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := request("Authorization", "Bearer static-token"); status != 200 {
+		t.Fatalf("static token status = %d, want 200", status)
+	}
+	if status := request("Authorization", "Bearer wrong"); status != 401 {
+		t.Fatalf("wrong token status = %d, want 401", status)
+	}
+	// стандартна перевірка ключів замінена повністю
+	if status := request("X-API-Key", key); status != 401 {
+		t.Fatalf("api key status = %d, want 401", status)
+	}
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// chunkCache - LRU кеш даних chunks у тому вигляді, в якому вони лежать у
+// сховищі, за їх id у сховищі. Сумарний розмір даних не перевищує maxBytes
+type chunkCache struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	order    *list.List // від найновішого до найстарішого, значення - *cacheEntry
+	entries  map[string]*list.Element
+}
+
+type cacheEntry struct {
+	id   string
+	data []byte
+}
+
+func newChunkCache(maxBytes int64) *chunkCache {
+	return &chunkCache{
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+// get повертає дані з кешу. Дані спільні для всіх читачів, змінювати їх не можна
+func (c *chunkCache) get(id string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*cacheEntry).data, true
+}
+
+// add кладе дані в кеш, витісняючи найдавніше використані, поки не вистачить
+// місця. Дані, більші за весь кеш, не кешуються
+func (c *chunkCache) add(id string, data []byte) {
+	size := int64(len(data))
+	if size > c.maxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.removeElement(element)
+	}
+	for c.size+size > c.maxBytes {
+		c.removeElement(c.order.Back())
+	}
+	c.entries[id] = c.order.PushFront(&cacheEntry{id: id, data: data})
+	c.size += size
+}
+
+// remove прибирає дані з кешу, наступне читання піде в сховище
+func (c *chunkCache) remove(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.removeElement(element)
+	}
+}
+
+func (c *chunkCache) removeElement(element *list.Element) {
+	entry := c.order.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.id)
+	c.size -= int64(len(entry.data))
+}
+
+// getStored завантажує файл зі сховища, спершу шукаючи його в кеші
+func (a *API) getStored(id string) ([]byte, error) {
+	if a.cache == nil {
+		return a.fetchStored(id)
+	}
+	if data, ok := a.cache.get(id); ok {
+		return data, nil
+	}
+	data, err := a.fetchStored(id)
+	if err != nil {
+		return nil, err
+	}
+	a.cache.add(id, data)
+	return data, nil
+}
+
+// fetchStored завантажує файл зі сховища, записуючи тривалість запиту в метрики
+func (a *API) fetchStored(id string) ([]byte, error) {
+	started := time.Now()
+	defer func() { a.metrics.observeStorage("get", time.Since(started)) }()
+	return a.storage.GetFileByID(id)
+}
+
+// uncache прибирає дані chunk з кешу, щоб наступне читання перевірило сховище
+func (a *API) uncache(chunk db.Chunk) {
+	if a.cache == nil {
+		return
+	}
+	a.cache.remove(chunk.TelegramFileID)
+	for _, id := range chunk.SubParts {
+		a.cache.remove(id)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+)
+
+func TestChunkCacheEvictsToBudget(t *testing.T) {
+	cache := newChunkCache(10)
+	cache.add("a", []byte("aaaa"))
+	cache.add("b", []byte("bbbb"))
+	cache.get("a") // b тепер найдавніше використаний
+	cache.add("c", []byte("cccc"))
+
+	if _, ok := cache.get("b"); ok {
+		t.Fatal("least recently used entry was not evicted")
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, ok := cache.get(id); !ok {
+			t.Fatalf("entry %s was evicted", id)
+		}
+	}
+	if cache.size != 8 {
+		t.Fatalf("cache size = %d, want 8", cache.size)
+	}
+
+	cache.add("big", make([]byte, 11))
+	if _, ok := cache.get("big"); ok || cache.size > cache.maxBytes {
+		t.Fatalf("entry over the budget was cached, size = %d", cache.size)
+	}
+}
+
+func TestSecondDownloadHitsCache(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChunkCacheBytes = 1024
+	})
+	fileID := storeFile(t, a, storage, key, "popular.txt", []byte("hello "), []byte("world"))
+
+	download := func() {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != "hello world" {
+			t.Fatalf("body = %q", body)
+		}
+	}
+
+	download()
+	if storage.gets != 2 {
+		t.Fatalf("first download fetched %d chunks, want 2", storage.gets)
+	}
+	download()
+	if storage.gets != 2 {
+		t.Fatalf("second download fetched %d more chunks from storage", storage.gets-2)
+	}
+}
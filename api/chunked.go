@@ -0,0 +1,171 @@
+package api
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// handleCreateUpload створює файл за маніфестом chunks, які клієнт
+// порахував сам, і повертає file_id для подальших PUT кожного chunk
+func (a *API) handleCreateUpload(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	tags, err := parseTags(c.Get("X-Tags"))
+	if err != nil {
+		return err
+	}
+
+	var req RequestNewUpload
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid json")
+	}
+	if req.Filename == "" || len(req.Chunks) == 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "filename and chunks are required")
+	}
+
+	algorithm := checksum.Normalize(a.config.ChecksumAlgorithm)
+	checksumLen, err := checksum.HexLen(algorithm)
+	if err != nil {
+		return err
+	}
+
+	chunks := make([]db.Chunk, len(req.Chunks))
+	var size int64
+	for i, manifest := range req.Chunks {
+		if manifest.Position != i+1 {
+			return fiber.NewError(fiber.StatusBadRequest, "chunk positions must be 1..n in order")
+		}
+		if manifest.Size <= 0 || manifest.Size > int64(a.chunkSize) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("chunk %d has invalid size", manifest.Position))
+		}
+		if _, err := hex.DecodeString(manifest.Checksum); err != nil || len(manifest.Checksum) != checksumLen {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("chunk %d has invalid %s checksum", manifest.Position, algorithm))
+		}
+
+		chunks[i] = db.Chunk{
+			Position:          manifest.Position,
+			Size:              manifest.Size,
+			Status:            "pending",
+			Checksum:          strings.ToLower(manifest.Checksum),
+			ChecksumAlgorithm: algorithm,
+		}
+		size += manifest.Size
+	}
+
+	reason, err := a.checkUpload(key, uploadMeta{FileName: req.Filename, Size: size})
+	if err != nil {
+		log.Err(err).Msg("помилка перевірки завантаження")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to validate upload")
+	}
+	if reason != "" {
+		return rejectionError(reason)
+	}
+
+	fileID, err := a.db.CreateFileWithChunks(db.File{
+		FileName:    req.Filename,
+		Size:        size,
+		TotalChunks: len(chunks),
+		Status:      "uploading",
+		OwnerAPIKey: key,
+	}, chunks)
+	if err != nil {
+		log.Err(err).Msg("помилка створення файлу")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to create file")
+	}
+	if err := a.db.TagFile(fileID, tags); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка додавання міток")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to tag file")
+	}
+
+	a.updateKeyUsage(key)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"file_id": fileID})
+}
+
+// handleUploadChunk приймає тіло одного chunk і перевіряє його checksum
+// з маніфестом (і з заголовком X-Chunk-Checksum, якщо він є)
+func (a *API) handleUploadChunk(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	position, err := c.ParamsInt("position")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid position")
+	}
+	priority, err := uploadPriority(c)
+	if err != nil {
+		return err
+	}
+	chunk, err := a.db.GetChunk(file.ID, position)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "chunk is not in the manifest")
+	}
+	if err != nil {
+		log.Err(err).Msg("помилка отримання chunk з бази")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to get chunk")
+	}
+
+	data := c.Body()
+	sum, err := checksum.Sum(chunk.ChecksumAlgorithm, data)
+	if err != nil {
+		return err
+	}
+	if header := c.Get("X-Chunk-Checksum"); header != "" && strings.ToLower(header) != sum {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "chunk checksum mismatch")
+	}
+	if sum != chunk.Checksum || int64(len(data)) != chunk.Size {
+		return fiber.NewError(fiber.StatusUnprocessableEntity, "chunk does not match the manifest")
+	}
+
+	ok, err := a.db.SetChunkStatus(chunk.ID, "pending", "uploading")
+	if err != nil {
+		log.Err(err).Msg("помилка оновлення статусу chunk")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to update chunk")
+	}
+	if !ok {
+		return fiber.NewError(fiber.StatusConflict, "chunk already uploaded")
+	}
+
+	// тіло запиту належить fasthttp, тому в чергу йде копія
+	chunk.Status = "uploading"
+	chunk.FileName = file.FileName
+	chunk.Priority = priority
+	chunk.Data = append([]byte(nil), data...)
+	a.enqueue(key, &chunk, nil)
+
+	pending, err := a.db.CountChunksByStatus(file.ID, "pending")
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка підрахунку chunks")
+	} else if pending == 0 {
+		chunks, err := a.db.GetChunksByFileID(file.ID)
+		if err != nil {
+			log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+			return dbError(err, "failed to get chunks")
+		}
+		if mismatch := a.checkChunkOrder(file.ID, chunkPositions(chunks), file.TotalChunks); mismatch != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(mismatch)
+		}
+		a.recomputeFileStatus(file.ID)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
@@ -0,0 +1,226 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func createUpload(t *testing.T, a *API, key string, chunks ...[]byte) uint {
+	t.Helper()
+
+	req := RequestNewUpload{Filename: "manifest.bin"}
+	for i, data := range chunks {
+		req.Chunks = append(req.Chunks, ManifestChunk{Position: i + 1, Size: int64(len(data)), Checksum: sha256Hex(data)})
+	}
+	body, _ := json.Marshal(req)
+
+	httpReq := httptest.NewRequest("POST", "/uploads", bytes.NewReader(body))
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 {
+		t.Fatalf("create upload status = %d", resp.StatusCode)
+	}
+
+	var created struct {
+		FileID uint `json:"file_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+	return created.FileID
+}
+
+func putChunk(t *testing.T, a *API, key string, fileID uint, position int, data []byte, checksum string) int {
+	t.Helper()
+
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/uploads/%d/chunks/%d", fileID, position), bytes.NewReader(data))
+	req.Header.Set("X-API-Key", key)
+	if checksum != "" {
+		req.Header.Set("X-Chunk-Checksum", checksum)
+	}
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestUploadChunkMatchingChecksum(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	first, second := []byte("hello "), []byte("world")
+	fileID := createUpload(t, a, key, first, second)
+
+	if status := putChunk(t, a, key, fileID, 1, first, sha256Hex(first)); status != 202 {
+		t.Fatalf("chunk 1 status = %d, want 202", status)
+	}
+	if status := putChunk(t, a, key, fileID, 1, first, ""); status != 409 {
+		t.Fatalf("repeated chunk 1 status = %d, want 409", status)
+	}
+	if status := putChunk(t, a, key, fileID, 2, second, ""); status != 202 {
+		t.Fatalf("chunk 2 status = %d, want 202", status)
+	}
+
+	file := waitForStatus(t, a, fileID, "completed")
+	if file.Size != 11 || file.TotalChunks != 2 {
+		t.Fatalf("file = %+v", file)
+	}
+}
+
+func TestUploadChunkMismatchingChecksum(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	data := []byte("hello")
+	fileID := createUpload(t, a, key, data)
+
+	// тіло не збігається з маніфестом
+	if status := putChunk(t, a, key, fileID, 1, []byte("hellO"), ""); status != 422 {
+		t.Fatalf("corrupted chunk status = %d, want 422", status)
+	}
+	// заголовок не збігається з тілом
+	if status := putChunk(t, a, key, fileID, 1, data, sha256Hex([]byte("other"))); status != 422 {
+		t.Fatalf("wrong header checksum status = %d, want 422", status)
+	}
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "pending" {
+		t.Fatalf("chunk status = %q, want pending", chunk.Status)
+	}
+}
+
+func TestUploadChunkConfiguredAlgorithm(t *testing.T) {
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChecksumAlgorithm = checksum.BLAKE3
+	})
+	data := []byte("hello")
+	sum, err := checksum.Sum(checksum.BLAKE3, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(RequestNewUpload{
+		Filename: "blake3.bin",
+		Chunks:   []ManifestChunk{{Position: 1, Size: int64(len(data)), Checksum: sum}},
+	})
+	req := httptest.NewRequest("POST", "/uploads", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 {
+		t.Fatalf("create upload status = %d", resp.StatusCode)
+	}
+	var created struct {
+		FileID uint `json:"file_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatal(err)
+	}
+
+	if status := putChunk(t, a, key, created.FileID, 1, []byte("hellO"), ""); status != 422 {
+		t.Fatalf("corrupted chunk status = %d, want 422", status)
+	}
+	if status := putChunk(t, a, key, created.FileID, 1, data, sum); status != 202 {
+		t.Fatalf("chunk status = %d, want 202", status)
+	}
+}
+
+func TestChunkEndpointsCheckOwner(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	data := []byte("secret chunk")
+	fileID := createUpload(t, a, key, data)
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	endpoints := []struct {
+		method, path string
+		body         []byte
+	}{
+		{"GET", fmt.Sprintf("/files/%d/chunks", fileID), nil},
+		{"GET", fmt.Sprintf("/files/%d/status", fileID), nil},
+		{"PUT", fmt.Sprintf("/uploads/%d/chunks/1", fileID), data},
+		// позиції немає в маніфесті, але власник перевіряється раніше
+		{"PUT", fmt.Sprintf("/uploads/%d/chunks/7", fileID), data},
+	}
+	for _, e := range endpoints {
+		req := httptest.NewRequest(e.method, e.path, bytes.NewReader(e.body))
+		req.Header.Set("X-API-Key", otherKey)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 403 {
+			t.Errorf("%s %s with another key = %d, want 403", e.method, e.path, resp.StatusCode)
+		}
+		if bytes.Contains(body, []byte(sha256Hex(data))) {
+			t.Errorf("%s %s leaked the chunk checksum: %s", e.method, e.path, body)
+		}
+	}
+
+	// чужий ключ не зміг нічого записати, тож власник відправляє chunk як звичайно
+	if status := putChunk(t, a, key, fileID, 1, data, ""); status != 202 {
+		t.Fatalf("owner chunk status = %d, want 202", status)
+	}
+}
+
+func TestCreateUploadQuota(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	if err := a.db.DB.Model(&db.Key{}).Where("hash = ?", db.HashKey(key)).Update("quota_bytes", 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	create := func(sizes ...int64) int {
+		t.Helper()
+		req := RequestNewUpload{Filename: "manifest.bin"}
+		for i, size := range sizes {
+			req.Chunks = append(req.Chunks, ManifestChunk{Position: i + 1, Size: size, Checksum: sha256Hex(nil)})
+		}
+		body, _ := json.Marshal(req)
+		httpReq := httptest.NewRequest("POST", "/uploads", bytes.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/json")
+		httpReq.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// маніфест більший за квоту відхиляється ще до створення файлу
+	if status := create(60, 60); status != 413 {
+		t.Fatalf("manifest over the quota status = %d, want 413", status)
+	}
+	if used, err := a.db.UsedBytes(db.HashKey(key)); err != nil || used != 0 {
+		t.Fatalf("used = %d, err = %v, want 0", used, err)
+	}
+	if status := create(60, 40); status != 201 {
+		t.Fatalf("manifest filling the quota status = %d, want 201", status)
+	}
+	if status := create(1); status != 413 {
+		t.Fatalf("manifest for a full key status = %d, want 413", status)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/klauspost/compress/zstd"
+	"github.com/rs/zerolog/log"
+)
+
+// EncodeAll і DecodeAll можна викликати з кількох goroutines одночасно
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compressChunk стискає дані chunk, якщо увімкнено CompressChunks. Дані, які
+// не стискаються (JPEG, ZIP тощо), лишаються як є, щоб не роздувати їх
+func (a *API) compressChunk(chunk *db.Chunk) {
+	if !a.config.CompressChunks {
+		return
+	}
+
+	compressed := zstdEncoder.EncodeAll(chunk.Data, make([]byte, 0, len(chunk.Data)))
+	if len(compressed) >= len(chunk.Data) {
+		log.Debug().
+			Uint("fileID", chunk.FileID).
+			Int("position", chunk.Position).
+			Msg("chunk не стискається, відправляємо як є")
+		return
+	}
+	chunk.Data = compressed
+	chunk.Compressed = true
+}
+
+// decompressChunk розпаковує chunk, size - його розмір до стиснення
+func decompressChunk(data []byte, size int64) ([]byte, error) {
+	return zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestCompressChunksOnlyWhenSmaller(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.CompressChunks = true
+	})
+
+	compressible := bytes.Repeat([]byte("infinity storage "), 1000)
+	incompressible := make([]byte, 4096)
+	if _, err := rand.Read(incompressible); err != nil {
+		t.Fatal(err)
+	}
+	data := append(append([]byte(nil), compressible...), incompressible...)
+
+	fileID, err := a.db.CreateNewFile("mixed.bin", int64(len(data)), db.HashKey(key), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, part := range [][]byte{compressible, incompressible} {
+		a.processChunk(&db.Chunk{FileID: fileID, Position: i + 1, Size: int64(len(part)), Data: append([]byte(nil), part...)})
+	}
+
+	first, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !first.Compressed || first.StoredSize >= first.Size || int64(len(storage.files[first.TelegramFileID])) != first.StoredSize {
+		t.Fatalf("compressible chunk = compressed %v, stored %d of %d", first.Compressed, first.StoredSize, first.Size)
+	}
+	second, err := a.db.GetChunk(fileID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Compressed || second.StoredSize != second.Size || !bytes.Equal(storage.files[second.TelegramFileID], incompressible) {
+		t.Fatalf("incompressible chunk = compressed %v, stored %d of %d", second.Compressed, second.StoredSize, second.Size)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("downloaded data differs from uploaded")
+	}
+}
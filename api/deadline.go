@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+)
+
+// uploadDeadlineGrace - запас часу на встановлення з'єднання і повільний старт
+const uploadDeadlineGrace = 30 * time.Second
+
+// deadlineCheckInterval - як часто дедлайн перевіряється, поки читання чекає на клієнта
+const deadlineCheckInterval = time.Second
+
+var errUploadTooSlow = errors.New("upload is slower than the minimum rate")
+
+// deadlineReader обриває завантаження, якщо клієнт не тримає мінімальну швидкість.
+// Коли розмір тіла відомий, дедлайн рахується одразу від розміру,
+// інакше перевіряється, що отримано не менше minRate*час.
+// Крім перевірки на кожному читанні, дедлайн стежить watch: клієнт, який
+// зовсім перестав слати дані, блокує Read, і перервати його може лише interrupt
+type deadlineReader struct {
+	r        io.Reader
+	clock    clock.Clock
+	minRate  int64 // байт/с
+	size     int64 // -1, якщо розмір невідомий
+	start    time.Time
+	deadline time.Time
+	read     atomic.Int64
+	expired  atomic.Bool
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newDeadlineReader повертає reader з дедлайном. interrupt викликається з
+// іншої goroutine, коли дедлайн минув, і має розблокувати читання r
+// (наприклад, виставити з'єднанню read deadline). nil - лише перевірка на
+// кожному читанні. Після читання reader треба зупинити через Stop
+func newDeadlineReader(r io.Reader, c clock.Clock, size, minRate int64, interrupt func()) *deadlineReader {
+	d := &deadlineReader{r: r, clock: c, minRate: minRate, size: size, start: c.Now(), done: make(chan struct{})}
+	if size >= 0 {
+		d.deadline = d.start.Add(uploadDeadline(size, minRate))
+	}
+	if interrupt != nil {
+		go d.watch(interrupt)
+	}
+	return d
+}
+
+// uploadDeadline повертає, скільки часу дається на тіло розміром size
+func uploadDeadline(size, minRate int64) time.Duration {
+	return uploadDeadlineGrace + time.Duration(float64(size)/float64(minRate)*float64(time.Second))
+}
+
+// tooSlow повідомляє, чи клієнт на момент now уже не вклався в швидкість
+func (d *deadlineReader) tooSlow(now time.Time) bool {
+	if d.size >= 0 {
+		return now.After(d.deadline)
+	}
+	elapsed := now.Sub(d.start) - uploadDeadlineGrace
+	return elapsed > 0 && d.read.Load() < int64(elapsed.Seconds()*float64(d.minRate))
+}
+
+// watch перевіряє дедлайн, поки reader не зупинено, і перериває читання,
+// щойно клієнт не вклався
+func (d *deadlineReader) watch(interrupt func()) {
+	ticker := d.clock.NewTicker(deadlineCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C():
+			if d.tooSlow(d.clock.Now()) {
+				d.expired.Store(true)
+				interrupt()
+				return
+			}
+		}
+	}
+}
+
+// Stop зупиняє стеження за дедлайном, можна викликати кілька разів
+func (d *deadlineReader) Stop() {
+	d.stopOnce.Do(func() { close(d.done) })
+}
+
+func (d *deadlineReader) Read(p []byte) (int, error) {
+	if d.expired.Load() || d.tooSlow(d.clock.Now()) {
+		d.expired.Store(true)
+		return 0, errUploadTooSlow
+	}
+
+	n, err := d.r.Read(p)
+	d.read.Add(int64(n))
+	if err != nil && d.expired.Load() {
+		// читання перервав watch, помилка з'єднання - лише наслідок
+		return n, errUploadTooSlow
+	}
+	return n, err
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+)
+
+// stallingReader віддає по одному байту і на кожному читанні
+// "чекає" delay на фейковому годиннику
+type stallingReader struct {
+	data  []byte
+	clock *clock.Fake
+	delay time.Duration
+}
+
+func (r *stallingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	r.clock.Sleep(r.delay)
+	p[0] = r.data[0]
+	r.data = r.data[1:]
+	return 1, nil
+}
+
+func TestDeadlineReaderAbortsSlowUpload(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	size := int64(1000)
+	// 1000 байт при 100 байт/с - 40 с разом із запасом, а клієнт шле байт на секунду
+	stalling := &stallingReader{data: make([]byte, size), clock: fake, delay: time.Second}
+	r := newDeadlineReader(stalling, fake, size, 100, nil)
+
+	_, err := io.ReadAll(r)
+	if !errors.Is(err, errUploadTooSlow) {
+		t.Fatalf("err = %v, want errUploadTooSlow", err)
+	}
+	if read := r.read.Load(); read < 40 || read > 41 {
+		t.Fatalf("read %d bytes before the deadline, want about 40", read)
+	}
+}
+
+func TestDeadlineReaderAllowsFastUpload(t *testing.T) {
+	body := strings.Repeat("x", 1000)
+	r := newDeadlineReader(strings.NewReader(body), clock.NewFake(time.Now()), int64(len(body)), 1, nil)
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != body {
+		t.Fatal("body mismatch")
+	}
+}
+
+func TestDeadlineReaderUnknownSize(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	stalling := &stallingReader{data: make([]byte, 100), clock: fake, delay: time.Second}
+	r := newDeadlineReader(stalling, fake, -1, 10, nil)
+
+	// після 30 с запасу треба отримувати 10 байт/с, а приходить 1
+	_, err := io.ReadAll(r)
+	if !errors.Is(err, errUploadTooSlow) {
+		t.Fatalf("err = %v, want errUploadTooSlow", err)
+	}
+	if read := r.read.Load(); read < 30 || read > 35 {
+		t.Fatalf("read %d bytes before abort", read)
+	}
+}
+
+// blockedReader - клієнт, який зовсім перестав слати дані: Read чекає,
+// поки з'єднання не перервуть
+type blockedReader struct {
+	interrupted chan struct{}
+}
+
+func (r *blockedReader) Read(p []byte) (int, error) {
+	<-r.interrupted
+	return 0, os.ErrDeadlineExceeded
+}
+
+func TestDeadlineReaderInterruptsBlockedRead(t *testing.T) {
+	fake := clock.NewFake(time.Now())
+	blocked := &blockedReader{interrupted: make(chan struct{})}
+	// 1000 байт при 100 байт/с - 40 с разом із запасом
+	r := newDeadlineReader(blocked, fake, 1000, 100, func() { close(blocked.interrupted) })
+	defer r.Stop()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := io.ReadAll(r)
+		result <- err
+	}()
+
+	start := fake.Now()
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case err := <-result:
+			if !errors.Is(err, errUploadTooSlow) {
+				t.Fatalf("err = %v, want errUploadTooSlow", err)
+			}
+			if elapsed := fake.Now().Sub(start); elapsed < 40*time.Second {
+				t.Fatalf("read interrupted after %v, before the 40s deadline", elapsed)
+			}
+			return
+		case <-timeout:
+			t.Fatal("blocked read was never interrupted")
+		default:
+			fake.Advance(time.Second)
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package api
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// debugBodyLimit - скільки байтів тіла потрапляє в лог
+const debugBodyLimit = 1024
+
+var secretField = regexp.MustCompile(`("(?:key|token)"\s*:\s*)"[^"]*"`)
+
+// botToken - токен бота в посиланнях Telegram (.../file/bot<id>:<secret>/...)
+var botToken = regexp.MustCompile(`bot\d+:[A-Za-z0-9_-]+`)
+
+// isBulkRoute - маршрути з даними файлів або прямими посиланнями на них
+// (з токеном бота), тіла яких ніколи не логуються
+func isBulkRoute(c *fiber.Ctx) bool {
+	path := c.Path()
+	return path == "/upload" ||
+		path == "/upload/resume" ||
+		path == "/get_file" ||
+		path == "/export" ||
+		strings.HasPrefix(path, "/uploads/") ||
+		strings.HasPrefix(path, "/download/") ||
+		strings.HasPrefix(path, "/tus/") ||
+		strings.HasPrefix(path, "/debug/pprof") ||
+		strings.HasPrefix(path, "/files/") && strings.HasSuffix(path, "/urls")
+}
+
+// debugBodyLogger логує обрізані тіла запитів і відповідей для налагодження
+// інтеграцій. API ключі з заголовків, поля key/token у JSON і токени бота замінюються
+func (a *API) debugBodyLogger(c *fiber.Ctx) error {
+	if isBulkRoute(c) {
+		return c.Next()
+	}
+
+	var secrets []string
+	for _, header := range []string{"Authorization", "X-API-Key", "X-Admin-Token"} {
+		if value := strings.TrimPrefix(c.Get(header), "Bearer "); value != "" {
+			secrets = append(secrets, value)
+		}
+	}
+
+	requestBody := redactBody(c.Body(), secrets)
+	err := c.Next()
+	responseBody := redactBody(c.Response().Body(), secrets)
+
+	log.Info().
+		Str("method", c.Method()).
+		Str("path", c.Path()).
+		Str("request_body", requestBody).
+		Str("response_body", responseBody).
+		Msg("debug bodies")
+
+	return err
+}
+
+// redactBody замінює секрети в усьому тілі і лише потім обрізає його:
+// секрет на межі обрізки інакше лишився б у лозі початком
+func redactBody(body []byte, secrets []string) string {
+	res := secretField.ReplaceAllString(string(body), `$1"[REDACTED]"`)
+	res = botToken.ReplaceAllString(res, "bot[REDACTED]")
+	for _, secret := range secrets {
+		res = strings.ReplaceAll(res, secret, "[REDACTED]")
+	}
+	if len(res) > debugBodyLimit {
+		res = res[:debugBodyLimit] + "...(truncated)"
+	}
+	return res
+}
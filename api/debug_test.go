@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	previous := log.Logger
+	// віддача файлу логує з goroutine потоку відповіді, паралельно з логом запиту
+	log.Logger = zerolog.New(zerolog.SyncWriter(&buf))
+	t.Cleanup(func() { log.Logger = previous })
+	return &buf
+}
+
+func TestDebugBodyLoggerRedactsKeys(t *testing.T) {
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.DebugBodies = true
+		cfg.AllowPublicKeyCreation = true
+	})
+	logs := captureLogs(t)
+
+	resp, err := a.app.Test(httptest.NewRequest("GET", "/get_api_key", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var minted struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&minted); err != nil {
+		t.Fatal(err)
+	}
+
+	longName := strings.Repeat("a", 2*debugBodyLimit)
+	body := `{"filename":"` + longName + `","chunks":[]}`
+	req := httptest.NewRequest("POST", "/uploads", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	if _, err := a.app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+
+	out := logs.String()
+	if strings.Contains(out, minted.Key) || strings.Contains(out, key) {
+		t.Fatal("API key leaked into debug logs")
+	}
+	if !strings.Contains(out, `[REDACTED]`) {
+		t.Fatal("response with key was not logged redacted")
+	}
+	if !strings.Contains(out, "(truncated)") || strings.Contains(out, longName) {
+		t.Fatal("request body was not truncated")
+	}
+}
+
+func TestDebugBodyLoggerSkipsDownloads(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.DebugBodies = true
+	})
+	fileID := storeFile(t, a, storage, key, "secret.txt", []byte("file contents"))
+	logs := captureLogs(t)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+
+	if strings.Contains(logs.String(), "debug bodies") {
+		t.Fatal("download body was logged")
+	}
+}
+
+func TestDebugBodyLoggerSkipsDirectURLs(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.DebugBodies = true
+		cfg.DirectURLs = true
+	})
+	fileID := storeFile(t, a, storage, key, "a.txt", []byte("data"))
+	logs := captureLogs(t)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/urls", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("urls status = %d", resp.StatusCode)
+	}
+	if strings.Contains(logs.String(), "debug bodies") {
+		t.Fatal("direct urls were logged")
+	}
+}
+
+func TestRedactBodyBotToken(t *testing.T) {
+	body := `{"urls":["https://api.telegram.org/file/bot123456:AAH-secret_Token/documents/file_1"]}`
+	got := redactBody([]byte(body), nil)
+	if strings.Contains(got, "AAH-secret_Token") || !strings.Contains(got, "file/bot[REDACTED]/documents") {
+		t.Fatalf("redacted body = %s", got)
+	}
+}
+
+func TestRedactBodySecretOnTruncationBoundary(t *testing.T) {
+	secret := "0123456789abcdef0123456789abcdef"
+	// обидва секрети починаються до межі обрізки і закінчуються після неї
+	padding := strings.Repeat("a", debugBodyLimit-len(`{"pad":"","key":"`)-8)
+	body := `{"pad":"` + padding + `","key":"` + secret + `"}`
+	got := redactBody([]byte(body), nil)
+	if strings.Contains(got, secret[:8]) {
+		t.Fatalf("key prefix survived truncation: %s", got[len(got)-40:])
+	}
+
+	header := strings.Repeat("b", debugBodyLimit-8) + secret
+	got = redactBody([]byte(header), []string{secret})
+	if strings.Contains(got, secret[:8]) {
+		t.Fatalf("header secret prefix survived truncation: %s", got[len(got)-40:])
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// handleDeleteFile остаточно видаляє файл: спершу повідомлення з його chunks
+// у сховищі, потім записи з бази
+func (a *API) handleDeleteFile(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+	// з If-Match файл видаляється, лише якщо він не змінився з того часу,
+	// як клієнт отримав його ETag
+	if header := c.Get(fiber.HeaderIfMatch); header != "" && !ifMatch(header, file) {
+		return fiber.NewError(fiber.StatusPreconditionFailed, "file has changed")
+	}
+	// workers ще можуть зберегти chunk файлу, якого вже немає
+	if file.Status == "uploading" || file.Status == "processing" {
+		return fiber.NewError(fiber.StatusConflict, "file is still being uploaded")
+	}
+
+	chunks, err := a.requestDB(c).GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return dbError(err, "failed to get chunks")
+	}
+	a.deleteStoredChunks(file.ID, chunks)
+
+	if err := a.requestDB(c).DeleteFile(file.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "file not found")
+		}
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка видалення файлу")
+		return dbError(err, "failed to delete file")
+	}
+	a.updateKeyUsage(key)
+
+	log.Info().Uint("fileID", file.ID).Int("chunks", len(chunks)).Msg("файл видалено")
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// deleteStoredChunks видаляє зі сховища повідомлення chunks, крім тих, на які
+// після дедуплікації посилаються інші файли. Помилки лише логуються: запис
+// у базі видаляється все одно, а повідомлення, що залишились, нікому не заважають
+func (a *API) deleteStoredChunks(fileID uint, chunks []db.Chunk) {
+	ids := make([]string, 0, len(chunks))
+	for _, chunk := range chunks {
+		ids = append(ids, chunk.TelegramFileID)
+		ids = append(ids, chunk.SubParts...)
+	}
+	shared, err := a.db.SharedStorageIDs(fileID, ids)
+	if err != nil {
+		// без цього не зрозуміло, що можна видаляти, тож нічого не видаляється
+		log.Err(err).Uint("fileID", fileID).Msg("помилка пошуку спільних chunks")
+		return
+	}
+
+	deleted := make(map[string]bool)
+	for _, chunk := range chunks {
+		a.uncache(chunk)
+		if chunk.TelegramFileID == "" || shared[chunk.TelegramFileID] {
+			continue
+		}
+		// частини chunk лежать в окремих повідомленнях, можливо, різних ботів
+		ids, messages := chunk.SubParts, chunk.SubPartMessages
+		if len(messages) == 0 {
+			ids, messages = []string{chunk.TelegramFileID}, []int{chunk.MessageID}
+		}
+		for i, messageID := range messages {
+			// chunks одного файлу теж можуть ділити повідомлення
+			if deleted[ids[i]] {
+				continue
+			}
+			deleted[ids[i]] = true
+			if err := storage.Delete(a.storage, ids[i], messageID); err != nil {
+				log.Warn().Err(err).
+					Uint("fileID", fileID).
+					Int("position", chunk.Position).
+					Int("messageID", messageID).
+					Msg("не вдалося видалити chunk зі сховища")
+			}
+		}
+	}
+}
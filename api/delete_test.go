@@ -0,0 +1,181 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestDeleteFile(t *testing.T) {
+	const chunkSize = 4096
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChunkSize = chunkSize
+		cfg.DedupChunks = true
+	})
+	shared := bytes.Repeat([]byte("s"), chunkSize)
+	own := bytes.Repeat([]byte("o"), chunkSize)
+
+	upload := func(name string, data []byte) uint {
+		t.Helper()
+		resp, err := a.app.Test(newUploadRequest(t, key, name, data), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 202 {
+			t.Fatalf("upload status = %d", resp.StatusCode)
+		}
+		files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if file.FileName == name {
+				waitForStatus(t, a, file.ID, "completed")
+				return file.ID
+			}
+		}
+		t.Fatalf("file %s not found", name)
+		return 0
+	}
+	remove := func(fileID uint, key string) int {
+		t.Helper()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/files/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	fileID := upload("a.bin", append(append([]byte(nil), shared...), own...))
+	// перший chunk другого файлу збігається з першим chunk першого
+	otherID := upload("b.bin", shared)
+
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil || len(chunks) != 2 {
+		t.Fatalf("chunks = %+v, err = %v", chunks, err)
+	}
+	if chunks[0].MessageID == 0 || chunks[1].MessageID == 0 {
+		t.Fatalf("message ids were not saved: %+v", chunks)
+	}
+
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := remove(fileID, otherKey); status != 403 {
+		t.Fatalf("delete with another key status = %d, want 403", status)
+	}
+	if status := remove(fileID, key); status != 204 {
+		t.Fatalf("delete status = %d, want 204", status)
+	}
+	if !slices.Equal(storage.deleted, []int{chunks[1].MessageID}) {
+		t.Fatalf("deleted messages %v, want only %d", storage.deleted, chunks[1].MessageID)
+	}
+
+	if _, err := a.db.GetFileByID(fileID); err == nil {
+		t.Fatal("file is still in the database")
+	}
+	if chunks, err := a.db.GetChunksByFileID(fileID); err != nil || len(chunks) != 0 {
+		t.Fatalf("chunks after delete = %+v, err = %v", chunks, err)
+	}
+	if status := remove(fileID, key); status != 404 {
+		t.Fatalf("second delete status = %d, want 404", status)
+	}
+
+	// файл, що ділив chunk з видаленим, усе ще завантажується
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", otherID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, shared) {
+		t.Fatalf("downloaded %d bytes, want the uploaded %d", len(body), len(shared))
+	}
+}
+
+func TestDeleteFileIfMatch(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "doc.txt", []byte("draft"))
+
+	etag := func() string {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Header.Get("ETag")
+	}
+	remove := func(ifMatch string) int {
+		t.Helper()
+		req := httptest.NewRequest("DELETE", fmt.Sprintf("/files/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	stale := etag()
+	if stale == "" {
+		t.Fatal("file details have no ETag")
+	}
+	// файл змінився після того, як клієнт отримав ETag
+	req := httptest.NewRequest("PATCH", fmt.Sprintf("/files/%d", fileID), strings.NewReader(`{"content_type":"text/plain"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	if resp, err := a.app.Test(req); err != nil || resp.StatusCode != 204 {
+		t.Fatalf("patch = %v, %v", resp, err)
+	}
+	current := etag()
+	if current == stale {
+		t.Fatal("ETag did not change after the file was updated")
+	}
+
+	if status := remove(stale); status != 412 {
+		t.Fatalf("delete with a stale ETag = %d, want 412", status)
+	}
+	if _, err := a.db.GetFileByID(fileID); err != nil {
+		t.Fatalf("file was deleted despite the stale ETag: %v", err)
+	}
+	if status := remove(`"other", ` + current); status != 204 {
+		t.Fatalf("delete with a matching ETag = %d, want 204", status)
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	file := db.File{Checksum: "abc123"}
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"abc123"`, true},
+		{"abc123", true},
+		{"*", true},
+		{`"old", "abc123"`, true},
+		{`W/"abc123"`, false},
+		{`"abc"`, false},
+	}
+	for _, tt := range tests {
+		if got := ifMatch(tt.header, file); got != tt.want {
+			t.Errorf("ifMatch(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
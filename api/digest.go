@@ -0,0 +1,28 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// checksumHeader - заголовок відповіді з SHA-256 усього файлу, щоб клієнт
+// міг сам перевірити завантажені дані
+const checksumHeader = "X-Checksum-SHA256"
+
+// handleGetFileChecksum повертає SHA-256 файлу, порахований при завантаженні
+func (a *API) handleGetFileChecksum(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+	if file.Checksum == "" {
+		return fiber.NewError(fiber.StatusNotFound, "checksum is not available for this file")
+	}
+	return c.JSON(FileChecksum{FileID: file.ID, Algorithm: "sha256", Checksum: file.Checksum})
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestUploadStoresFileChecksum(t *testing.T) {
+	const chunkSize = 1024
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChunkSize = chunkSize
+	})
+	data := make([]byte, 2*chunkSize)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "sum.bin", data), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	fileID := files[0].ID
+	waitForStatus(t, a, fileID, "completed")
+
+	get := func(url string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp = get(fmt.Sprintf("/files/%d/checksum", fileID))
+	var sum FileChecksum
+	if err := json.NewDecoder(resp.Body).Decode(&sum); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || sum.Algorithm != "sha256" || sum.Checksum != sha256Hex(data) {
+		t.Fatalf("status %d, checksum = %+v, want %s", resp.StatusCode, sum, sha256Hex(data))
+	}
+
+	resp = get(fmt.Sprintf("/download/%d", fileID))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || !bytes.Equal(body, data) {
+		t.Fatalf("download: %d bytes, err = %v", len(body), err)
+	}
+	if got := resp.Header.Get(checksumHeader); got != sha256Hex(data) {
+		t.Fatalf("%s = %q", checksumHeader, got)
+	}
+
+	// chunks міняються місцями: кожен цілий, але файл уже інший
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.mu.Lock()
+	storage.files[chunks[0].TelegramFileID], storage.files[chunks[1].TelegramFileID] =
+		storage.files[chunks[1].TelegramFileID], storage.files[chunks[0].TelegramFileID]
+	storage.mu.Unlock()
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	if resp, err := a.app.Test(req, -1); err == nil {
+		body, _ = io.ReadAll(resp.Body)
+		if len(body) >= len(data) {
+			t.Fatal("download of a reordered file was not cut short")
+		}
+	}
+}
+
+func TestFileChecksumMissing(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "old.bin", []byte("no checksum"))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/checksum", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 404 {
+		t.Fatalf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestDownloadDetectsCorruptedChunk(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	data := []byte("first chunk|second chunk")
+	fileID := storeFile(t, a, storage, key, "corrupt.txt", data[:12], data[12:])
+	if err := a.db.SetFileChecksum(fileID, sha256Hex(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk, err := a.db.GetChunk(fileID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// сховище тихо віддає інші байти того самого розміру
+	storage.mu.Lock()
+	storage.files[chunk.TelegramFileID][0] ^= 0xff
+	storage.mu.Unlock()
+
+	logs := captureLogs(t)
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req, -1)
+	if err == nil {
+		body, _ := io.ReadAll(resp.Body)
+		if len(body) >= len(data) {
+			t.Fatal("corrupted download was served in full")
+		}
+	}
+	if !strings.Contains(logs.String(), "checksum файлу не збігається") || !strings.Contains(logs.String(), sha256Hex(data)) {
+		t.Fatalf("no integrity alert logged: %s", logs)
+	}
+}
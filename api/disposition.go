@@ -0,0 +1,78 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+)
+
+// contentDisposition повертає Content-Disposition для віддачі файлу name.
+// Ім'я з не-ASCII символами кодується за RFC 5987 у filename*, а в filename
+// лишається його ASCII-версія для старих клієнтів. Ім'я, довше за limit
+// байтів у закодованому вигляді, обрізається (0 - без обмеження)
+func contentDisposition(name string, limit int) string {
+	name = truncateFilename(name, limit)
+	fallback := asciiFilename(name)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": fallback})
+	if fallback == name {
+		return disposition
+	}
+	return disposition + "; filename*=UTF-8''" + encodeRFC5987(name)
+}
+
+// asciiFilename замінює на "_" символи, які не можна передати в filename як є
+func asciiFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r >= 0x7f {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// encodeRFC5987 кодує рядок у percent-encoding з RFC 5987, лишаючи attr-char як є
+func encodeRFC5987(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func isAttrChar(c byte) bool {
+	switch {
+	case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// truncateFilename обрізає ім'я по символах так, щоб закодоване воно
+// займало не більше limit байтів. Розширення, якщо воно коротке, зберігається
+func truncateFilename(name string, limit int) string {
+	if limit <= 0 || len(encodeRFC5987(name)) <= limit {
+		return name
+	}
+
+	ext := path.Ext(name)
+	if len(encodeRFC5987(ext)) > limit/2 {
+		ext = ""
+	}
+	budget := limit - len(encodeRFC5987(ext))
+	var stem strings.Builder
+	for _, r := range strings.TrimSuffix(name, ext) {
+		encoded := len(encodeRFC5987(string(r)))
+		if encoded > budget {
+			break
+		}
+		budget -= encoded
+		stem.WriteRune(r)
+	}
+	return stem.String() + ext
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{"hello.txt", 0, "attachment; filename=hello.txt"},
+		{"my report.pdf", 0, `attachment; filename="my report.pdf"`},
+		{"звіт.pdf", 0, `attachment; filename=____.pdf; filename*=UTF-8''%D0%B7%D0%B2%D1%96%D1%82.pdf`},
+		{"a\r\nb", 0, `attachment; filename=a__b; filename*=UTF-8''a%0D%0Ab`},
+		// кожна кирилична літера - 6 байтів закодованою, тож влазять дві і розширення
+		{"звіт.pdf", 16, `attachment; filename=__.pdf; filename*=UTF-8''%D0%B7%D0%B2.pdf`},
+		{"abcdefghij.txt", 8, "attachment; filename=abcd.txt"},
+	}
+	for _, tt := range tests {
+		if got := contentDisposition(tt.name, tt.limit); got != tt.want {
+			t.Errorf("contentDisposition(%q, %d) = %q, want %q", tt.name, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadUnicodeFilename(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "Фото з відпустки.jpg", []byte("jpeg"))
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := resp.Header.Get("Content-Disposition")
+	want := `attachment; filename="____ _ _________.jpg"; ` +
+		`filename*=UTF-8''%D0%A4%D0%BE%D1%82%D0%BE%20%D0%B7%20%D0%B2%D1%96%D0%B4%D0%BF%D1%83%D1%81%D1%82%D0%BA%D0%B8.jpg`
+	if header != want {
+		t.Fatalf("Content-Disposition = %q, want %q", header, want)
+	}
+	// mime декодує filename* і віддає його замість ASCII-версії
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil || params["filename"] != "Фото з відпустки.jpg" {
+		t.Fatalf("parsed filename = %q, err = %v", params["filename"], err)
+	}
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+var errNoStorageKey = errors.New("chunk is encrypted, but STORAGE_KEY is not set")
+
+// newChunkCipher створює AES-256-GCM для шифрування chunks, nil - без ключа
+func newChunkCipher(key []byte) cipher.AEAD {
+	if len(key) == 0 {
+		return nil
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		// довжину ключа перевіряє config.Load
+		panic(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		panic(err)
+	}
+	return aead
+}
+
+// encryptChunk шифрує дані chunk, якщо задано STORAGE_KEY. Nonce кожного
+// chunk випадковий і зберігається в його записі, без нього дані не розшифрувати
+func (a *API) encryptChunk(chunk *db.Chunk) error {
+	if a.aead == nil {
+		return nil
+	}
+	nonce := make([]byte, a.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	chunk.Data = a.aead.Seal(nil, nonce, chunk.Data, nil)
+	chunk.Nonce = nonce
+	return nil
+}
+
+// decryptChunk розшифровує дані chunk зі сховища, якщо chunk зашифрований
+func (a *API) decryptChunk(chunk db.Chunk, data []byte) ([]byte, error) {
+	if len(chunk.Nonce) == 0 {
+		return data, nil
+	}
+	if a.aead == nil {
+		return nil, errNoStorageKey
+	}
+	return a.aead.Open(nil, chunk.Nonce, data, nil)
+}
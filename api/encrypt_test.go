@@ -0,0 +1,63 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestEncryptedChunkRoundTrip(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.StorageKey = bytes.Repeat([]byte{7}, 32)
+		cfg.CompressChunks = true
+	})
+
+	data := bytes.Repeat([]byte("secret data "), 100)
+	fileID, err := a.db.CreateNewFile("secret.txt", int64(len(data)), db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: int64(len(data)), Data: append([]byte(nil), data...)})
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored := storage.files[chunk.TelegramFileID]
+	if chunk.Status != "completed" || len(chunk.Nonce) != a.aead.NonceSize() || bytes.Contains(stored, []byte("secret")) {
+		t.Fatalf("chunk = %+v, stored %q", chunk, stored)
+	}
+	if chunk.StoredSize != int64(len(stored)) {
+		t.Fatalf("stored size = %d, want %d", chunk.StoredSize, len(stored))
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("downloaded data differs from uploaded")
+	}
+
+	// без ключа чи з іншим ключем дані не розшифрувати
+	a.aead = nil
+	if _, err := a.loadChunk(chunk); !errors.Is(err, errNoStorageKey) {
+		t.Fatalf("load without key err = %v", err)
+	}
+	a.aead = newChunkCipher(bytes.Repeat([]byte{8}, 32))
+	if _, err := a.loadChunk(chunk); err == nil {
+		t.Fatal("chunk decrypted with a wrong key")
+	}
+}
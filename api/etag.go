@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// fileETag повертає ETag файлу: його checksum, якщо він відомий, інакше
+// версію з часу останньої зміни запису, яка змінюється разом з файлом
+func fileETag(file db.File) string {
+	if file.Checksum != "" {
+		return `"` + file.Checksum + `"`
+	}
+	return fmt.Sprintf(`"%d-%x"`, file.ID, file.UpdatedAt.UnixNano())
+}
+
+// ifMatch перевіряє заголовок If-Match (список ETag через кому або "*") для
+// файлу. ETag можна передати і без лапок, наприклад просто checksum файлу
+func ifMatch(header string, file db.File) bool {
+	etag := fileETag(file)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		// слабкі ETag для If-Match не підходять (RFC 9110, 13.1.1)
+		if strings.HasPrefix(candidate, "W/") {
+			continue
+		}
+		if !strings.HasPrefix(candidate, `"`) {
+			candidate = `"` + candidate + `"`
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// handleExport віддає кілька файлів одним zip архівом.
+// Chunks завантажуються зі сховища паралельно (до ExportConcurrency одночасно),
+// а в архів пишуться по черзі, бо zip пишеться послідовно
+func (a *API) handleExport(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	var files []db.File
+	for _, rawID := range strings.Split(c.Query("ids"), ",") {
+		fileID, err := strconv.ParseUint(strings.TrimSpace(rawID), 10, 64)
+		if err != nil || fileID == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid file ids")
+		}
+
+		file, err := a.db.GetFileByID(uint(fileID))
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("file %d not found", fileID))
+		}
+		if err != nil {
+			log.Err(err).Msg("помилка отримання фалу з бази")
+			return fiber.NewError(fiber.StatusInternalServerError, "failed to get file")
+		}
+		if file.OwnerAPIKey != key {
+			return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("file %d belongs to another key", fileID))
+		}
+		files = append(files, file)
+	}
+
+	c.Set("Content-Type", "application/zip")
+	c.Set("Content-Disposition", "attachment; filename=export.zip")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		if err := a.writeExport(w, files); err != nil {
+			log.Err(err).Msg("помилка експорту файлів")
+		}
+	})
+	return nil
+}
+
+// exportPart - chunk файлу архіву
+type exportPart struct {
+	file   int // індекс у files
+	chunk  db.Chunk
+	chunks []db.Chunk
+	parity *db.Chunk
+}
+
+// writeExport пише files в архів, передаючи дані chunk за chunk: у пам'яті
+// одночасно не більше ExportConcurrency chunks, хоч би якими великими були файли
+func (a *API) writeExport(w *bufio.Writer, files []db.File) error {
+	var parts []exportPart
+	for i, file := range files {
+		all, err := a.db.GetChunksByFileID(file.ID)
+		if err != nil {
+			return fmt.Errorf("файл %d: %w", file.ID, err)
+		}
+		chunks, parity := splitParity(all)
+		if len(chunks) != file.TotalChunks {
+			return fmt.Errorf("файл %d: кількість чанків не збігаєтся", file.ID)
+		}
+		for _, chunk := range chunks {
+			parts = append(parts, exportPart{file: i, chunk: chunk, chunks: chunks, parity: parity})
+		}
+	}
+
+	// chunks наступного файлу завантажуються, поки пишеться попередній
+	done := make(chan struct{})
+	defer close(done)
+	next := prefetch(len(parts), a.config.ExportConcurrency, func(i int) ([]byte, error) {
+		part := parts[i]
+		return a.fetchChunk(files[part.file].ID, part.chunk, part.chunks, part.parity)
+	}, done)
+
+	archive := zip.NewWriter(w)
+	names := make(map[string]bool)
+	part := 0
+	for i, file := range files {
+		entry, err := archive.Create(exportEntryName(file, names))
+		if err != nil {
+			return err
+		}
+		for ; part < len(parts) && parts[part].file == i; part++ {
+			res := next()
+			if res.err != nil {
+				return fmt.Errorf("файл %d: %w", file.ID, res.err)
+			}
+			if _, err := entry.Write(res.data); err != nil {
+				return err
+			}
+		}
+	}
+	return archive.Close()
+}
+
+// exportEntryName повертає ім'я файлу в архіві. Імена від клієнта не
+// перевіряються при завантаженні, тож роздільники шляху замінюються, щоб
+// запис на кшталт ../../.bashrc не розпакувався поза каталогом (zip slip).
+// Повтори імен і порожні імена отримують id файлу
+func exportEntryName(file db.File, used map[string]bool) string {
+	name := sanitizeFilename(file.FileName)
+	if name == "" {
+		name = fmt.Sprintf("file-%d", file.ID)
+	} else if used[name] {
+		name = fmt.Sprintf("%d-%s", file.ID, name)
+	}
+	used[name] = true
+	return name
+}
+
+// readFile завантажує всі chunks файлу зі сховища і склеює їх
+func (a *API) readFile(file db.File) ([]byte, error) {
+	all, err := a.db.GetChunksByFileID(file.ID)
+	if err != nil {
+		return nil, err
+	}
+	chunks, _ := splitParity(all)
+	if len(chunks) != file.TotalChunks {
+		return nil, fmt.Errorf("кількість чанків не збігаєтся")
+	}
+
+	data := make([]byte, 0, file.Size)
+	for _, chunk := range chunks {
+		rawData, err := a.loadChunk(chunk)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, rawData...)
+	}
+	return data, nil
+}
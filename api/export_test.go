@@ -0,0 +1,141 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func exportURL(ids []uint) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return "/export?ids=" + strings.Join(parts, ",")
+}
+
+func TestExport(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	a.config.ExportConcurrency = 2
+	ids := []uint{
+		storeFile(t, a, storage, key, "a.txt", []byte("alpha")),
+		storeFile(t, a, storage, key, "b.txt", []byte("be"), []byte("ta")),
+		storeFile(t, a, storage, key, "c.txt", []byte("gamma")),
+	}
+
+	req := httptest.NewRequest("GET", exportURL(ids), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"a.txt:alpha", "b.txt:beta", "c.txt:gamma"}
+	if len(archive.File) != len(want) {
+		t.Fatalf("archive has %d entries", len(archive.File))
+	}
+	for i, entry := range archive.File {
+		r, err := entry.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(r)
+		if got := entry.Name + ":" + string(data); got != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, got, want[i])
+		}
+	}
+}
+
+func TestExportSanitizesEntryNames(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	ids := []uint{
+		storeFile(t, a, storage, key, "../../.bashrc", []byte("evil")),
+		storeFile(t, a, storage, key, `dir\report.txt`, []byte("one")),
+		storeFile(t, a, storage, key, "dir/report.txt", []byte("two")),
+	}
+
+	req := httptest.NewRequest("GET", exportURL(ids), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{".._.._.bashrc", "dir_report.txt", fmt.Sprintf("%d-dir_report.txt", ids[2])}
+	if len(archive.File) != len(want) {
+		t.Fatalf("archive has %d entries", len(archive.File))
+	}
+	for i, entry := range archive.File {
+		if entry.Name != want[i] {
+			t.Errorf("entry %d = %q, want %q", i, entry.Name, want[i])
+		}
+	}
+}
+
+func TestExportRejectsForeignFile(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []uint{
+		storeFile(t, a, storage, key, "mine.txt", []byte("mine")),
+		storeFile(t, a, storage, otherKey, "theirs.txt", []byte("theirs")),
+	}
+
+	req := httptest.NewRequest("GET", exportURL(ids), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 403 {
+		t.Fatalf("status = %d, want 403", resp.StatusCode)
+	}
+}
+
+func benchmarkExport(b *testing.B, concurrency int) {
+	a, storage, key := newTestAPI(b)
+	a.config.ExportConcurrency = concurrency
+	storage.delay = 5 * time.Millisecond
+
+	var ids []uint
+	for i := range 8 {
+		ids = append(ids, storeFile(b, a, storage, key, fmt.Sprintf("%d.bin", i), make([]byte, 1024), make([]byte, 1024)))
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		req := httptest.NewRequest("GET", exportURL(ids), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+	}
+}
+
+func BenchmarkExportSequential(b *testing.B) { benchmarkExport(b, 1) }
+func BenchmarkExportParallel(b *testing.B)   { benchmarkExport(b, 4) }
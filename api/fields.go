@@ -0,0 +1,73 @@
+package api
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+)
+
+// listField - поле, яке можна вибрати в ?fields= списку файлів
+type listField struct {
+	column string // колонка files, порожня - мітки
+	value  func(db.File) any
+}
+
+// listFields - дозволені значення ?fields=, лише вони потрапляють у Select
+var listFields = map[string]listField{
+	"id":           {"id", func(f db.File) any { return f.ID }},
+	"filename":     {"file_name", func(f db.File) any { return f.FileName }},
+	"size":         {"size", func(f db.File) any { return f.Size }},
+	"total_chunks": {"total_chunks", func(f db.File) any { return f.TotalChunks }},
+	"content_type": {"content_type", func(f db.File) any { return f.ContentType }},
+	"checksum":     {"checksum", func(f db.File) any { return f.Checksum }},
+	"status":       {"status", func(f db.File) any { return f.Status }},
+	"created_at":   {"created_at", func(f db.File) any { return f.CreatedAt }},
+	"updated_at":   {"updated_at", func(f db.File) any { return f.UpdatedAt }},
+	"tags":         {"", func(f db.File) any { return f.Tags }},
+}
+
+// parseFields розбирає ?fields=id,filename у список полів і заповнює
+// колонки вибірки в filter. Порожній параметр - повні записи (nil)
+func parseFields(raw string, filter *db.FileFilter) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	filter.SkipTags = true
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		field, ok := listFields[name]
+		if !ok {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "unknown field: "+name)
+		}
+		if slices.Contains(fields, name) {
+			continue
+		}
+		fields = append(fields, name)
+		if field.column == "" {
+			filter.SkipTags = false
+		} else {
+			filter.Columns = append(filter.Columns, field.column)
+		}
+	}
+	if len(filter.Columns) == 0 {
+		// вибрано лише мітки, з самих файлів досить id
+		filter.Columns = []string{"id"}
+	}
+	return fields, nil
+}
+
+// projectFile лишає у файлі тільки вибрані поля, nil - весь файл
+func projectFile(file db.File, fields []string) any {
+	if fields == nil {
+		return file
+	}
+	projected := make(fiber.Map, len(fields))
+	for _, name := range fields {
+		projected[name] = listFields[name].value(file)
+	}
+	return projected
+}
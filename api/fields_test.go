@@ -0,0 +1,67 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"maps"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+func TestListFilesFields(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "report.pdf", []byte("pdf"))
+
+	get := func(query string) (int, []byte) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/files"+query, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, data
+	}
+
+	_, data := get("?fields=id,filename")
+	var body struct {
+		Files []map[string]any `json:"files"`
+	}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatal(err)
+	}
+	if len(body.Files) != 1 {
+		t.Fatalf("files = %v", body.Files)
+	}
+	file := body.Files[0]
+	if keys := slices.Sorted(maps.Keys(file)); !slices.Equal(keys, []string{"filename", "id"}) {
+		t.Fatalf("keys = %v, want only id and filename", keys)
+	}
+	if file["id"] != float64(fileID) || file["filename"] != "report.pdf" {
+		t.Fatalf("file = %v", file)
+	}
+
+	// NDJSON віддає ті самі поля
+	_, data = get("?fields=size&format=ndjson")
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var line map[string]any
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatal(err)
+		}
+		if len(line) != 1 || line["size"] != float64(3) {
+			t.Fatalf("ndjson line = %v, want only size", line)
+		}
+	}
+
+	if status, _ := get("?fields=id,owner_api_key"); status != 400 {
+		t.Fatalf("unknown field status = %d, want 400", status)
+	}
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// handleHealth перевіряє з'єднання з базою і доступність сховища для
+// балансувальника: 200, якщо обидва працюють, інакше 503. Текст помилок
+// лише в лозі, бо помилка Telegram може містити токен бота
+func (a *API) handleHealth(c *fiber.Ctx) error {
+	health := Health{DB: healthOK, Storage: healthOK}
+	status := fiber.StatusOK
+	if err := a.db.Ping(); err != nil {
+		log.Err(err).Msg("база недоступна")
+		health.DB = healthUnavailable
+		status = fiber.StatusServiceUnavailable
+	}
+	if err := storage.Ping(a.storage); err != nil {
+		log.Err(err).Msg("сховище недоступне")
+		health.Storage = healthUnavailable
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(health)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/storage"
+)
+
+func TestHealth(t *testing.T) {
+	check := func(t *testing.T, a *API, wantStatus int, want Health) {
+		t.Helper()
+		resp, err := a.app.Test(httptest.NewRequest("GET", "/health", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var health Health
+		if err := json.NewDecoder(resp.Body).Decode(&health); err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != wantStatus || health != want {
+			t.Fatalf("health = %d %+v, want %d %+v", resp.StatusCode, health, wantStatus, want)
+		}
+	}
+
+	t.Run("healthy", func(t *testing.T) {
+		a, _, _ := newTestAPI(t)
+		check(t, a, 200, Health{DB: "ok", Storage: "ok"})
+	})
+
+	t.Run("db down", func(t *testing.T) {
+		a, _, _ := newTestAPI(t)
+		sqlDB, err := a.db.DB.DB()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sqlDB.Close()
+		check(t, a, 503, Health{DB: "unavailable", Storage: "ok"})
+	})
+
+	t.Run("storage down", func(t *testing.T) {
+		a, fake, _ := newTestAPI(t)
+		a.storage = &pingStorage{fakeStorage: fake, pingErr: errors.New("telegram is unreachable")}
+		check(t, a, 503, Health{DB: "ok", Storage: "unavailable"})
+	})
+
+	t.Run("storage down behind the limiter", func(t *testing.T) {
+		a, fake, _ := newTestAPI(t, func(cfg *config.Config) { cfg.StorageConcurrency = 8 })
+		a.storage = storage.Limit(&pingStorage{fakeStorage: fake, pingErr: errors.New("telegram is unreachable")}, a.config.StorageConcurrency)
+		check(t, a, 503, Health{DB: "ok", Storage: "unavailable"})
+	})
+}
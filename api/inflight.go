@@ -0,0 +1,141 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog/log"
+)
+
+// webhookTimeout - найдовше очікування відповіді webhook
+const webhookTimeout = 10 * time.Second
+
+// inflightUploads - запити завантаження, що зараз виконуються, з часом їх початку
+type inflightUploads struct {
+	mu      sync.Mutex
+	next    uint64
+	uploads map[uint64]*inflightUpload
+}
+
+type inflightUpload struct {
+	key     string
+	path    string
+	started time.Time
+	alerted bool // webhook уже викликано, вдруге не викликається
+}
+
+// begin реєструє завантаження і повертає функцію, яка знімає його з обліку
+func (u *inflightUploads) begin(key, path string, now time.Time) func() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.uploads == nil {
+		u.uploads = make(map[uint64]*inflightUpload)
+	}
+	u.next++
+	id := u.next
+	u.uploads[id] = &inflightUpload{key: key, path: path, started: now}
+	return func() {
+		u.mu.Lock()
+		delete(u.uploads, id)
+		u.mu.Unlock()
+	}
+}
+
+// longest повертає, скільки триває найдовше з поточних завантажень
+func (u *inflightUploads) longest(now time.Time) time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var longest time.Duration
+	for _, upload := range u.uploads {
+		longest = max(longest, now.Sub(upload.started))
+	}
+	return longest
+}
+
+// slow повертає ще не оброблені завантаження, що тривають довше за after,
+// і позначає їх, щоб про кожне сповіщати лише раз
+func (u *inflightUploads) slow(now time.Time, after time.Duration) []inflightUpload {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	var slow []inflightUpload
+	for _, upload := range u.uploads {
+		if !upload.alerted && now.Sub(upload.started) > after {
+			upload.alerted = true
+			slow = append(slow, *upload)
+		}
+	}
+	return slow
+}
+
+// trackUpload рахує запит завантаження серед поточних, поки він виконується
+func (a *API) trackUpload(c *fiber.Ctx) error {
+	// ключ ще не перевірено, тому зберігається лише відбиток, той самий, що в метриках
+	done := a.uploads.begin(keyFingerprint(db.HashKey(requestAPIKey(c))), c.Path(), a.clock.Now())
+	defer done()
+	return c.Next()
+}
+
+// registerUploadMetrics додає до /metrics тривалість найдовшого поточного завантаження
+func (a *API) registerUploadMetrics() {
+	a.metrics.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "infinity_storage_longest_upload_seconds",
+		Help: "Duration of the longest upload request still in progress.",
+	}, func() float64 {
+		return a.uploads.longest(a.clock.Now()).Seconds()
+	}))
+}
+
+// checkSlowUploads сповіщає про завантаження, що тривають довше за SLOW_UPLOAD_AFTER:
+// клієнт міг зависнути, тримаючи з'єднання
+func (a *API) checkSlowUploads() error {
+	now := a.clock.Now()
+	for _, upload := range a.uploads.slow(now, a.config.SlowUploadAfter) {
+		alert := SlowUploadAlert{
+			Key:             upload.key,
+			Path:            upload.path,
+			StartedAt:       upload.started,
+			DurationSeconds: now.Sub(upload.started).Seconds(),
+		}
+		log.Warn().
+			Str("key", alert.Key).
+			Str("path", alert.Path).
+			Time("started", alert.StartedAt).
+			Msg("завантаження триває надто довго")
+
+		if a.config.SlowUploadWebhook == "" {
+			continue
+		}
+		if err := postWebhook(a.config.SlowUploadWebhook, alert); err != nil {
+			log.Err(err).Msg("помилка виклику webhook про довге завантаження")
+		}
+	}
+	return nil
+}
+
+// postWebhook надсилає payload як JSON і чекає на успішну відповідь
+func postWebhook(url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	client := http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook відповів %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// blockingStorage тримає потокову відправку, поки тест її не відпустить,
+// щоб запит завантаження лишався незавершеним
+type blockingStorage struct {
+	*fakeStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStorage) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	s.started <- struct{}{}
+	<-s.release
+	return s.fakeStorage.SendFileStream(fileName, r, size)
+}
+
+func TestSlowUploadMetricAndWebhook(t *testing.T) {
+	alerts := make(chan SlowUploadAlert, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert SlowUploadAlert
+		json.NewDecoder(r.Body).Decode(&alert)
+		alerts <- alert
+	}))
+	defer hook.Close()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &blockingStorage{fakeStorage: newFakeStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	cfg := config.Config{
+		StreamUploads:     true,
+		KeyMetrics:        true,
+		AdminToken:        "admin",
+		SlowUploadAfter:   10 * time.Minute,
+		SlowUploadWebhook: hook.URL,
+	}
+	a := newAPI(cfg, storage, database, clock.NewFake(time.Now()), nil)
+	defer a.Stop(context.Background())
+	fake := a.clock.(*clock.Fake)
+
+	done := make(chan int)
+	go func() {
+		resp, err := a.app.Test(newUploadRequest(t, key, "slow.bin", []byte("slow")), -1)
+		if err != nil {
+			done <- 0
+			return
+		}
+		done <- resp.StatusCode
+	}()
+	<-storage.started
+
+	fake.Advance(5 * time.Minute)
+	if out := scrapeMetrics(t, a); !strings.Contains(out, "infinity_storage_longest_upload_seconds 300") {
+		t.Fatalf("metrics do not show a 5 minute upload:\n%s", out)
+	}
+	if err := a.checkSlowUploads(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case alert := <-alerts:
+		t.Fatalf("webhook called before the threshold: %+v", alert)
+	default:
+	}
+
+	fake.Advance(6 * time.Minute)
+	if err := a.checkSlowUploads(); err != nil {
+		t.Fatal(err)
+	}
+	alert := <-alerts
+	if alert.Path != "/upload" || alert.Key != keyFingerprint(db.HashKey(key)) || alert.DurationSeconds != 660 {
+		t.Fatalf("alert = %+v", alert)
+	}
+
+	// про одне завантаження сповіщається лише раз
+	fake.Advance(time.Minute)
+	if err := a.checkSlowUploads(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case alert := <-alerts:
+		t.Fatalf("second webhook call: %+v", alert)
+	default:
+	}
+
+	close(storage.release)
+	if status := <-done; status != 202 {
+		t.Fatalf("upload status = %d", status)
+	}
+	if out := scrapeMetrics(t, a); !strings.Contains(out, "infinity_storage_longest_upload_seconds 0") {
+		t.Fatalf("finished upload still counted:\n%s", out)
+	}
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"slices"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/rs/zerolog/log"
+)
+
+// checkPositions перевіряє, що positions - це рівно 1..total без повторів,
+// і повертає відсутні позиції та зайві (поза діапазоном або повторені)
+func checkPositions(positions []int, total int) (missing, extra []int) {
+	seen := make(map[int]bool, len(positions))
+	for _, position := range positions {
+		if position < 1 || position > total || seen[position] {
+			extra = append(extra, position)
+			continue
+		}
+		seen[position] = true
+	}
+	for position := 1; position <= total; position++ {
+		if !seen[position] {
+			missing = append(missing, position)
+		}
+	}
+	slices.Sort(extra)
+	return missing, extra
+}
+
+// checkChunkOrder позначає файл failed і повертає відсутні та зайві позиції,
+// якщо chunks не збігаються з TotalChunks, інакше nil
+func (a *API) checkChunkOrder(fileID uint, positions []int, total int) *ChunkOrderError {
+	if !a.config.VerifyChunkOrder {
+		return nil
+	}
+	missing, extra := checkPositions(positions, total)
+	if len(missing) == 0 && len(extra) == 0 {
+		return nil
+	}
+
+	log.Error().
+		Uint("fileID", fileID).
+		Ints("missing", missing).
+		Ints("extra", extra).
+		Msg("позиції chunks не збігаються з кількістю chunks")
+	a.failFile(fileID)
+	return &ChunkOrderError{
+		Error:   "chunk positions do not match total chunks",
+		Missing: missing,
+		Extra:   extra,
+	}
+}
+
+// checkStoredChunkOrder - checkChunkOrder для chunks файлу, збережених у базі.
+// Chunks з черги в пам'яті записуються, лише коли їх відправлено, тож поки
+// рядків менше за total, відсутні позиції ще можуть з'явитись: тоді файл
+// перевіряється пізніше, коли стане completed
+func (a *API) checkStoredChunkOrder(fileID uint, total int) (*ChunkOrderError, error) {
+	if !a.config.VerifyChunkOrder {
+		return nil, nil
+	}
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		return nil, err
+	}
+	positions := chunkPositions(chunks)
+	if len(positions) < total {
+		return nil, nil
+	}
+	return a.checkChunkOrder(fileID, positions, total), nil
+}
+
+// chunkPositions повертає позиції chunks з даними
+func chunkPositions(chunks []db.Chunk) []int {
+	positions := make([]int, 0, len(chunks))
+	for _, chunk := range chunks {
+		if !chunk.Parity {
+			positions = append(positions, chunk.Position)
+		}
+	}
+	return positions
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestCheckPositions(t *testing.T) {
+	tests := []struct {
+		name      string
+		positions []int
+		total     int
+		missing   []int
+		extra     []int
+	}{
+		{"exact", []int{3, 1, 2}, 3, nil, nil},
+		{"under-counted", []int{1, 3}, 3, []int{2}, nil},
+		{"over-counted", []int{1, 2, 3, 4}, 3, nil, []int{4}},
+		{"duplicate", []int{1, 2, 2}, 2, nil, []int{2}},
+		{"zero position", []int{0, 1}, 2, []int{2}, []int{0}},
+		{"empty file", nil, 0, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, extra := checkPositions(tt.positions, tt.total)
+			if !slices.Equal(missing, tt.missing) || !slices.Equal(extra, tt.extra) {
+				t.Fatalf("missing %v, extra %v; want %v, %v", missing, extra, tt.missing, tt.extra)
+			}
+		})
+	}
+}
+
+// completeWithMismatch завершує chunked завантаження, після того як corrupt
+// зіпсував chunks у базі, і повертає відповідь та стан файлу
+func completeWithMismatch(t *testing.T, corrupt func(a *API, fileID uint)) (int, ChunkOrderError, db.File) {
+	t.Helper()
+
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.VerifyChunkOrder = true
+	})
+	first, second := []byte("hello "), []byte("world")
+	fileID := createUpload(t, a, key, first, second)
+	corrupt(a, fileID)
+
+	if status := putChunk(t, a, key, fileID, 1, first, ""); status != 202 {
+		t.Fatalf("chunk 1 status = %d, want 202", status)
+	}
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/uploads/%d/chunks/2", fileID), bytes.NewReader(second))
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mismatch ChunkOrderError
+	if resp.StatusCode == 500 {
+		if err := json.NewDecoder(resp.Body).Decode(&mismatch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, mismatch, file
+}
+
+func TestChunkOrderOverCounted(t *testing.T) {
+	status, mismatch, file := completeWithMismatch(t, func(a *API, fileID uint) {
+		stray := &db.Chunk{FileID: fileID, Position: 3, Status: "completed"}
+		if err := a.db.AddChunkToFile(stray); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if status != 500 || !slices.Equal(mismatch.Extra, []int{3}) || len(mismatch.Missing) != 0 {
+		t.Fatalf("status %d, mismatch %+v", status, mismatch)
+	}
+	if file.Status != "failed" {
+		t.Fatalf("file status = %q, want failed", file.Status)
+	}
+}
+
+func TestChunkOrderUnderCounted(t *testing.T) {
+	status, mismatch, file := completeWithMismatch(t, func(a *API, fileID uint) {
+		if err := a.db.DB.Model(&db.File{}).Where("id = ?", fileID).Update("total_chunks", 3).Error; err != nil {
+			t.Fatal(err)
+		}
+	})
+	if status != 500 || !slices.Equal(mismatch.Missing, []int{3}) || len(mismatch.Extra) != 0 {
+		t.Fatalf("status %d, mismatch %+v", status, mismatch)
+	}
+	if file.Status != "failed" {
+		t.Fatalf("file status = %q, want failed", file.Status)
+	}
+}
+
+func TestMultipartUploadChunkOrder(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		t.Run(fmt.Sprintf("streaming %v", streaming), func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.VerifyChunkOrder = true
+				cfg.StreamUploads = streaming
+			})
+			// рядок, що лишився від іншого запису з тим самим id: у файлу
+			// стане два chunks з позицією 1
+			const fileID = 1
+			stray := &db.Chunk{FileID: fileID, Position: 1, Status: "completed"}
+			if err := a.db.AddChunkToFile(stray); err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := a.app.Test(newUploadRequest(t, key, "a.txt", []byte("data")), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != 1 || files[0].ID != fileID {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+
+			if streaming {
+				// chunks уже в базі до відповіді, тож клієнт дізнається одразу
+				var mismatch ChunkOrderError
+				if err := json.NewDecoder(resp.Body).Decode(&mismatch); err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != 500 || !slices.Equal(mismatch.Extra, []int{1}) {
+					t.Fatalf("status %d, mismatch %+v", resp.StatusCode, mismatch)
+				}
+			} else if resp.StatusCode != 202 {
+				t.Fatalf("status = %d, want 202", resp.StatusCode)
+			}
+			// з черги в пам'яті повтор видно, лише коли файл міг би стати completed
+			waitForStatus(t, a, fileID, "failed")
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"github.com/rs/zerolog/log"
+)
+
+// sweepStaleUploads позначає failed завантаження, які давно не оновлювались
+func (a *API) sweepStaleUploads() error {
+	count, err := a.db.MarkStaleUploadsFailed(a.clock.Now().Add(-a.config.StaleUploadAfter))
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Info().Int64("files", count).Msg("завислі завантаження позначено як failed")
+	}
+	return nil
+}
+
+// purgeDeletedFiles остаточно видаляє файли, видалені більше ніж PurgeDeletedAfter
+// тому: спершу повідомлення з їх chunks у сховищі, як DELETE /files, потім
+// записи з бази. Файли прибираються по одному, щоб chunk, спільний для кількох
+// видалених файлів, видалився разом з останнім з них
+func (a *API) purgeDeletedFiles() error {
+	ids, err := a.db.DeletedOlderThan(a.clock.Now(), a.config.PurgeDeletedAfter)
+	if err != nil {
+		return err
+	}
+	for _, fileID := range ids {
+		chunks, err := a.db.GetChunksByFileID(fileID)
+		if err != nil {
+			return err
+		}
+		a.deleteStoredChunks(fileID, chunks)
+		if err := a.db.PurgeFile(fileID); err != nil {
+			return err
+		}
+	}
+	if len(ids) > 0 {
+		log.Info().Int("files", len(ids)).Msg("видалені файли очищено з бази і сховища")
+	}
+	return nil
+}
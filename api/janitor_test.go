@@ -0,0 +1,136 @@
+package api
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestSweepStaleUploads(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	fake := a.clock.(*clock.Fake)
+	a.config.StaleUploadAfter = 24 * time.Hour
+
+	fileID, err := a.db.CreateNewFile("", 0, db.HashKey(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.Advance(23 * time.Hour)
+	if err := a.sweepStaleUploads(); err != nil {
+		t.Fatal(err)
+	}
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != "uploading" {
+		t.Fatalf("status after 23h = %q, want uploading", file.Status)
+	}
+
+	fake.Advance(2 * time.Hour)
+	if err := a.sweepStaleUploads(); err != nil {
+		t.Fatal(err)
+	}
+	file, err = a.db.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != "failed" {
+		t.Fatalf("status after 25h = %q, want failed", file.Status)
+	}
+}
+
+func TestPurgeDeletedFiles(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fake := a.clock.(*clock.Fake)
+	a.config.PurgeDeletedAfter = 30 * 24 * time.Hour
+
+	fileID := storeFile(t, a, storage, key, "old.txt", []byte("data"))
+	if err := a.db.DB.Delete(&db.File{}, fileID).Error; err != nil {
+		t.Fatal(err)
+	}
+	purged := func() bool {
+		t.Helper()
+		var count int64
+		if err := a.db.DB.Unscoped().Model(&db.File{}).Where("id = ?", fileID).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count == 0
+	}
+
+	fake.Advance(29 * 24 * time.Hour)
+	if err := a.purgeDeletedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if purged() {
+		t.Fatal("file purged before PURGE_DELETED_AFTER")
+	}
+
+	fake.Advance(2 * 24 * time.Hour)
+	if err := a.purgeDeletedFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if !purged() {
+		t.Fatal("file not purged after PURGE_DELETED_AFTER")
+	}
+}
+
+func TestPurgeDeletesStoredChunks(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AdminToken = "secret"
+		cfg.KeyDeletionPolicy = config.KeyDeletionCascade
+		cfg.ChunkSize = 4096
+	})
+	fake := a.clock.(*clock.Fake)
+	a.config.PurgeDeletedAfter = time.Hour
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "a.bin", bytes.Repeat([]byte("r"), 2*4096+1)), -1)
+	if err != nil || resp.StatusCode != 202 {
+		t.Fatalf("upload: resp = %v, err = %v", resp, err)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	waitForStatus(t, a, files[0].ID, "completed")
+	chunks, err := a.db.GetChunksByFileID(files[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var messages []int
+	for _, chunk := range chunks {
+		messages = append(messages, chunk.MessageID)
+	}
+	if len(messages) != 3 {
+		t.Fatalf("stored %d chunks, want 3", len(messages))
+	}
+
+	req := httptest.NewRequest("DELETE", "/admin/keys/"+db.HashKey(key), nil)
+	req.Header.Set("X-Admin-Token", "secret")
+	if resp, err = a.app.Test(req); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("revoke: resp = %v, err = %v", resp, err)
+	}
+
+	fake.Advance(2 * time.Hour)
+	if err := a.purgeDeletedFiles(); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	slices.Sort(messages)
+	deleted := slices.Sorted(slices.Values(storage.deleted))
+	if !slices.Equal(deleted, messages) {
+		t.Fatalf("deleted messages %v, want %v", deleted, messages)
+	}
+	if len(storage.files) != 0 {
+		t.Fatalf("%d files left in storage after purge", len(storage.files))
+	}
+}
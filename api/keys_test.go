@@ -0,0 +1,177 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestValidateKey(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	storeFile(t, a, storage, key, "a.txt", []byte("0123456789"))
+
+	setKey := func(t *testing.T, column string, value any) {
+		t.Helper()
+		if err := a.db.DB.Model(&db.Key{}).Where("hash = ?", db.HashKey(key)).Update(column, value).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	validate := func(t *testing.T) (int, KeyStatus) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/validate_key", nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status KeyStatus
+		if resp.StatusCode == 200 {
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, status
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		setKey(t, "quota_bytes", 100)
+		expires := a.clock.Now().Add(time.Hour)
+		setKey(t, "expires_at", expires)
+
+		code, status := validate(t)
+		if code != 200 || !status.Enabled {
+			t.Fatalf("status = %d %+v", code, status)
+		}
+		if status.QuotaRemaining == nil || *status.QuotaRemaining != 90 {
+			t.Fatalf("quota remaining = %v, want 90", status.QuotaRemaining)
+		}
+		if status.ExpiresAt == nil || !status.ExpiresAt.Equal(expires) {
+			t.Fatalf("expires at = %v, want %v", status.ExpiresAt, expires)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		setKey(t, "expires_at", a.clock.Now().Add(-time.Minute))
+		if code, _ := validate(t); code != 401 {
+			t.Fatalf("status = %d, want 401", code)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		setKey(t, "expires_at", nil)
+		setKey(t, "revoked", true)
+		if code, _ := validate(t); code != 401 {
+			t.Fatalf("status = %d, want 401", code)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/validate_key", nil)
+		req.Header.Set("X-API-Key", "missing")
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 401 {
+			t.Fatalf("status = %d, want 401", resp.StatusCode)
+		}
+	})
+}
+
+func TestGetAPIKeyTTL(t *testing.T) {
+	a, _, _ := newTestAPI(t, func(cfg *config.Config) {
+		cfg.AllowPublicKeyCreation = true
+	})
+	mint := func(url string) (int, string) {
+		t.Helper()
+		resp, err := a.app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var minted struct {
+			Key string `json:"key"`
+		}
+		if resp.StatusCode == 200 {
+			if err := json.NewDecoder(resp.Body).Decode(&minted); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, minted.Key
+	}
+	validate := func(key string) int {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/validate_key", nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	_, permanent := mint("/get_api_key")
+	_, temporary := mint("/get_api_key?ttl=24h")
+	if stored, err := a.db.GetAPIKey(permanent); err != nil || stored.ExpiresAt != nil {
+		t.Fatalf("permanent key = %+v, err = %v", stored, err)
+	}
+	if stored, err := a.db.GetAPIKey(temporary); err != nil || stored.ExpiresAt == nil {
+		t.Fatalf("temporary key = %+v, err = %v", stored, err)
+	}
+	if validate(permanent) != 200 || validate(temporary) != 200 {
+		t.Fatal("fresh keys are not valid")
+	}
+
+	// термін перевіряється при кожному запиті, без фонового прибирання
+	a.clock.(*clock.Fake).Advance(24 * time.Hour)
+	if status := validate(temporary); status != 401 {
+		t.Fatalf("expired key status = %d, want 401", status)
+	}
+	if status := validate(permanent); status != 200 {
+		t.Fatalf("key without ttl status = %d, want 200", status)
+	}
+
+	for _, ttl := range []string{"soon", "-1h", "0s"} {
+		if status, _ := mint("/get_api_key?ttl=" + ttl); status != 400 {
+			t.Errorf("ttl %q status = %d, want 400", ttl, status)
+		}
+	}
+}
+
+func TestRevokeOwnKey(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "leaked.txt", []byte("data"))
+	do := func(method, url string) int {
+		t.Helper()
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := do("DELETE", "/api_key"); status != 200 {
+		t.Fatalf("revoke status = %d", status)
+	}
+	for _, url := range []string{"/validate_key", fmt.Sprintf("/download/%d", fileID)} {
+		if status := do("GET", url); status != 401 {
+			t.Fatalf("GET %s with a revoked key = %d, want 401", url, status)
+		}
+	}
+	if status := do("DELETE", "/api_key"); status != 401 {
+		t.Fatalf("second revoke status = %d, want 401", status)
+	}
+
+	// за замовчуванням файли лишаються в базі, але вже не належать ключу
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil || file.OwnerAPIKey != db.RetainedOwner {
+		t.Fatalf("file = %+v, err = %v, want retained", file, err)
+	}
+}
@@ -0,0 +1,122 @@
+package api
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// normalizeContentType перевіряє синтаксис MIME типу і повертає його в
+// канонічному вигляді ("Text/Plain; Charset=UTF-8" -> "text/plain; charset=UTF-8")
+func normalizeContentType(value string) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(value)
+	if err != nil || !strings.Contains(mediaType, "/") {
+		return "", false
+	}
+	formatted := mime.FormatMediaType(mediaType, params)
+	return formatted, formatted != ""
+}
+
+// sniffLen - скільки перших байтів файлу дивиться http.DetectContentType
+const sniffLen = 512
+
+// sniffReader запам'ятовує перші sniffLen байтів, що через нього пройшли,
+// щоб визначити тип файлу, для якого клієнт не надіслав Content-Type
+type sniffReader struct {
+	r    io.Reader
+	head []byte
+}
+
+func (s *sniffReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if missing := sniffLen - len(s.head); missing > 0 && n > 0 {
+		s.head = append(s.head, p[:min(n, missing)]...)
+	}
+	return n, err
+}
+
+// contentType повертає тип, визначений за прочитаними байтами
+func (s *sniffReader) contentType() string {
+	return http.DetectContentType(s.head)
+}
+
+// handleUpdateFile змінює метадані файлу після завантаження, наприклад
+// тип, з яким він віддається, якщо клієнт спочатку надіслав неправильний
+func (a *API) handleUpdateFile(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	var req RequestUpdateFile
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if req.ContentType == "" && req.FileName == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "nothing to update")
+	}
+
+	// усе перевіряється до змін, щоб невалідне поле не лишило файл змінений наполовину
+	var contentType string
+	if req.ContentType != "" {
+		var ok bool
+		if contentType, ok = normalizeContentType(req.ContentType); !ok {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid content type")
+		}
+	}
+	var filename string
+	if req.FileName != nil {
+		if filename = sanitizeFilename(*req.FileName); filename == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "invalid filename")
+		}
+		if filename != file.FileName && a.config.DuplicatePolicy == config.DuplicateReject {
+			exists, err := a.requestDB(c).FileNameExists(key, filename)
+			if err != nil {
+				log.Err(err).Uint("fileID", file.ID).Msg("помилка перевірки імені файлу")
+				return dbError(err, "failed to update file")
+			}
+			if exists {
+				return rejectionError(rejectDuplicate)
+			}
+		}
+	}
+
+	if contentType != "" {
+		if err := a.requestDB(c).SetFileContentType(file.ID, contentType); err != nil {
+			log.Err(err).Uint("fileID", file.ID).Msg("помилка оновлення типу файлу")
+			return dbError(err, "failed to update file")
+		}
+		log.Info().Uint("fileID", file.ID).Str("contentType", contentType).Msg("тип файлу змінено")
+	}
+	if filename != "" {
+		if err := a.requestDB(c).RenameFile(file.ID, filename); err != nil {
+			log.Err(err).Uint("fileID", file.ID).Msg("помилка перейменування файлу")
+			return dbError(err, "failed to update file")
+		}
+		log.Info().Uint("fileID", file.ID).Str("file", filename).Msg("файл перейменовано")
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// sanitizeFilename готує ім'я файлу від клієнта: прибирає пробіли з країв і
+// замінює роздільники шляху на "_", щоб ім'я не могло вказувати на каталог.
+// Порожній результат - ім'я невалідне
+func sanitizeFilename(name string) string {
+	name = strings.TrimSpace(name)
+	name = strings.NewReplacer("/", "_", "\\", "_").Replace(name)
+	if name == "." || name == ".." {
+		return ""
+	}
+	return name
+}
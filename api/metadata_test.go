@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestUpdateFileContentType(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	fileID := storeFile(t, a, storage, key, "page.html", []byte("<h1>hi</h1>"))
+
+	patch := func(key, body string) int {
+		t.Helper()
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/files/%d", fileID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := patch(key, `{"content_type":"not a type"}`); status != 400 {
+		t.Fatalf("invalid content type status = %d, want 400", status)
+	}
+	if status := patch("other-key", `{"content_type":"text/html"}`); status != 401 && status != 403 {
+		t.Fatalf("foreign key status = %d, want 401 or 403", status)
+	}
+	if status := patch(key, `{"content_type":"Text/HTML; Charset=utf-8"}`); status != 204 {
+		t.Fatalf("update status = %d, want 204", status)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	if got := resp.Header.Get("Content-Type"); got != "text/html; charset=utf-8" {
+		t.Fatalf("Content-Type = %q, want text/html; charset=utf-8", got)
+	}
+}
+
+func TestRenameFile(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) { cfg.DuplicatePolicy = config.DuplicateReject })
+	fileID := storeFile(t, a, storage, key, "wrong.txt", []byte("data"))
+	storeFile(t, a, storage, key, "taken.txt", []byte("other"))
+
+	patch := func(body string) int {
+		t.Helper()
+		req := httptest.NewRequest("PATCH", fmt.Sprintf("/files/%d", fileID), strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	for _, body := range []string{`{"filename":""}`, `{"filename":"  "}`, `{"filename":".."}`} {
+		if status := patch(body); status != 400 {
+			t.Fatalf("%s status = %d, want 400", body, status)
+		}
+	}
+	if status := patch(`{"filename":"taken.txt"}`); status != 409 {
+		t.Fatalf("duplicate name status = %d, want 409", status)
+	}
+	if status := patch(`{"filename":"../reports/right.txt"}`); status != 204 {
+		t.Fatalf("rename status = %d, want 204", status)
+	}
+
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, file := range files {
+		if file.ID == fileID {
+			if file.Size != 4 || file.Status != "completed" {
+				t.Fatalf("renamed file = %+v, want only the name changed", file)
+			}
+		}
+		names = append(names, file.FileName)
+	}
+	if !slices.Contains(names, ".._reports_right.txt") || slices.Contains(names, "wrong.txt") {
+		t.Fatalf("names = %q, want the file renamed with separators replaced", names)
+	}
+}
+
+func TestUploadStoresContentType(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		header  string
+		data    string
+		noSniff bool
+		stored  string // тип, збережений при завантаженні
+		want    string
+	}{
+		{name: "from part header", header: "Image/PNG", data: "not really a png", stored: "image/png", want: "image/png"},
+		{name: "sniffed", data: "<html><body>hi</body></html>", stored: "text/html; charset=utf-8", want: "text/html; charset=utf-8"},
+		{name: "sniffed signature", data: "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", stored: "image/png", want: "image/png"},
+		{name: "unknown", data: "\x00\x01\x02\x03", stored: "application/octet-stream", want: "application/octet-stream"},
+		{name: "sniffing off", data: "<html><body>hi</body></html>", noSniff: true, want: "application/octet-stream"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.SniffContentType = !tc.noSniff
+			})
+
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			header := textproto.MIMEHeader{}
+			header.Set("Content-Disposition", `form-data; name="file"; filename="data"`)
+			if tc.header != "" {
+				header.Set("Content-Type", tc.header)
+			}
+			part, err := writer.CreatePart(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			part.Write([]byte(tc.data))
+			writer.Close()
+
+			req := httptest.NewRequest("POST", "/upload", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("X-API-Key", key)
+			resp, err := a.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("upload status = %d", resp.StatusCode)
+			}
+
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != 1 {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+			if files[0].ContentType != tc.stored {
+				t.Fatalf("stored content type = %q, want %q", files[0].ContentType, tc.stored)
+			}
+			waitForStatus(t, a, files[0].ID, "completed")
+
+			req = httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", files[0].ID), nil)
+			req.Header.Set("X-API-Key", key)
+			resp, err = a.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.Copy(io.Discard, resp.Body)
+			if got := resp.Header.Get("Content-Type"); got != tc.want {
+				t.Fatalf("Content-Type = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
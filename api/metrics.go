@@ -0,0 +1,175 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/zerolog/log"
+)
+
+// keyMetrics - використання сховища по ключах для Prometheus. Ключ у мітці
+// замінюється відбитком, а кількість ключів з мітками обмежена, щоб тисячі
+// ключів не роздули кількість часових рядів
+type keyMetrics struct {
+	registry *prometheus.Registry
+	bytes    *prometheus.GaugeVec
+	files    *prometheus.GaugeVec
+	// chunks, storageLatency і responses - метрики роботи сервера, не ключів
+	chunks         *prometheus.CounterVec
+	storageLatency *prometheus.HistogramVec
+	responses      *prometheus.CounterVec
+
+	mu    sync.Mutex
+	keys  map[string]bool
+	limit int
+}
+
+func newKeyMetrics(limit int) *keyMetrics {
+	m := &keyMetrics{
+		registry: prometheus.NewRegistry(),
+		bytes: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "infinity_storage_key_stored_bytes",
+			Help: "Logical size of files stored by an API key.",
+		}, []string{"key"}),
+		files: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "infinity_storage_key_files",
+			Help: "Number of files stored by an API key.",
+		}, []string{"key"}),
+		chunks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "infinity_storage_chunks_total",
+			Help: "Chunks processed by upload workers, by result.",
+		}, []string{"status"}),
+		storageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "infinity_storage_storage_request_seconds",
+			Help:    "Latency of storage backend requests, by operation.",
+			Buckets: prometheus.ExponentialBuckets(0.05, 2, 10),
+		}, []string{"op"}),
+		responses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "infinity_storage_http_error_responses_total",
+			Help: "HTTP responses with a 4xx or 5xx status, by class.",
+		}, []string{"class"}),
+		keys:  make(map[string]bool),
+		limit: limit,
+	}
+	m.registry.MustRegister(m.bytes, m.files, m.chunks, m.storageLatency, m.responses)
+	return m
+}
+
+// countChunk рахує chunk, який worker відправив (completed) чи не зміг відправити (failed)
+func (m *keyMetrics) countChunk(status string) {
+	if m == nil {
+		return
+	}
+	m.chunks.WithLabelValues(status).Inc()
+}
+
+// observeStorage записує тривалість запиту op (send або get) до сховища
+func (m *keyMetrics) observeStorage(op string, elapsed time.Duration) {
+	if m == nil {
+		return
+	}
+	m.storageLatency.WithLabelValues(op).Observe(elapsed.Seconds())
+}
+
+// keyFingerprint - короткий відбиток ключа, за яким його не можна відновити
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// set записує використання ключа, якщо для нього є місце серед міток
+func (m *keyMetrics) set(key string, bytes, files int64) {
+	fingerprint := keyFingerprint(key)
+
+	m.mu.Lock()
+	if !m.keys[fingerprint] {
+		if m.limit > 0 && len(m.keys) >= m.limit {
+			m.mu.Unlock()
+			return
+		}
+		m.keys[fingerprint] = true
+	}
+	m.mu.Unlock()
+
+	m.bytes.WithLabelValues(fingerprint).Set(float64(bytes))
+	m.files.WithLabelValues(fingerprint).Set(float64(files))
+}
+
+// updateKeyUsage перераховує використання ключа після завантаження, передачі
+// чи видалення файлів, якщо метрики по ключах увімкнені
+func (a *API) updateKeyUsage(keys ...string) {
+	if a.metrics == nil {
+		return
+	}
+	for _, key := range keys {
+		bytes, files, err := a.db.KeyUsage(key)
+		if err != nil {
+			log.Err(err).Str("key", shortKey(key)).Msg("помилка підрахунку використання ключа")
+			continue
+		}
+		a.metrics.set(key, bytes, files)
+	}
+}
+
+// loadKeyUsage заповнює метрики використанням з бази при старті
+func (a *API) loadKeyUsage() {
+	usage, err := a.db.UsageByOwner()
+	if err != nil {
+		log.Err(err).Msg("помилка підрахунку використання ключів")
+		return
+	}
+	for _, u := range usage {
+		a.metrics.set(u.Key, u.Bytes, u.Files)
+	}
+}
+
+// registerQueueMetrics додає до /metrics кількість chunks, що чекають на відправку
+func (a *API) registerQueueMetrics() {
+	a.metrics.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "infinity_storage_queue_depth",
+		Help: "Chunks waiting in the upload queue.",
+	}, func() float64 {
+		return float64(a.queuedChunks())
+	}))
+}
+
+// countResponses рахує відповіді з помилкою клієнта (4xx) чи сервера (5xx)
+func (a *API) countResponses(c *fiber.Ctx) error {
+	err := c.Next()
+	status := c.Response().StatusCode()
+	if err != nil {
+		// відповідь з помилки пише errorHandler вже після middleware
+		status = errorStatus(err)
+	}
+	switch {
+	case status >= 500:
+		a.metrics.responses.WithLabelValues("5xx").Inc()
+	case status >= 400:
+		a.metrics.responses.WithLabelValues("4xx").Inc()
+	}
+	return err
+}
+
+// errorStatus повертає HTTP статус, з яким errorHandler відповість на err
+func errorStatus(err error) int {
+	var resp *responseError
+	if errors.As(err, &resp) {
+		return resp.status
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
+
+func (a *API) metricsHandler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.HandlerFor(a.metrics.registry, promhttp.HandlerOpts{}))
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func scrapeMetrics(t *testing.T, a *API) string {
+	t.Helper()
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set("X-Admin-Token", a.config.AdminToken)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("metrics status = %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestKeyUsageMetrics(t *testing.T) {
+	for _, tc := range []struct {
+		limit     int
+		wantOther bool
+	}{
+		{limit: 0, wantOther: true},
+		{limit: 1, wantOther: false},
+	} {
+		a, _, key := newTestAPI(t, func(cfg *config.Config) {
+			cfg.KeyMetrics = true
+			cfg.KeyMetricsLimit = tc.limit
+			cfg.AdminToken = "admin"
+		})
+		otherKey, err := a.db.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, upload := range []struct {
+			key  string
+			data string
+		}{
+			{key, "hello"},
+			{key, "world!"},
+			{otherKey, "abc"},
+		} {
+			resp, err := a.app.Test(newUploadRequest(t, upload.key, "f.txt", []byte(upload.data)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("upload status = %d", resp.StatusCode)
+			}
+		}
+
+		out := scrapeMetrics(t, a)
+		for _, want := range []string{
+			fmt.Sprintf(`infinity_storage_key_stored_bytes{key="%s"} 11`, keyFingerprint(db.HashKey(key))),
+			fmt.Sprintf(`infinity_storage_key_files{key="%s"} 2`, keyFingerprint(db.HashKey(key))),
+		} {
+			if !strings.Contains(out, want) {
+				t.Fatalf("limit %d: metrics missing %q:\n%s", tc.limit, want, out)
+			}
+		}
+		other := fmt.Sprintf(`infinity_storage_key_stored_bytes{key="%s"} 3`, keyFingerprint(db.HashKey(otherKey)))
+		if strings.Contains(out, other) != tc.wantOther {
+			t.Fatalf("limit %d: second key present = %v, want %v", tc.limit, !tc.wantOther, tc.wantOther)
+		}
+		if strings.Contains(out, key) || strings.Contains(out, otherKey) {
+			t.Fatal("raw API key leaked into metrics")
+		}
+	}
+}
+
+func TestServerMetrics(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.KeyMetrics = true
+		cfg.AdminToken = "admin"
+	})
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "f.txt", []byte("hello")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	waitForStatus(t, a, files[0].ID, "completed")
+
+	// скачування читає chunk зі сховища
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", files[0].ID), nil)
+	req.Header.Set("X-API-Key", key)
+	if _, err := a.app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	// запит без ключа - 401
+	if _, err := a.app.Test(httptest.NewRequest("GET", "/files", nil)); err != nil {
+		t.Fatal(err)
+	}
+	storage.mu.Lock()
+	storage.sendErr = errors.New("storage is gone")
+	storage.mu.Unlock()
+	a.processChunk(&db.Chunk{FileID: files[0].ID, Position: 2, Size: 4, Data: []byte("data")})
+
+	out := scrapeMetrics(t, a)
+	for _, want := range []string{
+		`infinity_storage_chunks_total{status="completed"} 1`,
+		`infinity_storage_chunks_total{status="failed"} 1`,
+		`infinity_storage_storage_request_seconds_count{op="send"} 2`,
+		`infinity_storage_storage_request_seconds_count{op="get"} 1`,
+		`infinity_storage_http_error_responses_total{class="4xx"} 1`,
+		`infinity_storage_queue_depth 0`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("metrics missing %q:\n%s", want, out)
+		}
+	}
+}
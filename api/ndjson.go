@@ -0,0 +1,36 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// listBatchSize - скільки файлів читається з бази за раз для NDJSON списку
+const listBatchSize = 500
+
+// streamFilesList віддає файли ключа як NDJSON: один JSON запис на рядок,
+// читаючи їх з бази частинами, тож список не збирається в пам'яті цілком.
+// Помилка посеред потоку лише обриває відповідь, бо статус уже відправлено.
+// fields, якщо не nil, - поля, які лишаються в кожному записі
+func (a *API) streamFilesList(c *fiber.Ctx, key string, filter db.FileFilter, fields []string) error {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+		err := a.db.EachFileByOwner(key, filter, listBatchSize, func(files []db.File) error {
+			for _, file := range files {
+				if err := encoder.Encode(projectFile(file, fields)); err != nil {
+					return err
+				}
+			}
+			return w.Flush()
+		})
+		if err != nil {
+			log.Err(err).Msg("помилка потокової віддачі списку файлів, відповідь обірвано")
+		}
+	})
+	return nil
+}
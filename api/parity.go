@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// xorInto додає data до parity через XOR, parity росте до довжини data
+func xorInto(parity, data []byte) []byte {
+	if len(parity) < len(data) {
+		parity = append(parity, make([]byte, len(data)-len(parity))...)
+	}
+	for i, b := range data {
+		parity[i] ^= b
+	}
+	return parity
+}
+
+// splitParity відділяє parity chunk від chunks з даними
+func splitParity(chunks []db.Chunk) ([]db.Chunk, *db.Chunk) {
+	var parity *db.Chunk
+	data := chunks[:0]
+	for i := range chunks {
+		if chunks[i].Parity {
+			// копія, бо data пише в той самий масив і може перезаписати chunks[i]
+			p := chunks[i]
+			parity = &p
+			continue
+		}
+		data = append(data, chunks[i])
+	}
+	return data, parity
+}
+
+// reconstructChunk відновлює missing як XOR parity і всіх інших chunks файлу
+func (a *API) reconstructChunk(missing db.Chunk, chunks []db.Chunk, parity db.Chunk) ([]byte, error) {
+	rawParity, err := a.loadChunk(parity)
+	if err != nil {
+		return nil, fmt.Errorf("parity chunk недоступний: %w", err)
+	}
+	restored := xorInto(nil, rawParity)
+
+	for _, chunk := range chunks {
+		if chunk.Position == missing.Position {
+			continue
+		}
+		rawData, err := a.loadChunk(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("не вдалося відновити chunk %d, chunk %d теж недоступний: %w", missing.Position, chunk.Position, err)
+		}
+		restored = xorInto(restored, rawData)
+	}
+
+	if int64(len(restored)) < missing.Size {
+		return nil, fmt.Errorf("parity коротший за chunk %d", missing.Position)
+	}
+	return restored[:missing.Size], nil
+}
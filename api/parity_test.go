@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestDownloadReconstructsLostChunk(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	chunks := [][]byte{[]byte("first-"), []byte("second"), []byte("end")}
+	fileID := storeFile(t, a, storage, key, "data.bin", chunks...)
+
+	var parity []byte
+	for _, chunk := range chunks {
+		parity = xorInto(parity, chunk)
+	}
+	telegramID, err := storage.SendFile("parity", parity, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.db.AddChunkToFile(&db.Chunk{
+		FileID:         fileID,
+		Parity:         true,
+		Size:           int64(len(parity)),
+		TelegramFileID: telegramID,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// губимо другий chunk в сховищі
+	stored, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range stored {
+		if chunk.Position == 2 {
+			delete(storage.files, chunk.TelegramFileID)
+		}
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "first-secondend" {
+		t.Fatalf("body = %q", body)
+	}
+}
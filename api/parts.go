@@ -0,0 +1,61 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/rs/zerolog/log"
+)
+
+// partLimiter обмежує, скільки файлів одного multipart запиту можуть мати
+// chunks, які ще не відправлені в сховище. Кожен такий файл тримає свої chunks
+// у пам'яті, тому ліміт обмежує пам'ять запиту
+type partLimiter struct {
+	slots chan struct{}
+}
+
+func newPartLimiter(n int) *partLimiter {
+	return &partLimiter{slots: make(chan struct{}, max(n, 1))}
+}
+
+// acquire чекає на вільне місце і повертає лічильник chunks файлу. Місце
+// звільняється, коли файл дочитано (Done від викликача) і всі його chunks оброблені
+func (l *partLimiter) acquire() *sync.WaitGroup {
+	l.slots <- struct{}{}
+	pending := &sync.WaitGroup{}
+	pending.Add(1)
+	go func() {
+		pending.Wait()
+		<-l.slots
+	}()
+	return pending
+}
+
+// enqueue ставить chunk власника owner у чергу відправки, враховуючи його
+// в pending, якщо задано. Без FAIR_QUEUE усі chunks мають спільну чергу
+func (a *API) enqueue(owner string, chunk *db.Chunk, pending *sync.WaitGroup) {
+	// у спільній черзі дані chunk лежать у базі, а не в пам'яті, тож pending
+	// їх не обмежує
+	if a.shared != nil {
+		if err := a.shared.push(chunk); err != nil {
+			log.Err(err).Uint("fileID", chunk.FileID).Int("position", chunk.Position).Msg("помилка збереження chunk у спільну чергу")
+			a.failFile(chunk.FileID)
+		}
+		return
+	}
+	if pending != nil {
+		pending.Add(1)
+		a.pending.Store(chunk, pending)
+	}
+	if !a.config.FairQueue {
+		owner = ""
+	}
+	a.queue.push(owner, chunk)
+}
+
+// chunkDone позначає chunk з черги обробленим
+func (a *API) chunkDone(chunk *db.Chunk) {
+	if pending, ok := a.pending.LoadAndDelete(chunk); ok {
+		pending.(*sync.WaitGroup).Done()
+	}
+}
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// queueWatcher запам'ятовує, скільки chunks чекало в черзі під час кожної
+// відправки, тобто скільки даних запит тримав у пам'яті понад chunk, що відправляється
+type queueWatcher struct {
+	*fakeStorage
+	mu     sync.Mutex
+	queued func() int
+	peak   int
+}
+
+func (s *queueWatcher) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	// даємо читачу запиту час поставити в чергу наступні chunks, якщо він може
+	time.Sleep(20 * time.Millisecond)
+	s.mu.Lock()
+	s.peak = max(s.peak, s.queued())
+	s.mu.Unlock()
+	return s.fakeStorage.SendFileMessage(fileName, data, caption)
+}
+
+func TestUploadPartsBoundedMemory(t *testing.T) {
+	const chunksPerPart = 3
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	contents := make(map[string][]byte)
+	for _, name := range names {
+		// три chunks по 8 байтів, останній неповний
+		contents[name] = []byte(fmt.Sprintf("content of %s ......", name))[:8*chunksPerPart-2]
+	}
+
+	for _, limit := range []int{1, 2} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := database.NewAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			storage := &queueWatcher{fakeStorage: newFakeStorage()}
+			a := newAPI(config.Config{ChunkSize: 8, MaxConcurrentParts: limit}, storage, database, clock.NewFake(time.Now()), nil)
+			storage.queued = func() int { return a.queue.len() }
+			t.Cleanup(func() { a.Stop(context.Background()) })
+
+			var body bytes.Buffer
+			writer := multipart.NewWriter(&body)
+			for _, name := range names {
+				part, err := writer.CreateFormFile("file", name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				part.Write(contents[name])
+			}
+			writer.Close()
+
+			req := httptest.NewRequest("POST", "/upload", &body)
+			req.Header.Set("Content-Type", writer.FormDataContentType())
+			req.Header.Set("X-API-Key", key)
+			resp, err := a.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+
+			// кожна частина - окремий файл зі своїми chunks 1..n
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != len(names) {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+			for _, file := range files {
+				want, ok := contents[file.FileName]
+				if !ok || file.Size != int64(len(want)) || file.TotalChunks != chunksPerPart {
+					t.Fatalf("file = %+v", file)
+				}
+				waitForStatus(t, a, file.ID, "completed")
+				chunks, err := a.db.GetChunksByFileID(file.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, chunk := range chunks {
+					if chunk.Position != i+1 {
+						t.Fatalf("%s chunk positions = %+v", file.FileName, chunks)
+					}
+				}
+
+				req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", file.ID), nil)
+				req.Header.Set("X-API-Key", key)
+				resp, err := a.app.Test(req, -1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, _ := io.ReadAll(resp.Body)
+				if resp.StatusCode != 200 || !bytes.Equal(got, want) {
+					t.Fatalf("%s download = %d %q, want %q", file.FileName, resp.StatusCode, got, want)
+				}
+			}
+
+			// у черзі водночас лише chunks не більше ніж limit частин
+			// без відправленого зараз, а не всі 12
+			storage.mu.Lock()
+			peak := storage.peak
+			storage.mu.Unlock()
+			if wantPeak := limit*chunksPerPart - 1; peak > wantPeak {
+				t.Fatalf("%d chunks waited in the queue, want at most %d", peak, wantPeak)
+			}
+			if peak == 0 {
+				t.Fatal("queue was never observed, the check measured nothing")
+			}
+		})
+	}
+}
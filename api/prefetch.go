@@ -0,0 +1,53 @@
+package api
+
+import "github.com/ZaViBiS/infinity-storage/db"
+
+// chunkResult - дані chunk, завантажені наперед, або помилка
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// prefetchChunks завантажує wanted зі сховища паралельно, щоб очікування
+// відповідей сховища перекривалось, і повертає функцію, яка віддає їх
+// результати по черзі в порядку wanted. Наперед завантажено не більше
+// DownloadConcurrency chunks. Закриття done зупиняє нові завантаження
+func (a *API) prefetchChunks(fileID uint, wanted, chunks []db.Chunk, parity *db.Chunk, done <-chan struct{}) func() chunkResult {
+	return prefetch(len(wanted), a.config.DownloadConcurrency, func(i int) ([]byte, error) {
+		return a.fetchChunk(fileID, wanted[i], chunks, parity)
+	}, done)
+}
+
+// prefetch викликає fetch для 0..n-1 паралельно і повертає функцію, яка
+// віддає результати по черзі. Місце в sem займається по порядку і
+// звільняється, коли результат віддано, тому в пам'яті не більше
+// concurrency результатів. Закриття done зупиняє нові виклики fetch
+func prefetch(n, concurrency int, fetch func(i int) ([]byte, error), done <-chan struct{}) func() chunkResult {
+	results := make([]chan chunkResult, n)
+	for i := range results {
+		results[i] = make(chan chunkResult, 1)
+	}
+
+	sem := make(chan struct{}, max(concurrency, 1))
+	go func() {
+		for i := range n {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func() {
+				data, err := fetch(i)
+				results[i] <- chunkResult{data: data, err: err}
+			}()
+		}
+	}()
+
+	next := 0
+	return func() chunkResult {
+		res := <-results[next]
+		next++
+		<-sem
+		return res
+	}
+}
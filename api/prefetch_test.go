@@ -0,0 +1,62 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+)
+
+func TestDownloadPrefetchKeepsOrder(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) { cfg.DownloadConcurrency = 3 })
+
+	var chunks [][]byte
+	for i := range 8 {
+		chunks = append(chunks, bytes.Repeat([]byte{byte('a' + i)}, 100))
+	}
+	fileID := storeFile(t, a, storage, key, "big.bin", chunks...)
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := bytes.Join(chunks, nil); !bytes.Equal(body, want) {
+		t.Fatalf("body = %q, want %q", body, want)
+	}
+}
+
+func benchmarkDownload(b *testing.B, concurrency int) {
+	a, storage, key := newTestAPI(b)
+	a.config.DownloadConcurrency = concurrency
+	storage.delay = 5 * time.Millisecond
+
+	var chunks [][]byte
+	for range 8 {
+		chunks = append(chunks, make([]byte, 1024))
+	}
+	fileID := storeFile(b, a, storage, key, "big.bin", chunks...)
+
+	b.ResetTimer()
+	for range b.N {
+		req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			b.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+	}
+}
+
+func BenchmarkDownloadSequential(b *testing.B) { benchmarkDownload(b, 1) }
+func BenchmarkDownloadParallel(b *testing.B)   { benchmarkDownload(b, 4) }
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// причини, з яких завантаження не приймається
+const (
+	rejectTooLarge      = "too_large"
+	rejectQuotaExceeded = "quota_exceeded"
+	rejectContentType   = "content_type_not_allowed"
+	rejectDuplicate     = "duplicate"
+	rejectDiskFull      = "insufficient_storage"
+	rejectStorageDown   = "storage_unavailable"
+)
+
+const unknownUploadSize = -1
+
+var errUploadTooLarge = errors.New("upload exceeds the size limit or quota")
+
+// uploadMeta - те, що відомо про файл до читання його даних
+type uploadMeta struct {
+	FileName    string
+	ContentType string
+	Size        int64 // unknownUploadSize, якщо розмір ще невідомий
+}
+
+// checkUpload повертає причину, з якої завантаження не буде прийнято,
+// або "", якщо його приймуть. Ліміти розміру перевіряються, лише коли розмір відомий
+func (a *API) checkUpload(key string, meta uploadMeta) (string, error) {
+	if !a.enoughDiskSpace() {
+		return rejectDiskFull, nil
+	}
+	if !a.storageReachable() {
+		return rejectStorageDown, nil
+	}
+	if meta.Size != unknownUploadSize {
+		if a.config.MaxUploadSize > 0 && meta.Size > a.config.MaxUploadSize {
+			return rejectTooLarge, nil
+		}
+		remaining, limited, err := a.quotaRemaining(key)
+		if err != nil {
+			return "", err
+		}
+		if limited && meta.Size > remaining {
+			return rejectQuotaExceeded, nil
+		}
+	}
+
+	if !contentTypeAllowed(a.config.AllowedContentTypes, meta.ContentType) {
+		return rejectContentType, nil
+	}
+
+	if a.config.DuplicatePolicy == config.DuplicateReject {
+		exists, err := a.db.FileNameExists(key, meta.FileName)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return rejectDuplicate, nil
+		}
+	}
+	return "", nil
+}
+
+// storageCheck - останній результат перевірки доступності сховища
+type storageCheck struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	err       error
+}
+
+// storageReachable перевіряє, що сховище відповідає (REJECT_WHEN_STORAGE_DOWN).
+// Результат кешується на STORAGE_CHECK_TTL, щоб не питати сховище на кожне завантаження
+func (a *API) storageReachable() bool {
+	if !a.config.RejectWhenStorageDown {
+		return true
+	}
+
+	check := &a.storageCheck
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	now := a.clock.Now()
+	if check.checkedAt.IsZero() || now.Sub(check.checkedAt) >= a.config.StorageCheckTTL {
+		check.err = storage.Ping(a.storage)
+		check.checkedAt = now
+		if check.err != nil {
+			log.Warn().Err(check.err).Msg("сховище недоступне, нові завантаження відхиляються")
+		}
+	}
+	return check.err == nil
+}
+
+// enoughDiskSpace перевіряє, що на диску бази і, для fs бекенду, на диску
+// STORAGE_DIR вільно щонайменше MIN_FREE_DISK байтів. Якщо місце дізнатись
+// не вдалось, завантаження не блокуються
+func (a *API) enoughDiskSpace() bool {
+	if a.config.MinFreeDisk <= 0 {
+		return true
+	}
+
+	paths := []string{a.db.Dir()}
+	if a.config.StorageBackend == storage.FS {
+		paths = append(paths, a.config.StorageDir)
+	}
+	for _, path := range paths {
+		free, err := a.freeSpace(path)
+		if err != nil {
+			log.Warn().Err(err).Str("path", path).Msg("не вдалося дізнатись вільне місце на диску")
+			continue
+		}
+		if free < uint64(a.config.MinFreeDisk) {
+			log.Warn().
+				Str("path", path).
+				Uint64("free", free).
+				Int64("min", a.config.MinFreeDisk).
+				Msg("на диску замало місця, завантаження не приймаються")
+			return false
+		}
+	}
+	return true
+}
+
+// quotaRemaining повертає, скільки байтів ще може зберегти ключ,
+// limited=false, якщо квоти немає
+func (a *API) quotaRemaining(key string) (int64, bool, error) {
+	validKey, err := a.db.GetKeyByHash(key)
+	if err != nil || validKey.QuotaBytes <= 0 {
+		return 0, false, err
+	}
+	used, err := a.db.UsedBytes(key)
+	if err != nil {
+		return 0, false, err
+	}
+	return max(validKey.QuotaBytes-used, 0), true, nil
+}
+
+// uploadSizeLimit повертає найбільший розмір, який ще можна завантажити ключем,
+// -1 - без обмеження
+func (a *API) uploadSizeLimit(key string) (int64, error) {
+	limit := int64(-1)
+	if a.config.MaxUploadSize > 0 {
+		limit = a.config.MaxUploadSize
+	}
+	remaining, limited, err := a.quotaRemaining(key)
+	if err != nil {
+		return 0, err
+	}
+	if limited && (limit < 0 || remaining < limit) {
+		limit = remaining
+	}
+	return limit, nil
+}
+
+// contentTypeAllowed перевіряє тип за списком, у якому можна писати "image/*".
+// Порожній список дозволяє все
+func contentTypeAllowed(allowed []string, contentType string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, pattern := range allowed {
+		if pattern == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// rejectionError перетворює причину відмови у відповідь клієнту
+func rejectionError(reason string) error {
+	switch reason {
+	case rejectTooLarge, rejectQuotaExceeded:
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, reason)
+	case rejectContentType:
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, reason)
+	case rejectDuplicate:
+		return fiber.NewError(fiber.StatusConflict, reason)
+	case rejectDiskFull:
+		return fiber.NewError(fiber.StatusInsufficientStorage, reason)
+	case rejectStorageDown:
+		return fiber.NewError(fiber.StatusServiceUnavailable, reason)
+	}
+	return fiber.NewError(fiber.StatusBadRequest, reason)
+}
+
+// handleValidateUpload перевіряє заголовки і заявлені метадані завантаження
+// без тіла, щоб клієнт міг дізнатись про відмову до відправки гігабайтів
+func (a *API) handleValidateUpload(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	if _, err := parseTags(c.Get("X-Tags")); err != nil {
+		return err
+	}
+
+	var req RequestValidateUpload
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid request body")
+	}
+	if req.Filename == "" || req.Size < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "filename and size are required")
+	}
+
+	reason, err := a.checkUpload(key, uploadMeta{FileName: req.Filename, ContentType: req.ContentType, Size: req.Size})
+	if err != nil {
+		log.Err(err).Msg("помилка перевірки завантаження")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to validate upload")
+	}
+	return c.JSON(UploadValidation{Accepted: reason == "", Reason: reason})
+}
+
+// sizeLimitReader обриває завантаження, коли прочитано більше limit байтів
+type sizeLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.read > r.limit {
+		return n, errUploadTooLarge
+	}
+	return n, err
+}
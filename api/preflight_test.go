@@ -0,0 +1,277 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/storage"
+)
+
+func TestValidateUpload(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.MaxUploadSize = 1000
+		cfg.AllowedContentTypes = []string{"image/*", "application/pdf"}
+		cfg.DuplicatePolicy = config.DuplicateReject
+	})
+	storeFile(t, a, storage, key, "existing.pdf", make([]byte, 100))
+	if err := a.db.DB.Model(&db.Key{}).Where("hash = ?", db.HashKey(key)).Update("quota_bytes", 600).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		reason string
+	}{
+		{"accepted", `{"filename":"photo.jpg","size":500,"content_type":"image/jpeg"}`, 200, ""},
+		{"too large", `{"filename":"photo.jpg","size":1001,"content_type":"image/jpeg"}`, 200, rejectTooLarge},
+		{"quota exceeded", `{"filename":"photo.jpg","size":501,"content_type":"image/jpeg"}`, 200, rejectQuotaExceeded},
+		{"content type", `{"filename":"run.sh","size":10,"content_type":"text/x-sh"}`, 200, rejectContentType},
+		{"duplicate", `{"filename":"existing.pdf","size":10,"content_type":"application/pdf"}`, 200, rejectDuplicate},
+		{"missing filename", `{"size":10}`, 400, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/upload/validate", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-API-Key", key)
+			resp, err := a.app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if tt.status != 200 {
+				return
+			}
+
+			var validation UploadValidation
+			if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+				t.Fatal(err)
+			}
+			if validation.Accepted != (tt.reason == "") || validation.Reason != tt.reason {
+				t.Fatalf("validation = %+v, want reason %q", validation, tt.reason)
+			}
+		})
+	}
+}
+
+func TestUploadEnforcesLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config func(cfg *config.Config)
+		status int
+	}{
+		{"too large", func(cfg *config.Config) { cfg.MaxUploadSize = 10 }, 413},
+		{"content type", func(cfg *config.Config) { cfg.AllowedContentTypes = []string{"image/*"} }, 415},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, _, key := newTestAPI(t, tt.config)
+
+			resp, err := a.app.Test(newUploadRequest(t, key, "a.bin", make([]byte, 100)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 1 || files[0].Status != "failed" {
+				t.Fatalf("files = %+v", files)
+			}
+		})
+	}
+}
+
+func TestContentTypeAllowed(t *testing.T) {
+	allowed := []string{"image/*", "application/pdf"}
+	for contentType, want := range map[string]bool{
+		"image/png":                true,
+		"application/pdf":          true,
+		"application/pdf; q=1":     true,
+		"imagex/png":               false,
+		"application/octet-stream": false,
+		"":                         false,
+	} {
+		if got := contentTypeAllowed(allowed, contentType); got != want {
+			t.Errorf("contentTypeAllowed(%q) = %v, want %v", contentType, got, want)
+		}
+	}
+	if !contentTypeAllowed(nil, "") {
+		t.Error("empty allowlist must allow everything")
+	}
+}
+
+func TestUploadQuota(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	if err := a.db.DB.Model(&db.Key{}).Where("hash = ?", db.HashKey(key)).Update("quota_bytes", 100).Error; err != nil {
+		t.Fatal(err)
+	}
+	upload := func(name string, size int) int {
+		t.Helper()
+		resp, err := a.app.Test(newUploadRequest(t, key, name, make([]byte, size)), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// перевищення помічається посеред тіла, і файл не займає квоту
+	if status := upload("big.bin", 150); status != 413 {
+		t.Fatalf("upload over the quota status = %d, want 413", status)
+	}
+	if status := upload("fits.bin", 100); status != 202 {
+		t.Fatalf("upload filling the quota status = %d, want 202", status)
+	}
+	if used, err := a.db.UsedBytes(db.HashKey(key)); err != nil || used != 100 {
+		t.Fatalf("used = %d, err = %v, want 100", used, err)
+	}
+	if status := upload("more.bin", 1); status != 413 {
+		t.Fatalf("upload to a full key status = %d, want 413", status)
+	}
+}
+
+func TestUploadRejectedWhenDiskIsFull(t *testing.T) {
+	storageDir := t.TempDir()
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.MinFreeDisk = 1 << 30
+		cfg.StorageBackend = storage.FS
+		cfg.StorageDir = storageDir
+	})
+	var mu sync.Mutex
+	free := map[string]uint64{a.db.Dir(): 10 << 30, storageDir: 1 << 20}
+	a.freeSpace = func(path string) (uint64, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		space, ok := free[path]
+		if !ok {
+			t.Errorf("checked free space of unexpected path %q", path)
+		}
+		return space, nil
+	}
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "big.bin", []byte("data")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 507 {
+		t.Fatalf("upload with a full storage dir = %d, want 507", resp.StatusCode)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 || files[0].Status != "failed" {
+		t.Fatalf("files = %+v, err = %v, want one failed file", files, err)
+	}
+
+	req := httptest.NewRequest("POST", "/upload/validate", strings.NewReader(`{"filename":"big.bin","size":4}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-API-Key", key)
+	resp, err = a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var validation UploadValidation
+	if err := json.NewDecoder(resp.Body).Decode(&validation); err != nil {
+		t.Fatal(err)
+	}
+	if validation.Accepted || validation.Reason != rejectDiskFull {
+		t.Fatalf("validation = %+v, want %s", validation, rejectDiskFull)
+	}
+
+	// місце звільнилось
+	mu.Lock()
+	free[storageDir] = 2 << 30
+	mu.Unlock()
+	resp, err = a.app.Test(newUploadRequest(t, key, "big.bin", []byte("data")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload with enough space = %d, want 202", resp.StatusCode)
+	}
+}
+
+// pingStorage - сховище, доступність якого задає тест
+type pingStorage struct {
+	*fakeStorage
+	pingErr error
+	pings   int
+}
+
+func (s *pingStorage) Ping() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pings++
+	return s.pingErr
+}
+
+func TestUploadRejectedWhenStorageIsDown(t *testing.T) {
+	a, fake, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.RejectWhenStorageDown = true
+		cfg.StorageCheckTTL = time.Minute
+	})
+	backend := &pingStorage{fakeStorage: fake, pingErr: errors.New("telegram is unreachable")}
+	a.storage = backend
+	upload := func() int {
+		t.Helper()
+		resp, err := a.app.Test(newUploadRequest(t, key, "a.bin", []byte("data")), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if status := upload(); status != 503 {
+		t.Fatalf("upload with storage down = %d, want 503", status)
+	}
+	if len(fake.names) != 0 {
+		t.Fatalf("sent %d chunks to unreachable storage", len(fake.names))
+	}
+
+	// сховище вже доступне, але результат перевірки ще в кеші
+	fake.mu.Lock()
+	backend.pingErr = nil
+	fake.mu.Unlock()
+	if status := upload(); status != 503 {
+		t.Fatalf("upload within the check TTL = %d, want 503", status)
+	}
+	if backend.pings != 1 {
+		t.Fatalf("pinged %d times, want 1", backend.pings)
+	}
+
+	a.clock.(*clock.Fake).Advance(time.Minute)
+	if status := upload(); status != 202 {
+		t.Fatalf("upload after storage came back = %d, want 202", status)
+	}
+}
+
+func TestUploadRejectedWhenLimitedStorageIsDown(t *testing.T) {
+	a, fake, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.RejectWhenStorageDown = true
+		cfg.StorageConcurrency = 8
+	})
+	// так сховище обгортає newAPI при STORAGE_CONCURRENCY > 0
+	a.storage = storage.Limit(&pingStorage{fakeStorage: fake, pingErr: errors.New("telegram is unreachable")}, a.config.StorageConcurrency)
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "a.bin", []byte("data")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 {
+		t.Fatalf("upload with storage down behind the limiter = %d, want 503", resp.StatusCode)
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"sync"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// fairQueue - черга відправки chunks, яка видає їх по одному від кожного
+// власника по колу, а не в порядку надходження, щоб велике завантаження
+// одного ключа не займало всі workers. Кожен власник тримає в черзі не більше
+// perOwner chunks кожного пріоритету: поки його місця зайняті, чекає лише
+// він, а не інші ключі. Chunks з вищим пріоритетом (db.Chunk.Priority)
+// видаються раніше за всі chunks з нижчим
+type fairQueue struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	perOwner int
+	chunks   map[queueSlot][]*db.Chunk
+	// owners - для кожного пріоритету, від найвищого, власники з chunks
+	// у черзі в порядку обслуговування
+	owners [priorityLanes][]string
+	size   int
+	closed bool
+}
+
+// priorityLanes - кількість пріоритетів, від db.PriorityHigh до db.PriorityLow
+const priorityLanes = db.PriorityHigh - db.PriorityLow + 1
+
+// queueSlot - chunks одного власника з одним пріоритетом
+type queueSlot struct {
+	lane  int
+	owner string
+}
+
+// priorityLane повертає номер пріоритету в черзі, 0 - найвищий
+func priorityLane(priority int) int {
+	return db.PriorityHigh - min(max(priority, db.PriorityLow), db.PriorityHigh)
+}
+
+func newFairQueue(perOwner int) *fairQueue {
+	q := &fairQueue{perOwner: perOwner, chunks: map[queueSlot][]*db.Chunk{}}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push ставить chunk власника owner у чергу, чекаючи, поки в нього звільниться місце
+func (q *fairQueue) push(owner string, chunk *db.Chunk) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	slot := queueSlot{lane: priorityLane(chunk.Priority), owner: owner}
+	for len(q.chunks[slot]) >= q.perOwner && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		panic("push to a closed upload queue")
+	}
+	if len(q.chunks[slot]) == 0 {
+		q.owners[slot.lane] = append(q.owners[slot.lane], owner)
+	}
+	q.chunks[slot] = append(q.chunks[slot], chunk)
+	q.size++
+	q.cond.Broadcast()
+}
+
+// pop повертає наступний chunk, чекаючи, поки він з'явиться.
+// false означає, що черга закрита і порожня
+func (q *fairQueue) pop() (*db.Chunk, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for q.size == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.size == 0 {
+		return nil, false
+	}
+
+	lane := 0
+	for len(q.owners[lane]) == 0 {
+		lane++
+	}
+	slot := queueSlot{lane: lane, owner: q.owners[lane][0]}
+	q.owners[lane] = q.owners[lane][1:]
+	chunk := q.chunks[slot][0]
+	if rest := q.chunks[slot][1:]; len(rest) > 0 {
+		q.chunks[slot] = rest
+		q.owners[lane] = append(q.owners[lane], slot.owner)
+	} else {
+		delete(q.chunks, slot)
+	}
+	q.size--
+	q.cond.Broadcast()
+	return chunk, true
+}
+
+// close не дає ставити нові chunks; ті, що вже в черзі, ще видаються
+func (q *fairQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// len повертає кількість chunks у черзі
+func (q *fairQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.size
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestFairQueueDoesNotStarveLightKey(t *testing.T) {
+	q := newFairQueue(5)
+
+	// важкий ключ займає всі свої місця раніше за легкий, але легкий
+	// однаково ставить chunks без очікування
+	for position := 1; position <= 5; position++ {
+		q.push("heavy", &db.Chunk{FileID: 1, Position: position})
+	}
+	q.push("light", &db.Chunk{FileID: 2, Position: 1})
+	q.push("light", &db.Chunk{FileID: 2, Position: 2})
+	q.close()
+
+	var order []uint
+	for {
+		chunk, ok := q.pop()
+		if !ok {
+			break
+		}
+		order = append(order, chunk.FileID)
+	}
+
+	want := []uint{1, 2, 1, 2, 1, 1, 1}
+	if len(order) != len(want) {
+		t.Fatalf("popped %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("popped %v, want %v", order, want)
+		}
+	}
+}
+
+func TestFairQueuePriority(t *testing.T) {
+	q := newFairQueue(5)
+
+	// low поставлено раніше, але high видається першим
+	q.push("a", &db.Chunk{FileID: 1, Priority: db.PriorityLow})
+	q.push("a", &db.Chunk{FileID: 2})
+	q.push("b", &db.Chunk{FileID: 3, Priority: db.PriorityHigh})
+	q.close()
+
+	var order []uint
+	for {
+		chunk, ok := q.pop()
+		if !ok {
+			break
+		}
+		order = append(order, chunk.FileID)
+	}
+
+	want := []uint{3, 2, 1}
+	if len(order) != len(want) {
+		t.Fatalf("popped %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("popped %v, want %v", order, want)
+		}
+	}
+}
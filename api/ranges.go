@@ -0,0 +1,54 @@
+package api
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// parseRange розбирає заголовок Range з одним діапазоном байтів
+// (bytes=start-end, bytes=start- або bytes=-suffix) для файлу розміром size.
+// ok == false означає, що заголовок треба ігнорувати і віддати весь файл
+func parseRange(header string, size int64) (start, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" {
+		// останні suffix байтів
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix < 0 {
+			return 0, 0, false, nil
+		}
+		if suffix == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		return max(size-suffix, 0), size - 1, true, nil
+	}
+
+	start, err = strconv.ParseInt(first, 10, 64)
+	if err != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	end = size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false, nil
+		}
+		end = min(end, size-1)
+	}
+
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	return start, end, true, nil
+}
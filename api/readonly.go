@@ -0,0 +1,35 @@
+package api
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// rejectWrites відхиляє з 403 запити, що змінюють дані, коли сервер
+// працює в режимі READ_ONLY (міграція, заморожений набір файлів)
+func (a *API) rejectWrites(c *fiber.Ctx) error {
+	if mutatingRequest(c) {
+		return fiber.NewError(fiber.StatusForbidden, "server is read-only")
+	}
+	return c.Next()
+}
+
+// mutatingRequest визначає за методом і шляхом, чи змінює запит дані
+func mutatingRequest(c *fiber.Ctx) bool {
+	path := c.Path()
+	switch c.Method() {
+	case fiber.MethodGet:
+		// GET, який створює новий ключ
+		return path == "/get_api_key"
+	case fiber.MethodPost:
+		// перевірка завантаження наперед і звірка файлу зі сховищем нічого не змінюють
+		if path == "/upload/validate" {
+			return false
+		}
+		return !(strings.HasPrefix(path, "/files/") && strings.HasSuffix(path, "/verify"))
+	case fiber.MethodPut, fiber.MethodPatch, fiber.MethodDelete:
+		return true
+	}
+	return false
+}
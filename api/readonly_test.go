@@ -0,0 +1,61 @@
+package api
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestReadOnly(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ReadOnly = true
+		cfg.AdminToken = "admin"
+	})
+	fileID := storeFile(t, a, storage, key, "frozen.txt", []byte("data"))
+	file := fmt.Sprintf("/files/%d", fileID)
+
+	tests := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/files", 200},
+		{"GET", file, 200},
+		{"GET", fmt.Sprintf("/download/%d", fileID), 200},
+		{"POST", file + "/verify", 200},
+		{"GET", "/get_api_key", 403},
+		{"DELETE", file, 403},
+		{"PATCH", file, 403},
+		{"DELETE", "/api_key", 403},
+		{"POST", "/uploads", 403},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("X-Admin-Token", "admin")
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.want {
+			t.Errorf("%s %s status = %d, want %d", tt.method, tt.path, resp.StatusCode, tt.want)
+		}
+	}
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "new.txt", []byte("new")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 403 {
+		t.Fatalf("upload status = %d, want 403", resp.StatusCode)
+	}
+	if _, err := a.db.GetAPIKey(key); err != nil {
+		t.Fatalf("key was revoked in read-only mode: %v", err)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v, want only the frozen file", files, err)
+	}
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+var errInvalidResumeToken = errors.New("invalid resume token")
+
+// interruptedError - читання тіла обірвалось, але вже прийняті chunks лишаються,
+// тому завантаження можна продовжити
+type interruptedError struct {
+	err error
+}
+
+func (e *interruptedError) Error() string { return e.err.Error() }
+func (e *interruptedError) Unwrap() error { return e.err }
+
+// interruptUpload перетворює помилку читання тіла у відповідь клієнту.
+// Перевищення ліміту розміру повториться і при продовженні, тому воно остаточне
+func interruptUpload(err error) error {
+	if errors.Is(err, errUploadTooLarge) {
+		return uploadError(err)
+	}
+	return &interruptedError{err: uploadError(err)}
+}
+
+// resumableError відповідає на обірване завантаження токеном, з яким клієнт
+// може продовжити його з першого непідтвердженого байта
+func (a *API) resumableError(key string, fileID uint, confirmed int, interrupted *interruptedError) error {
+	status := fiber.StatusBadRequest
+	var fiberErr *fiber.Error
+	if errors.As(interrupted.err, &fiberErr) {
+		status = fiberErr.Code
+	}
+
+	log.Warn().Err(interrupted.err).
+		Uint("fileID", fileID).
+		Int("confirmed", confirmed).
+		Msg("завантаження обірвано, можна продовжити")
+	return &responseError{status: status, body: UploadInterrupted{
+		Error:        interrupted.Error(),
+		ResumeToken:  a.resumeToken(key, fileID, confirmed),
+		ResumeOffset: int64(confirmed) * int64(a.chunkSize),
+	}}
+}
+
+// resumeSecret повертає ключ для підпису токенів. Без RESUME_SECRET ключ
+// випадковий, і токени діють лише до перезапуску сервера
+func resumeSecret(configured string) []byte {
+	if configured != "" {
+		return []byte(configured)
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+	return secret
+}
+
+// resumeToken кодує id файлу і останню підтверджену позицію, підписані разом
+// з ключем власника, тому чужий або змінений токен не пройде перевірку
+func (a *API) resumeToken(key string, fileID uint, confirmed int) string {
+	payload := fmt.Sprintf("%d.%d", fileID, confirmed)
+	return payload + "." + a.resumeSignature(key, payload)
+}
+
+func (a *API) resumeSignature(key, payload string) string {
+	mac := hmac.New(sha256.New, a.resumeSecret)
+	mac.Write([]byte(key + "|" + payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// parseResumeToken перевіряє підпис токена і повертає id файлу і підтверджену позицію
+func (a *API) parseResumeToken(key, token string) (uint, int, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, 0, errInvalidResumeToken
+	}
+	payload := parts[0] + "." + parts[1]
+	if !hmac.Equal([]byte(parts[2]), []byte(a.resumeSignature(key, payload))) {
+		return 0, 0, errInvalidResumeToken
+	}
+
+	fileID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, errInvalidResumeToken
+	}
+	confirmed, err := strconv.Atoi(parts[1])
+	if err != nil || confirmed < 0 {
+		return 0, 0, errInvalidResumeToken
+	}
+	return uint(fileID), confirmed, nil
+}
+
+// handleResumeUpload продовжує обірване завантаження: тіло - такий самий multipart,
+// як для /upload, але з даними файлу від resume_offset
+func (a *API) handleResumeUpload(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	fileID, confirmed, err := a.parseResumeToken(key, c.Get("X-Resume-Token"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	file, err := a.db.GetFileByID(fileID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "file not found")
+	}
+	if err != nil {
+		log.Err(err).Msg("помилка отримання фалу з бази")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to get file")
+	}
+	if file.Status != "uploading" {
+		return fiber.NewError(fiber.StatusConflict, "upload can no longer be resumed")
+	}
+
+	priority, err := uploadPriority(c)
+	if err != nil {
+		return err
+	}
+	mr, stopDeadline, err := a.multipartReader(c)
+	if err != nil {
+		return err
+	}
+	defer stopDeadline()
+
+	defer a.updateKeyUsage(key)
+	var timings UploadTimings
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "file part is required")
+		}
+		if part.FormName() != "file" {
+			continue
+		}
+		declared := int64(unknownUploadSize)
+		if file.DeclaredSize != nil {
+			declared = *file.DeclaredSize
+		}
+		if err := a.receiveFile(key, fileID, part, confirmed, declared, priority, &timings, nil); err != nil {
+			return err
+		}
+		return a.uploadAccepted(c, timings)
+	}
+}
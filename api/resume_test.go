@@ -0,0 +1,222 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestResumeInterruptedUpload(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	data := bytes.Repeat([]byte("x"), config.DefaultChunkSize+1000)
+
+	// клієнт встиг відправити перший chunk і ще 100 байтів
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data[:config.DefaultChunkSize+100])
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("interrupted upload status = %d, want 400", resp.StatusCode)
+	}
+	var interrupted UploadInterrupted
+	if err := json.NewDecoder(resp.Body).Decode(&interrupted); err != nil {
+		t.Fatal(err)
+	}
+	if interrupted.ResumeToken == "" || interrupted.ResumeOffset != config.DefaultChunkSize {
+		t.Fatalf("interrupted = %+v", interrupted)
+	}
+
+	resume := func(key, token string, rest []byte) int {
+		req := newUploadRequest(t, key, "big.bin", rest)
+		req.RequestURI = "/upload/resume"
+		req.Header.Set("X-Resume-Token", token)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	// токен прив'язаний до ключа і не підробляється
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := resume(otherKey, interrupted.ResumeToken, nil); status != 400 {
+		t.Fatalf("resume with another key status = %d, want 400", status)
+	}
+	if status := resume(key, "1.5."+interrupted.ResumeToken[4:], nil); status != 400 {
+		t.Fatalf("resume with forged token status = %d, want 400", status)
+	}
+
+	if status := resume(key, interrupted.ResumeToken, data[interrupted.ResumeOffset:]); status != 202 {
+		t.Fatalf("resume status = %d, want 202", status)
+	}
+
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Size != int64(len(data)) || files[0].TotalChunks != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+	chunks := sortedChunks(waitForChunks(t, a, files[0].ID, 2))
+	waitForStatus(t, a, files[0].ID, "completed")
+	if positions := chunkPositions(chunks); !slices.Equal(positions, []int{1, 2}) {
+		t.Fatalf("positions = %v", positions)
+	}
+	if chunks[0].Size != config.DefaultChunkSize || chunks[1].Size != 1000 {
+		t.Fatalf("chunk sizes = %d, %d", chunks[0].Size, chunks[1].Size)
+	}
+
+	// завершене завантаження продовжити вже не можна
+	if status := resume(key, interrupted.ResumeToken, data[interrupted.ResumeOffset:]); status != 409 {
+		t.Fatalf("second resume status = %d, want 409", status)
+	}
+}
+
+func TestUploadInterruptedBeforeFirstChunkFails(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) { cfg.AbortedUploadPolicy = config.AbortedUploadFail })
+
+	// тіло обривається посеред першого chunk, без закриваючого boundary
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "cut.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(bytes.Repeat([]byte("x"), 1000))
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+
+	resp, err := a.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	var interrupted UploadInterrupted
+	json.NewDecoder(resp.Body).Decode(&interrupted)
+	if interrupted.ResumeToken != "" {
+		t.Fatal("got a resume token for an upload without accepted chunks")
+	}
+
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Status != "failed" {
+		t.Fatalf("files = %+v, want one failed file", files)
+	}
+	chunks, err := a.db.GetChunksByFileID(files[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.queue.len() != 0 || len(chunks) != 0 || len(storage.names) != 0 {
+		t.Fatal("partial chunk was queued")
+	}
+}
+
+func TestUploadDisconnectedBeforeFirstChunkDeleted(t *testing.T) {
+	for name, body := range map[string]string{
+		// клієнт відключився, не почавши частину file
+		"before file part": "--cut\r\nContent-Disposition: form-da",
+		// клієнт відключився посеред першого chunk
+		"inside first chunk": "--cut\r\nContent-Disposition: form-data; name=\"file\"; filename=\"cut.bin\"\r\n\r\n" +
+			strings.Repeat("x", 1000),
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, _, key := newTestAPI(t)
+
+			req := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+			req.Header.Set("Content-Type", "multipart/form-data; boundary=cut")
+			req.Header.Set("X-API-Key", key)
+			resp, err := a.app.Test(req, -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != 0 {
+				t.Fatalf("files = %+v, want no placeholder left", files)
+			}
+		})
+	}
+}
+
+func TestInterruptedUploadListedAsFailed(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) { cfg.AbortedUploadPolicy = config.AbortedUploadFail })
+	storeFile(t, a, storage, key, "done.txt", []byte("done"))
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", "cut.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("no closing boundary"))
+	req := httptest.NewRequest("POST", "/upload", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("X-API-Key", key)
+	if _, err := a.app.Test(req, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(query string) (int, []string) {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/files"+query, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var listed struct {
+			Files []db.File `json:"files"`
+		}
+		json.NewDecoder(resp.Body).Decode(&listed)
+		var names []string
+		for _, file := range listed.Files {
+			names = append(names, file.FileName)
+		}
+		return resp.StatusCode, names
+	}
+
+	if _, names := list("?status=failed"); len(names) != 1 || names[0] != "" {
+		t.Fatalf("failed files = %q, want the interrupted upload", names)
+	}
+	if _, names := list("?status=uploading"); len(names) != 0 {
+		t.Fatalf("uploading files = %q, want none", names)
+	}
+	if _, names := list("?status=completed"); len(names) != 1 || names[0] != "done.txt" {
+		t.Fatalf("completed files = %q", names)
+	}
+	if status, _ := list("?status=broken"); status != 400 {
+		t.Fatalf("unknown status = %d, want 400", status)
+	}
+}
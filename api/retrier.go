@@ -0,0 +1,90 @@
+package api
+
+import (
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	retryBaseDelay = time.Minute
+	retryMaxDelay  = time.Hour
+	// retryBatchSize - скільки задач retrier обробляє за один запуск
+	retryBatchSize = 20
+)
+
+// retryBackoff повертає паузу перед наступною спробою: хвилина, яка
+// подвоюється з кожною невдалою спробою, але не більше години
+func retryBackoff(attempts int) time.Duration {
+	delay := retryBaseDelay
+	for i := 0; i < attempts && delay < retryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, retryMaxDelay)
+}
+
+// retryFailedChunks повторно відправляє chunks з черги повторів, час яких настав
+func (a *API) retryFailedChunks() error {
+	tasks, err := a.db.DueRetries(a.clock.Now(), retryBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i := range tasks {
+		task := &tasks[i]
+		chunk, err := a.db.GetChunkByID(task.ChunkID)
+		if err != nil {
+			log.Err(err).Uint("chunkID", task.ChunkID).Msg("chunk з черги повторів не знайдено")
+			if err := a.db.DeleteRetry(task.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		chunk.Data = task.Data
+		telegramFileID, err := a.sendChunk(&chunk, a.chunkCaption(&chunk))
+		chunk.Data = nil
+		if err == nil {
+			chunk.TelegramFileID = telegramFileID
+			chunk.StoredSize = int64(len(task.Data))
+			chunk.Status = "completed"
+			if err := a.db.AddChunkToFile(&chunk); err != nil {
+				return err
+			}
+			if err := a.db.DeleteRetry(task.ID); err != nil {
+				return err
+			}
+			a.recomputeFileStatus(chunk.FileID)
+			log.Info().
+				Uint("fileID", chunk.FileID).
+				Int("position", chunk.Position).
+				Int("attempts", task.Attempts+1).
+				Msg("chunk відправлено з черги повторів")
+			continue
+		}
+
+		task.Attempts++
+		if err := a.db.AddChunkToFile(&chunk); err != nil {
+			return err
+		}
+		if !tgbot.ClassifyError(err).Retryable() || task.Attempts >= a.config.RetryMaxAttempts {
+			log.Err(err).
+				Uint("fileID", chunk.FileID).
+				Int("position", chunk.Position).
+				Int("attempts", task.Attempts).
+				Msg("chunk не вдалося відправити, прибираємо з черги повторів")
+			if err := a.db.DeleteRetry(task.ID); err != nil {
+				return err
+			}
+			a.recomputeFileStatus(chunk.FileID)
+			continue
+		}
+
+		task.NextAttemptAt = a.clock.Now().Add(retryBackoff(task.Attempts))
+		if err := a.db.SaveRetry(task); err != nil {
+			return err
+		}
+	}
+	return nil
+}
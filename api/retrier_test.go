@@ -0,0 +1,115 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+)
+
+func TestRetryQueueRecoversAfterOutage(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.RetryQueue = true
+		cfg.RetryMaxAttempts = 5
+	})
+	fake := a.clock.(*clock.Fake)
+
+	fileID, err := a.db.CreateNewFile("outage.bin", 4, db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// телеграм недоступний: in-line повтори не допомагають
+	storage.sendErr = &tgbot.HTTPStatusError{StatusCode: 502, Status: "502 Bad Gateway"}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "failed" {
+		t.Fatalf("status = %q, want failed", chunk.Status)
+	}
+
+	// збій ще триває: спроба не вдається і відкладається на довше
+	fake.Advance(retryBackoff(0))
+	if err := a.retryFailedChunks(); err != nil {
+		t.Fatal(err)
+	}
+	tasks, err := a.db.DueRetries(fake.Now().Add(retryBackoff(1)), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].Attempts != 1 {
+		t.Fatalf("tasks = %+v", tasks)
+	}
+
+	// телеграм відновився, але час наступної спроби ще не настав
+	storage.sendErr = nil
+	if err := a.retryFailedChunks(); err != nil {
+		t.Fatal(err)
+	}
+	if chunk, _ := a.db.GetChunk(fileID, 1); chunk.Status != "failed" {
+		t.Fatalf("chunk retried before its backoff, status %q", chunk.Status)
+	}
+
+	fake.Advance(retryBackoff(1))
+	if err := a.retryFailedChunks(); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk, err = a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "completed" || string(storage.files[chunk.TelegramFileID]) != "data" {
+		t.Fatalf("chunk = status %q, id %q", chunk.Status, chunk.TelegramFileID)
+	}
+	tasks, err = a.db.DueRetries(fake.Now().Add(24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("retry queue still has %d tasks", len(tasks))
+	}
+}
+
+func TestRetryQueueGivesUp(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.RetryQueue = true
+		cfg.RetryMaxAttempts = 1
+	})
+	fake := a.clock.(*clock.Fake)
+	storage.sendErr = &tgbot.HTTPStatusError{StatusCode: 502, Status: "502 Bad Gateway"}
+
+	fileID, err := a.db.CreateNewFile("outage.bin", 4, db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	fake.Advance(retryBackoff(0))
+	if err := a.retryFailedChunks(); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := a.db.DueRetries(fake.Now().Add(24*time.Hour), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 0 {
+		t.Fatalf("retry queue still has %d tasks after the last attempt", len(tasks))
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	if retryBackoff(0) != time.Minute || retryBackoff(2) != 4*time.Minute {
+		t.Fatalf("backoff = %v, %v", retryBackoff(0), retryBackoff(2))
+	}
+	if retryBackoff(100) != time.Hour {
+		t.Fatalf("backoff is not capped: %v", retryBackoff(100))
+	}
+}
@@ -0,0 +1,65 @@
+package api
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/rs/zerolog/log"
+)
+
+// scheduler запускає періодичні фонові задачі (janitor, reaper)
+type scheduler struct {
+	clock clock.Clock
+	jobs  []job
+	stop  chan struct{}
+	wg    sync.WaitGroup
+}
+
+type job struct {
+	name     string
+	interval time.Duration
+	run      func() error
+}
+
+func newScheduler(c clock.Clock) *scheduler {
+	return &scheduler{clock: c, stop: make(chan struct{})}
+}
+
+// add реєструє задачу, interval <= 0 вимикає її
+func (s *scheduler) add(name string, interval time.Duration, run func() error) {
+	if interval <= 0 {
+		log.Info().Str("job", name).Msg("фонову задачу вимкнено")
+		return
+	}
+	s.jobs = append(s.jobs, job{name: name, interval: interval, run: run})
+}
+
+func (s *scheduler) start() {
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(j, s.clock.NewTicker(j.interval))
+	}
+}
+
+func (s *scheduler) loop(j job, ticker clock.Ticker) {
+	defer s.wg.Done()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C():
+			if err := j.run(); err != nil {
+				log.Err(err).Str("job", j.name).Msg("помилка фонової задачі")
+			}
+		}
+	}
+}
+
+// Stop зупиняє всі задачі і чекає завершення поточних запусків
+func (s *scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+)
+
+func TestSchedulerCadence(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	s := newScheduler(fake)
+
+	runs := make(chan struct{}, 10)
+	s.add("sweep", 5*time.Minute, func() error {
+		runs <- struct{}{}
+		return nil
+	})
+	s.add("disabled", 0, func() error {
+		t.Error("disabled job ran")
+		return nil
+	})
+	s.start()
+	defer s.Stop()
+
+	expectRuns := func(want int) {
+		t.Helper()
+		got := 0
+		timeout := time.After(100 * time.Millisecond)
+		for {
+			select {
+			case <-runs:
+				got++
+			case <-timeout:
+				if got != want {
+					t.Fatalf("got %d runs, want %d", got, want)
+				}
+				return
+			}
+		}
+	}
+
+	fake.Advance(4 * time.Minute)
+	expectRuns(0)
+
+	fake.Advance(time.Minute)
+	expectRuns(1)
+
+	fake.Advance(5 * time.Minute)
+	expectRuns(1)
+}
@@ -0,0 +1,139 @@
+package api
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// sharedQueue - черга відправки в базі (SHARED_QUEUE). Chunks зберігаються
+// з даними як queued, і workers усіх серверів зі спільною базою забирають
+// їх через ClaimPendingChunk, тож кожен chunk відправляє лише один сервер,
+// а після перезапуску черга не губиться
+type sharedQueue struct {
+	db           *db.DataBase
+	clock        clock.Clock
+	instance     string
+	claimTimeout time.Duration
+	poll         time.Duration
+	// notify будить worker, коли цей сервер поставив chunk, не чекаючи poll
+	notify chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+func newSharedQueue(database *db.DataBase, clk clock.Clock, instance string, claimTimeout, poll time.Duration) *sharedQueue {
+	q := &sharedQueue{
+		db:           database,
+		clock:        clk,
+		instance:     instance,
+		claimTimeout: claimTimeout,
+		poll:         poll,
+		notify:       make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	// chunks, взяті цим сервером до перезапуску, вже ніхто не відправляє
+	released, err := database.ReleaseChunkClaims(instance)
+	if err != nil {
+		log.Err(err).Str("instance", instance).Msg("помилка повернення chunks у спільну чергу")
+	} else if released > 0 {
+		log.Info().Int64("chunks", released).Msg("chunks з минулого запуску повернуто в чергу")
+	}
+	return q
+}
+
+// push зберігає chunk у черзі. Після цього дані лежать у базі, тож з пам'яті їх прибрано
+func (q *sharedQueue) push(chunk *db.Chunk) error {
+	if err := q.db.QueueChunk(chunk); err != nil {
+		return err
+	}
+	chunk.Data = nil
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// pop забирає наступний chunk, чекаючи, поки він з'явиться. Після close
+// видає ще все, що лишилось у черзі, і повертає false, коли вона порожня
+func (q *sharedQueue) pop() (*db.Chunk, bool) {
+	for {
+		now := q.clock.Now()
+		chunk, err := q.db.ClaimPendingChunk(q.instance, now, now.Add(-q.claimTimeout))
+		if err == nil {
+			return &chunk, true
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Err(err).Msg("помилка отримання chunk зі спільної черги")
+		}
+
+		select {
+		case <-q.done:
+			// після close лишалось лише дочистити чергу. Якщо база недоступна,
+			// chunks у ній дочекаються іншого сервера чи перезапуску
+			return nil, false
+		default:
+		}
+
+		select {
+		case <-q.notify:
+		case <-q.done:
+		case <-time.After(q.poll):
+		}
+	}
+}
+
+// hold не дає chunk стати покинутим, поки його обробляє цей сервер:
+// відправка з повторами може тривати довше за claimTimeout, і тоді chunk
+// забрав би й відправив ще раз інший сервер. Повертає функцію, яка зупиняє
+// продовження після обробки
+func (q *sharedQueue) hold(chunk *db.Chunk) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	// ticker створюється до повернення, щоб відлік ішов від початку відправки
+	ticker := q.clock.NewTicker(q.claimTimeout / 3)
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C():
+				held, err := q.db.RenewChunkClaim(chunk.ID, q.instance, q.clock.Now())
+				if err != nil {
+					log.Err(err).Uint("chunkID", chunk.ID).Msg("помилка продовження chunk у спільній черзі")
+					continue
+				}
+				if !held {
+					// chunk уже збережено або, якщо продовжити не встигли, забрано іншим сервером
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// close будить workers, щоб вони дочистили чергу і завершились
+func (q *sharedQueue) close() {
+	q.once.Do(func() { close(q.done) })
+}
+
+// len повертає кількість chunks, які ще ніхто не взяв
+func (q *sharedQueue) len() int {
+	count, err := q.db.CountQueuedChunks()
+	if err != nil {
+		log.Err(err).Msg("помилка підрахунку chunks у спільній черзі")
+	}
+	return int(count)
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// newSharedInstance створює сервер instance зі спільною чергою в базі path
+func newSharedInstance(t *testing.T, path, instance string, storage *fakeStorage) *API {
+	t.Helper()
+
+	database, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{
+		ChunkSize:         1024,
+		SharedQueue:       true,
+		InstanceID:        instance,
+		QueueClaimTimeout: time.Minute,
+		QueuePollInterval: 10 * time.Millisecond,
+	}
+	a := newAPI(cfg, storage, database, clock.NewFake(time.Now()), nil)
+	t.Cleanup(func() {
+		a.Stop(context.Background())
+	})
+	return a
+}
+
+func TestSharedQueueAcrossInstances(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	storage := newFakeStorage()
+	first := newSharedInstance(t, path, "a", storage)
+	second := newSharedInstance(t, path, "b", storage)
+
+	key, err := first.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 8*1024)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	resp, err := first.app.Test(newUploadRequest(t, key, "big.bin", data), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+
+	files, err := second.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	waitForStatus(t, second, files[0].ID, "completed")
+
+	// кожен chunk відправлено рівно раз, хоч би який сервер його забрав
+	if len(storage.names) != 8 {
+		t.Fatalf("sent %d chunks, want 8", len(storage.names))
+	}
+	chunks, err := second.db.GetChunksByFileID(files[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range chunks {
+		if chunk.Data != nil || chunk.ClaimedBy == "" {
+			t.Fatalf("chunk %d still has data or was never claimed: %+v", chunk.Position, chunk)
+		}
+	}
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", files[0].ID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err = second.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(downloaded, data) {
+		t.Fatal("downloaded file differs from the uploaded one")
+	}
+}
+
+func TestSharedQueueSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	database, err := db.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileID, err := database.CreateNewFile("left.bin", 4, db.HashKey("key"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateFileStatus(fileID, "processing"); err != nil {
+		t.Fatal(err)
+	}
+	// chunk, який сервер "a" взяв, але впав, не встигнувши відправити
+	chunk := db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("left")}
+	if err := database.QueueChunk(&chunk); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := database.ClaimPendingChunk("a", now, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	storage := newFakeStorage()
+	a := newSharedInstance(t, path, "a", storage)
+	waitForStatus(t, a, fileID, "completed")
+	if len(storage.names) != 1 {
+		t.Fatalf("sent %d chunks, want 1", len(storage.names))
+	}
+}
+
+// stalledStorage тримає кожну відправку, поки тест не відкриє gate,
+// і рахує, скільки відправок почалось
+type stalledStorage struct {
+	*fakeStorage
+	gate    chan struct{}
+	entered atomic.Int32
+}
+
+func (s *stalledStorage) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	s.entered.Add(1)
+	<-s.gate
+	return s.fakeStorage.SendFileMessage(fileName, data, caption)
+}
+
+func TestSharedQueueHoldsClaimDuringSlowSend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared.db")
+	fake := clock.NewFake(time.Now())
+	storage := &stalledStorage{fakeStorage: newFakeStorage(), gate: make(chan struct{})}
+	var instances []*API
+	for _, instance := range []string{"a", "b"} {
+		database, err := db.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cfg := config.Config{
+			ChunkSize:         1024,
+			SharedQueue:       true,
+			InstanceID:        instance,
+			QueueClaimTimeout: time.Minute,
+			QueuePollInterval: 10 * time.Millisecond,
+		}
+		instances = append(instances, newAPI(cfg, storage, database, fake, nil))
+	}
+	t.Cleanup(func() {
+		close(storage.gate)
+		for _, a := range instances {
+			a.Stop(context.Background())
+		}
+	})
+
+	a := instances[0]
+	fileID, err := a.db.CreateNewFile("slow.bin", 4, db.HashKey("key"), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunk := db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("slow")}
+	if err := a.db.QueueChunk(&chunk); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return storage.entered.Load() == 1 })
+
+	// відправка триває вдвічі довше за QUEUE_CLAIM_TIMEOUT, але claim продовжується
+	for range 6 {
+		fake.Advance(20 * time.Second)
+		now := fake.Now()
+		waitFor(t, func() bool {
+			chunks, err := a.db.GetChunksByFileID(fileID)
+			return err == nil && len(chunks) == 1 && chunks[0].ClaimedAt != nil && chunks[0].ClaimedAt.Equal(now)
+		})
+	}
+	time.Sleep(50 * time.Millisecond)
+	if entered := storage.entered.Load(); entered != 1 {
+		t.Fatalf("chunk sent %d times while its claim was held", entered)
+	}
+}
+
+// waitFor чекає, поки ready стане true
+func waitFor(t *testing.T, ready func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !ready() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition was not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
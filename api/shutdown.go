@@ -0,0 +1,95 @@
+package api
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// shutdown - стан зупинки сервера. Запити, що змінюють дані (і можуть ставити
+// chunks у чергу), рахуються, щоб черга закрилась лише після останнього з них
+type shutdown struct {
+	mu       sync.RWMutex
+	stopping bool
+	writes   sync.WaitGroup
+	once     sync.Once
+}
+
+// trackWrites пропускає POST, PUT і PATCH, поки сервер не зупиняється,
+// і рахує їх до завершення. Після Stop такі запити отримують 503
+func (a *API) trackWrites(c *fiber.Ctx) error {
+	switch c.Method() {
+	case fiber.MethodPost, fiber.MethodPut, fiber.MethodPatch:
+	default:
+		return c.Next()
+	}
+
+	a.shutdown.mu.RLock()
+	if a.shutdown.stopping {
+		a.shutdown.mu.RUnlock()
+		return fiber.NewError(fiber.StatusServiceUnavailable, "server is shutting down")
+	}
+	a.shutdown.writes.Add(1)
+	a.shutdown.mu.RUnlock()
+
+	defer a.shutdown.writes.Done()
+	return c.Next()
+}
+
+// Stop перестає приймати завантаження, чекає на вже розпочаті, а потім
+// закриває чергу і чекає, поки workers відправлять усі chunks з неї.
+// Якщо ctx скінчився раніше, повертає його помилку, не чекаючи далі
+func (a *API) Stop(ctx context.Context) error {
+	a.shutdown.mu.Lock()
+	a.shutdown.stopping = true
+	a.shutdown.mu.Unlock()
+
+	if err := waitContext(ctx, &a.shutdown.writes); err != nil {
+		log.Warn().Err(err).Msg("не дочекались завершення завантажень")
+		return err
+	}
+
+	a.shutdown.once.Do(func() {
+		a.queue.close()
+		if a.shared != nil {
+			a.shared.close()
+		}
+		a.scheduler.Stop()
+	})
+	if err := waitContext(ctx, &a.workers); err != nil {
+		log.Warn().Err(err).Int("queued", a.queuedChunks()).Msg("не дочекались відправки chunks з черги")
+		return err
+	}
+	log.Info().Msg("черга відправки порожня")
+	return nil
+}
+
+// queuedChunks повертає кількість chunks, що чекають на відправку
+func (a *API) queuedChunks() int {
+	if a.shared != nil {
+		return a.shared.len()
+	}
+	return a.queue.len()
+}
+
+// Shutdown зупиняє http сервер, дочекавшись відповідей на поточні запити
+func (a *API) Shutdown(ctx context.Context) error {
+	return a.app.ShutdownWithContext(ctx)
+}
+
+// waitContext чекає на wg, але не довше, ніж живе ctx
+func waitContext(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestStopDrainsQueue(t *testing.T) {
+	a, _, key := newTestAPI(t)
+
+	fileID, err := a.db.CreateNewFile("queued.bin", 6, db.HashKey(key), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.enqueue(key, &db.Chunk{FileID: fileID, Position: 1, Size: 3, Data: []byte("abc")}, nil)
+	a.enqueue(key, &db.Chunk{FileID: fileID, Position: 2, Size: 3, Data: []byte("def")}, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 2 {
+		t.Fatalf("%d chunks persisted before Stop returned, want 2", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if chunk.Status != "completed" {
+			t.Fatalf("chunk %d status = %q", chunk.Position, chunk.Status)
+		}
+	}
+
+	// нові завантаження вже не приймаються
+	resp, err := a.app.Test(newUploadRequest(t, key, "late.bin", []byte("late")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 {
+		t.Fatalf("upload after Stop status = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestWorkersPersistAllChunks(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.UploadWorkers = workers
+			})
+
+			const count = 20
+			fileID, err := a.db.CreateNewFile("many.bin", count, db.HashKey(key), count)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for position := 1; position <= count; position++ {
+				a.enqueue(key, &db.Chunk{FileID: fileID, Position: position, Size: 1, Data: []byte{byte(position)}}, nil)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			if err := a.Stop(ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			chunks, err := a.db.GetChunksByFileID(fileID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != count {
+				t.Fatalf("%d chunks persisted, want %d", len(chunks), count)
+			}
+			for i, chunk := range chunks {
+				if chunk.Position != i+1 || chunk.Status != "completed" {
+					t.Fatalf("chunk %d: position %d, status %q", i, chunk.Position, chunk.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/rs/zerolog/log"
+)
+
+// sendChunk відправляє chunk у сховище. Якщо chunk більший за MaxPartSize
+// (наприклад, через неправильне налаштування), він ділиться на частини,
+// id яких записуються в SubParts, а повертається id першої частини.
+// Id повідомлень записуються в MessageID і SubPartMessages
+func (a *API) sendChunk(chunk *db.Chunk, caption string) (string, error) {
+	limit := int(a.config.MaxPartSize)
+	if limit <= 0 || len(chunk.Data) <= limit {
+		id, messageID, err := a.sendWithRetry(chunk, chunk.Data, caption)
+		chunk.MessageID = messageID
+		return id, err
+	}
+
+	log.Warn().
+		Uint("fileID", chunk.FileID).
+		Int("position", chunk.Position).
+		Int("size", len(chunk.Data)).
+		Int("limit", limit).
+		Msg("chunk більший за ліміт сховища, ділимо на частини")
+
+	parts := make([]string, 0, (len(chunk.Data)+limit-1)/limit)
+	messages := make([]int, 0, cap(parts))
+	for start := 0; start < len(chunk.Data); start += limit {
+		end := min(start+limit, len(chunk.Data))
+		id, messageID, err := a.sendWithRetry(chunk, chunk.Data[start:end], caption)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, id)
+		messages = append(messages, messageID)
+	}
+	chunk.SubParts = parts
+	chunk.SubPartMessages = messages
+	chunk.MessageID = messages[0]
+	return parts[0], nil
+}
+
+// loadChunk завантажує дані chunk зі сховища, склеюючи частини, якщо chunk ділився,
+// розшифровуючи, якщо він зашифрований, і розпаковуючи, якщо він стиснений
+func (a *API) loadChunk(chunk db.Chunk) ([]byte, error) {
+	data, err := a.loadStored(chunk)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = a.decryptChunk(chunk, data); err != nil || !chunk.Compressed {
+		return data, err
+	}
+	return decompressChunk(data, chunk.Size)
+}
+
+// loadStored завантажує chunk зі сховища у тому вигляді, в якому він там лежить
+func (a *API) loadStored(chunk db.Chunk) ([]byte, error) {
+	if len(chunk.SubParts) == 0 {
+		return a.getStored(chunk.TelegramFileID)
+	}
+
+	data := make([]byte, 0, chunk.StoredSize)
+	for _, id := range chunk.SubParts {
+		part, err := a.getStored(id)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, part...)
+	}
+	return data, nil
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"sort"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+func (a *API) handleGetFileStatus(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := a.requestDB(c).GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return dbError(err, "failed to get chunks")
+	}
+
+	failed := []ChunkStatus{}
+	for _, chunk := range chunks {
+		if chunk.Status == "failed" {
+			failed = append(failed, chunkStatus(chunk))
+		}
+	}
+	completed, err := a.requestDB(c).CountCompletedChunks(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка підрахунку chunks")
+		return dbError(err, "failed to count chunks")
+	}
+
+	status := FileStatus{
+		Status:          file.Status,
+		TotalChunks:     file.TotalChunks,
+		CompletedChunks: completed,
+		FailedChunks:    failed,
+	}
+	// поки тіло читається, TotalChunks у базі ще 0, але з оголошеного
+	// розміру вже відомо, скільки chunks буде
+	if status.TotalChunks == 0 && file.DeclaredSize != nil {
+		status.TotalChunks = int((*file.DeclaredSize + int64(a.chunkSize) - 1) / int64(a.chunkSize))
+	}
+	if status.TotalChunks > 0 {
+		progress := min(float64(completed)/float64(status.TotalChunks)*100, 100)
+		status.Progress = &progress
+		status.ETASeconds = a.uploadETA(status.TotalChunks - completed)
+	}
+	return c.JSON(status)
+}
+
+// uploadETA оцінює, за скільки секунд workers відправлять remaining chunks
+// з поточною середньою швидкістю, nil - швидкість ще невідома
+func (a *API) uploadETA(remaining int) *float64 {
+	rate := a.throughput.bytesPerSecond()
+	if remaining > 0 && rate == 0 {
+		return nil
+	}
+	eta := 0.0
+	if remaining > 0 {
+		// workers відправляють chunks паралельно, але не більше, ніж їх лишилось
+		workers := min(a.config.UploadWorkers, remaining)
+		eta = float64(remaining) * float64(a.chunkSize) / (rate * float64(workers))
+	}
+	return &eta
+}
+
+func (a *API) handleGetFileChunks(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	chunks, err := a.requestDB(c).GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return dbError(err, "failed to get chunks")
+	}
+	statuses := make([]ChunkStatus, len(chunks))
+	for i, chunk := range chunks {
+		statuses[i] = chunkStatus(chunk)
+	}
+	return c.JSON(fiber.Map{"chunks": statuses})
+}
+
+func chunkStatus(chunk db.Chunk) ChunkStatus {
+	return ChunkStatus{
+		Position:   chunk.Position,
+		Parity:     chunk.Parity,
+		Size:       chunk.Size,
+		Status:     chunk.Status,
+		RetryCount: chunk.RetryCount,
+		LastError:  chunk.LastError,
+	}
+}
+
+func sortedChunks(chunks []db.Chunk) []db.Chunk {
+	sort.Slice(chunks, func(i, j int) bool {
+		return chunks[i].Position < chunks[j].Position
+	})
+	return chunks
+}
@@ -0,0 +1,235 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// gatedStorage відправляє chunk, лише коли тест пропустить його через gate
+type gatedStorage struct {
+	*fakeStorage
+	gate chan struct{}
+}
+
+func (s *gatedStorage) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	<-s.gate
+	return s.fakeStorage.SendFileMessage(fileName, data, caption)
+}
+
+func TestFileStatusProgress(t *testing.T) {
+	a, _, key := newTestAPI(t)
+
+	fileID, err := a.db.CreateNewFile("big.bin", 0, db.HashKey(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	getStatus := func() FileStatus {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/status", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status FileStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	// тіло прочитано, але відправлено лише два chunks з трьох
+	for position := 1; position <= 2; position++ {
+		a.processChunk(&db.Chunk{FileID: fileID, Position: position, Size: 4, Data: []byte("data")})
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Parity: true, Size: 4, Data: []byte("xor!")})
+	if err := a.db.UpdateFileMetadata(fileID, "big.bin", 12, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	status := getStatus()
+	if status.Status != "processing" || status.TotalChunks != 3 || status.CompletedChunks != 2 {
+		t.Fatalf("status = %+v, want processing with 2 of 3 chunks", status)
+	}
+
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 3, Size: 4, Data: []byte("data")})
+	status = getStatus()
+	if status.Status != "completed" || status.CompletedChunks != 3 {
+		t.Fatalf("status = %+v, want completed with 3 of 3 chunks", status)
+	}
+}
+
+func TestFileStatusDeclaredSize(t *testing.T) {
+	a, _, key := newTestAPI(t, func(cfg *config.Config) { cfg.ChunkSize = 4 })
+
+	fileID, err := a.db.CreateNewFile("", 0, db.HashKey(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.db.SetFileDeclaredSize(fileID, 16); err != nil {
+		t.Fatal(err)
+	}
+	// тіло ще читається: у базі TotalChunks = 0, один chunk з чотирьох відправлено
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/status", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status FileStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.TotalChunks != 4 || status.CompletedChunks != 1 || status.Progress == nil || *status.Progress != 25 {
+		t.Fatalf("status = %+v, want 1 of 4 chunks at 25%%", status)
+	}
+}
+
+// slowStorage відправляє кожен chunk рівно за delay часу fake clock
+type slowStorage struct {
+	*fakeStorage
+	clock *clock.Fake
+	delay time.Duration
+}
+
+func (s *slowStorage) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	s.clock.Advance(s.delay)
+	return s.fakeStorage.SendFileMessage(fileName, data, caption)
+}
+
+func TestFileStatusETA(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := clock.NewFake(time.Now())
+	storage := &slowStorage{fakeStorage: newFakeStorage(), clock: fake, delay: time.Second}
+	a := newAPI(config.Config{ChunkSize: 4, UploadWorkers: 1}, storage, database, fake, nil)
+	t.Cleanup(func() { a.Stop(context.Background()) })
+
+	fileID, err := a.db.CreateNewFile("", 0, db.HashKey(key), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.db.SetFileDeclaredSize(fileID, 16); err != nil {
+		t.Fatal(err)
+	}
+	getETA := func() *float64 {
+		t.Helper()
+		req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/status", fileID), nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var status FileStatus
+		if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status.ETASeconds
+	}
+
+	// швидкість ще невідома, оцінювати нічим
+	if eta := getETA(); eta != nil {
+		t.Fatalf("eta before any chunk = %v, want none", *eta)
+	}
+
+	// 4 байти за секунду: три chunks по 4 байти, що лишились, - три секунди
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+	first := getETA()
+	if first == nil || *first != 3 {
+		t.Fatalf("eta after 1 of 4 chunks = %v, want 3s", first)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 2, Size: 4, Data: []byte("data")})
+	if second := getETA(); second == nil || *second >= *first {
+		t.Fatalf("eta after 2 of 4 chunks = %v, want less than %v", second, *first)
+	}
+}
+
+func TestUploadCompletedOnlyAfterLastChunk(t *testing.T) {
+	for _, lastFails := range []bool{false, true} {
+		t.Run(fmt.Sprintf("last fails %v", lastFails), func(t *testing.T) {
+			database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			key, err := database.NewAPIKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			storage := &gatedStorage{fakeStorage: newFakeStorage(), gate: make(chan struct{})}
+			a := newAPI(config.Config{ChunkSize: 1024}, storage, database, clock.NewFake(time.Now()), nil)
+			t.Cleanup(func() {
+				close(storage.gate)
+				a.Stop(context.Background())
+			})
+
+			resp, err := a.app.Test(newUploadRequest(t, key, "three.bin", make([]byte, 3000)), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("upload status = %d", resp.StatusCode)
+			}
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != 1 {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+			fileID := files[0].ID
+
+			// тіло вже прочитано, але в сховищі лише два chunks з трьох
+			storage.gate <- struct{}{}
+			storage.gate <- struct{}{}
+			waitForCompletedChunks(t, a, fileID, 2)
+			if file, _ := a.db.GetFileByID(fileID); file.Status != "processing" {
+				t.Fatalf("status with a chunk in flight = %q, want processing", file.Status)
+			}
+
+			want := "completed"
+			if lastFails {
+				storage.mu.Lock()
+				storage.sendErr = errors.New("storage is gone")
+				storage.mu.Unlock()
+				want = "failed"
+			}
+			storage.gate <- struct{}{}
+			waitForStatus(t, a, fileID, want)
+		})
+	}
+}
+
+// waitForCompletedChunks чекає, поки workers збережуть n chunks файлу
+func waitForCompletedChunks(t *testing.T, a *API, fileID uint, n int) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		completed, err := a.db.CountCompletedChunks(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if completed == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("completed chunks = %d, want %d", completed, n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"bufio"
+	"encoding/hex"
+	"hash"
+	"io"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// streamSender повертає бекенд для потокової відправки, якщо вона увімкнена.
+// Parity потребує даних усіх chunks, а шифрування - цілого chunk для тегу
+// GCM, тому з ними chunks завжди буферизуються. Так само й зі стисненням,
+// dedup і підписами, яким потрібні дані або checksum chunk до відправки,
+// і з MaxPartSize, меншим за chunk, бо поділ працює лише з буфером
+func (a *API) streamSender() (storage.StreamSender, bool) {
+	if !a.config.StreamUploads || a.config.Parity || a.aead != nil {
+		return nil, false
+	}
+	if a.config.CompressChunks || a.config.DedupChunks || a.config.ChunkCaptions {
+		return nil, false
+	}
+	if a.config.MaxPartSize > 0 && a.config.MaxPartSize < int64(a.chunkSize) {
+		return nil, false
+	}
+	sender, ok := a.storage.(storage.StreamSender)
+	return sender, ok
+}
+
+// streamPart відправляє файл з multipart у сховище по chunks, нумеруючи з first, прямо з потоку
+// запиту, без копії chunk у пам'яті. Повторів тут немає, бо прочитані дані
+// вже не повернути, тому помилка сховища обриває завантаження.
+// Повертає розмір файлу і позиції відправлених chunks
+func (a *API) streamPart(sender storage.StreamSender, fileID uint, filename string, part io.Reader, first int) (total int64, positions []int, err error) {
+	body := bufio.NewReaderSize(part, 64*1024)
+	// записи chunks зберігаються пачками, тож останню треба дописати за
+	// будь-якого виходу: інакше продовження не знайде вже відправлені chunks
+	batch := chunkBatch{db: a.db}
+	defer func() {
+		if flushErr := batch.flush(); flushErr != nil {
+			log.Err(flushErr).Uint("fileID", fileID).Msg("помилка збереження chunks")
+			err = fiber.NewError(fiber.StatusInternalServerError, "failed to save chunk")
+		}
+	}()
+
+	for position := first; ; position++ {
+		if _, err := body.Peek(1); err == io.EOF {
+			return total, positions, nil
+		} else if err != nil {
+			return total, positions, interruptUpload(err)
+		}
+
+		algorithm := checksum.Normalize(a.config.ChecksumAlgorithm)
+		r := &chunkReader{r: io.LimitReader(body, int64(a.chunkSize)), hash: a.newHash(algorithm)}
+		telegramFileID, messageID, err := storage.SendStream(sender, partName(filename, position, false), r, -1)
+		total += r.n
+
+		// помилка читання запиту важливіша за помилку сховища, яку вона спричинила
+		if r.err != nil {
+			return total, positions, interruptUpload(r.err)
+		}
+
+		chunk := &db.Chunk{
+			FileID:   fileID,
+			FileName: filename,
+			Position: position,
+			Size:     r.n,
+			Checksum: hex.EncodeToString(r.hash.Sum(nil)),
+		}
+		chunk.ChecksumAlgorithm = algorithm
+		if err != nil {
+			log.Err(err).
+				Uint("fileID", fileID).
+				Int("position", position).
+				Str("class", string(tgbot.ClassifyError(err))).
+				Msg("не вдалося потоково відправити chunk")
+			chunk.Status = "failed"
+			chunk.LastError = err.Error()
+		} else {
+			chunk.Status = "completed"
+			chunk.StoredSize = r.n
+			chunk.TelegramFileID = telegramFileID
+			chunk.MessageID = messageID
+		}
+
+		if err := batch.add(*chunk); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження chunks")
+			return total, positions, fiber.NewError(fiber.StatusInternalServerError, "failed to save chunk")
+		}
+		if chunk.Status == "failed" {
+			a.failFile(fileID)
+			return total, positions, fiber.NewError(fiber.StatusBadGateway, "failed to send chunk to storage")
+		}
+		positions = append(positions, position)
+	}
+}
+
+// chunkBatch накопичує нові chunks і зберігає їх у базі по db.ChunkBatchSize
+// одним запитом, а не по одному
+type chunkBatch struct {
+	db     *db.DataBase
+	chunks []db.Chunk
+}
+
+// add додає chunk і зберігає пачку, якщо вона заповнилась
+func (b *chunkBatch) add(chunk db.Chunk) error {
+	b.chunks = append(b.chunks, chunk)
+	if len(b.chunks) < db.ChunkBatchSize {
+		return nil
+	}
+	return b.flush()
+}
+
+// flush зберігає накопичені chunks
+func (b *chunkBatch) flush() error {
+	if len(b.chunks) == 0 {
+		return nil
+	}
+	err := b.db.AddChunks(b.chunks)
+	b.chunks = b.chunks[:0]
+	return err
+}
+
+func (a *API) failFile(fileID uint) {
+	if err := a.db.MarkFileFailed(fileID); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення статусу файлу")
+	}
+}
+
+// abortFile прибирає файл, клієнт якого відключився до першого chunk: за
+// ABORTED_UPLOAD_POLICY порожній запис видаляється або позначається failed
+func (a *API) abortFile(fileID uint) {
+	if a.config.AbortedUploadPolicy == config.AbortedUploadFail {
+		a.failFile(fileID)
+		return
+	}
+	if err := a.db.DeleteFile(fileID); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка видалення порожнього файлу")
+		a.failFile(fileID)
+	}
+}
+
+// chunkReader рахує прочитані байти і checksum і запам'ятовує помилку читання,
+// яку бекенд міг загорнути у свою
+type chunkReader struct {
+	r    io.Reader
+	hash hash.Hash
+	n    int64
+	err  error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	r.hash.Write(p[:n])
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
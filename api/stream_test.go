@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+)
+
+func TestStreamUpload(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.StreamUploads = true
+	})
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), config.DefaultChunkSize/16+1)
+	resp, err := a.app.Test(newUploadRequest(t, key, "big.bin", data), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if storage.streamed != 2 {
+		t.Fatalf("streamed %d chunks, want 2", storage.streamed)
+	}
+
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].TotalChunks != 2 || files[0].Size != int64(len(data)) {
+		t.Fatalf("files = %+v", files)
+	}
+
+	chunks, err := a.db.GetChunksByFileID(files[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for _, chunk := range chunks {
+		if chunk.Status != "completed" || len(chunk.Checksum) != 64 {
+			t.Fatalf("chunk %d = status %q, checksum %q", chunk.Position, chunk.Status, chunk.Checksum)
+		}
+		part, err := a.loadChunk(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, part...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("stored data differs from uploaded")
+	}
+}
+
+func TestStreamUploadFallsBackToBuffering(t *testing.T) {
+	options := map[string]func(cfg *config.Config){
+		"captions": func(cfg *config.Config) { cfg.ChunkCaptions = true },
+		"compress": func(cfg *config.Config) { cfg.CompressChunks = true },
+		"dedup":    func(cfg *config.Config) { cfg.DedupChunks = true },
+		"split":    func(cfg *config.Config) { cfg.ChunkSize = 64; cfg.MaxPartSize = 16 },
+	}
+	for name, option := range options {
+		t.Run(name, func(t *testing.T) {
+			a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.StreamUploads = true
+				option(cfg)
+			})
+
+			data := bytes.Repeat([]byte("0123456789abcdef"), 8)
+			resp, err := a.app.Test(newUploadRequest(t, key, "a.bin", data), -1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != 202 {
+				t.Fatalf("status = %d", resp.StatusCode)
+			}
+			files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+			if err != nil || len(files) != 1 {
+				t.Fatalf("files = %+v, err = %v", files, err)
+			}
+			waitForStatus(t, a, files[0].ID, "completed")
+			if storage.streamed != 0 {
+				t.Fatalf("streamed %d chunks, want them buffered", storage.streamed)
+			}
+		})
+	}
+}
+
+func TestStreamUploadStorageError(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.StreamUploads = true
+	})
+	storage.sendErr = &tgbot.HTTPStatusError{StatusCode: 502, Status: "502 Bad Gateway"}
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "a.txt", []byte("data")), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 502 {
+		t.Fatalf("status = %d %q, want 502", resp.StatusCode, body)
+	}
+
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Status != "failed" {
+		t.Fatalf("files = %+v", files)
+	}
+}
@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 type RequestNew struct {
 	Filename string
 	Size     int
@@ -12,3 +14,259 @@ type RequestSendChunk struct {
 	Key      string `json:"key"`
 	RawData  []byte
 }
+
+// FileDetails - відповідь з метаданими одного файлу
+type FileDetails struct {
+	ID          uint   `json:"id"`
+	FileName    string `json:"filename"`
+	Size        int64  `json:"size"`        // логічний розмір
+	StoredSize  int64  `json:"stored_size"` // скільки займає в сховищі
+	TotalChunks int    `json:"total_chunks"`
+	ContentType string `json:"content_type"`
+	Status      string `json:"status"`
+	Checksum    string `json:"checksum,omitempty"` // SHA-256 усього файлу
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FileChecksum - відповідь GET /files/:fileID/checksum
+type FileChecksum struct {
+	FileID    uint   `json:"file_id"`
+	Algorithm string `json:"algorithm"`
+	Checksum  string `json:"checksum"`
+}
+
+// RequestNewUpload - створення завантаження, яке клієнт сам розбив на chunks
+type RequestNewUpload struct {
+	Filename string          `json:"filename"`
+	Chunks   []ManifestChunk `json:"chunks"`
+}
+
+// ManifestChunk - опис одного chunk, порахований на стороні клієнта
+type ManifestChunk struct {
+	Position int    `json:"position"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"` // у hex, алгоритм - CHECKSUM_ALGORITHM
+}
+
+// ChunkStatus - стан одного chunk
+type ChunkStatus struct {
+	Position   int    `json:"position"`
+	Parity     bool   `json:"parity,omitempty"`
+	Size       int64  `json:"size"`
+	Status     string `json:"status"`
+	RetryCount int    `json:"retry_count"`
+	LastError  string `json:"last_error,omitempty"`
+}
+
+// FileStatus - стан завантаження файлу
+type FileStatus struct {
+	Status      string `json:"status"`
+	TotalChunks int    `json:"total_chunks"`
+	// CompletedChunks - скільки з TotalChunks уже збережено в сховищі
+	CompletedChunks int           `json:"completed_chunks"`
+	FailedChunks    []ChunkStatus `json:"failed_chunks"`
+	// Progress - відсоток збережених chunks, nil, поки їх кількість невідома
+	Progress *float64 `json:"progress,omitempty"`
+	// ETASeconds - орієнтовний час до збереження решти chunks, nil, поки
+	// невідома їх кількість або швидкість відправки
+	ETASeconds *float64 `json:"eta_seconds,omitempty"`
+}
+
+// Health - стан залежностей сервера для GET /health
+type Health struct {
+	DB      string `json:"db"`
+	Storage string `json:"storage"`
+}
+
+// значення полів Health
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// ChunkVerification - результат перевірки одного chunk у сховищі
+type ChunkVerification struct {
+	Position int    `json:"position"`
+	Parity   bool   `json:"parity,omitempty"`
+	Status   string `json:"status"` // ok/mismatch/unavailable/unverified
+	Error    string `json:"error,omitempty"`
+}
+
+// VerifyReport - результат перевірки файлу: OK, якщо жоден chunk не зіпсований
+type VerifyReport struct {
+	FileID uint                `json:"file_id"`
+	OK     bool                `json:"ok"`
+	Chunks []ChunkVerification `json:"chunks"`
+}
+
+// RequestUpdateFile - зміна метаданих файлу, порожні поля не змінюються
+type RequestUpdateFile struct {
+	ContentType string `json:"content_type"`
+	// FileName - нове ім'я файлу, nil - не змінювати
+	FileName *string `json:"filename"`
+}
+
+// RequestTransferFile - передача файлу іншому ключу. Порожній From - файл
+// відкликаного ключа, збережений за KEY_DELETION_POLICY=retain
+type RequestTransferFile struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ChunkURLs - прямі посилання на дані одного chunk. Кілька посилань, якщо chunk
+// при відправці поділено на частини (їх треба склеїти в цьому порядку)
+type ChunkURLs struct {
+	Position          int      `json:"position"`
+	Size              int64    `json:"size"`
+	Compressed        bool     `json:"compressed"` // дані стиснені zstd
+	Encrypted         bool     `json:"encrypted"`  // дані зашифровані STORAGE_KEY
+	Checksum          string   `json:"checksum"`
+	ChecksumAlgorithm string   `json:"checksum_algorithm"`
+	URLs              []string `json:"urls"`
+}
+
+// FileURLs - відповідь GET /files/:fileID/urls
+type FileURLs struct {
+	FileID    uint        `json:"file_id"`
+	ExpiresIn int         `json:"expires_in"` // скільки секунд посилання гарантовано діють
+	Chunks    []ChunkURLs `json:"chunks"`
+}
+
+// SlowUploadAlert - тіло webhook SLOW_UPLOAD_WEBHOOK про завантаження,
+// що триває довше за SLOW_UPLOAD_AFTER
+type SlowUploadAlert struct {
+	Key             string    `json:"key"` // відбиток ключа, як у метриках
+	Path            string    `json:"path"`
+	StartedAt       time.Time `json:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds"`
+}
+
+// FileAudit - файл разом з клієнтом, який його завантажив (лише для адміністратора)
+type FileAudit struct {
+	ID          uint      `json:"id"`
+	FileName    string    `json:"filename"`
+	Status      string    `json:"status"`
+	OwnerAPIKey string    `json:"owner_key_hash"`
+	CreatedAt   time.Time `json:"created_at"`
+	UserAgent   *string   `json:"user_agent"`
+	IP          *string   `json:"ip"`
+}
+
+// KeyRevoked - відповідь на відкликання ключа
+type KeyRevoked struct {
+	Policy string `json:"policy"` // retain або cascade
+	Files  int64  `json:"files"`  // скільки файлів збережено або видалено
+}
+
+// UploadTimings - скільки часу зайняли етапи завантаження (?timings=true), у наносекундах.
+// Upload заповнюється лише при потоковому завантаженні, інакше відправка асинхронна
+type UploadTimings struct {
+	ReadBody time.Duration `json:"read_body_ns"`
+	Chunking time.Duration `json:"chunking_ns"`
+	Upload   time.Duration `json:"upload_ns,omitempty"`
+}
+
+// KeyStatus - стан API ключа для /validate_key
+type KeyStatus struct {
+	Enabled        bool       `json:"enabled"`
+	QuotaRemaining *int64     `json:"quota_remaining,omitempty"` // немає, якщо квоти немає
+	ExpiresAt      *time.Time `json:"expires_at,omitempty"`
+}
+
+// ChunkOrderError - відповідь, коли позиції chunks не збігаються з TotalChunks
+type ChunkOrderError struct {
+	Error   string `json:"error"`
+	Missing []int  `json:"missing"`
+	Extra   []int  `json:"extra"`
+}
+
+// RequestValidateUpload - заявлені метадані для POST /upload/validate
+type RequestValidateUpload struct {
+	Filename    string `json:"filename"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+}
+
+// UploadValidation - чи буде прийнято завантаження і, якщо ні, чому
+type UploadValidation struct {
+	Accepted bool   `json:"accepted"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// UploadInterrupted - відповідь на обірване завантаження, яке можна продовжити
+// через POST /upload/resume
+type UploadInterrupted struct {
+	Error        string `json:"error"`
+	ResumeToken  string `json:"resume_token"`
+	ResumeOffset int64  `json:"resume_offset"` // з якого байта файлу продовжувати
+}
+
+// EffectiveConfig - налаштування, з якими реально працює сервер (/admin/config).
+// Секрети не віддаються, лише те, чи вони задані
+type EffectiveConfig struct {
+	ChunkSize           int    `json:"chunk_size"`
+	StorageBackend      string `json:"storage_backend"`
+	StorageDir          string `json:"storage_dir,omitempty"`
+	UploadWorkers       int    `json:"upload_workers"`
+	RecoverPanics       bool   `json:"recover_worker_panics"`
+	FairQueue           bool   `json:"fair_queue"`
+	SharedQueue         bool   `json:"shared_queue"`
+	InstanceID          string `json:"instance_id,omitempty"`
+	StorageConcurrency  int    `json:"storage_concurrency"`
+	TelegramRate        int    `json:"telegram_rate"`
+	TelegramBurst       int    `json:"telegram_burst"`
+	MaxConcurrentParts  int    `json:"max_concurrent_parts"`
+	MaxPartSize         int64  `json:"max_part_size"`
+	ChunkCacheBytes     int64  `json:"chunk_cache_bytes"`
+	ExportConcurrency   int    `json:"export_concurrency"`
+	DownloadConcurrency int    `json:"download_concurrency"`
+
+	MaxUploadSize       int64    `json:"max_upload_size"`
+	UploadMinRate       int64    `json:"upload_min_rate"`
+	MinFreeDisk         int64    `json:"min_free_disk"`
+	AllowedContentTypes []string `json:"allowed_content_types"`
+	SniffContentType    bool     `json:"sniff_content_type"`
+	FilenameHeaderLimit int      `json:"filename_header_limit"`
+	DuplicatePolicy     string   `json:"duplicate_policy"`
+	KeyDeletionPolicy   string   `json:"key_deletion_policy"`
+	AbortedUploadPolicy string   `json:"aborted_upload_policy"`
+	TransformMaxSize    int64    `json:"transform_max_size"`
+
+	ChecksumAlgorithm string `json:"checksum_algorithm"`
+	ChunkCaptions     bool   `json:"chunk_captions"`
+	Parity            bool   `json:"parity"`
+	VerifyChunkOrder  bool   `json:"verify_chunk_order"`
+	DedupChunks       bool   `json:"dedup_chunks"`
+	CompressChunks    bool   `json:"compress_chunks"`
+	StreamUploads     bool   `json:"stream_uploads"`
+
+	MaxRetries       int  `json:"max_retries"`
+	RetryQueue       bool `json:"retry_queue"`
+	RetryMaxAttempts int  `json:"retry_max_attempts"`
+
+	AllowPublicKeyCreation bool `json:"allow_public_key_creation"`
+	RejectWhenStorageDown  bool `json:"reject_when_storage_down"`
+	ReadOnly               bool `json:"read_only"`
+	AdminTokenSet          bool `json:"admin_token_set"`
+	ResumeSecretSet        bool `json:"resume_secret_set"`
+	StorageKeySet          bool `json:"storage_key_set"`
+	Pprof                  bool `json:"pprof"`
+	DebugBodies            bool `json:"debug_bodies"`
+	DirectURLs             bool `json:"direct_urls"`
+	KeyMetrics             bool `json:"key_metrics"`
+	KeyMetricsLimit        int  `json:"key_metrics_limit"`
+
+	SweepInterval        string `json:"sweep_interval"`
+	StaleUploadsInterval string `json:"stale_uploads_interval"`
+	StaleUploadAfter     string `json:"stale_upload_after"`
+	SlowUploadAfter      string `json:"slow_upload_after"`
+	RetryDelay           string `json:"retry_delay"`
+	RetryInterval        string `json:"retry_interval"`
+	PurgeInterval        string `json:"purge_interval"`
+	PurgeDeletedAfter    string `json:"purge_deleted_after"`
+	DBQueryTimeout       string `json:"db_query_timeout"`
+	ShutdownTimeout      string `json:"shutdown_timeout"`
+	StorageCheckTTL      string `json:"storage_check_ttl"`
+}
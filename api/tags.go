@@ -0,0 +1,33 @@
+package api
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxTags      = 20
+	maxTagLength = 64
+)
+
+// parseTags розбирає заголовок X-Tags ("report,2024") у список унікальних міток
+func parseTags(header string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "tag is too long")
+		}
+		tags = append(tags, tag)
+	}
+
+	if len(tags) > maxTags {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "too many tags")
+	}
+	return tags, nil
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUploadWithTagsAndFilter(t *testing.T) {
+	a, _, key := newTestAPI(t)
+
+	upload := func(name, tags string) {
+		t.Helper()
+		req := newUploadRequest(t, key, name, []byte("content of "+name))
+		req.Header.Set("X-Tags", tags)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 202 {
+			t.Fatalf("upload %s status = %d", name, resp.StatusCode)
+		}
+	}
+	upload("q1.pdf", "report, 2024")
+	upload("cat.jpg", "photos,2024,photos")
+
+	list := func(query string) []string {
+		t.Helper()
+		req := httptest.NewRequest("GET", "/files"+query, nil)
+		req.Header.Set("X-API-Key", key)
+		resp, err := a.app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Files []struct {
+				FileName string `json:"filename"`
+				Tags     []struct {
+					Name string `json:"name"`
+				} `json:"tags"`
+			} `json:"files"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, file := range body.Files {
+			names = append(names, file.FileName)
+		}
+		return names
+	}
+
+	if got := list("?tag=report"); len(got) != 1 || got[0] != "q1.pdf" {
+		t.Fatalf("tag=report = %v", got)
+	}
+	if got := list("?tag=2024"); len(got) != 2 {
+		t.Fatalf("tag=2024 = %v", got)
+	}
+	if got := list("?tag=missing"); len(got) != 0 {
+		t.Fatalf("tag=missing = %v", got)
+	}
+	if got := list(""); len(got) != 2 {
+		t.Fatalf("no filter = %v", got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags(" report,,2024 ,report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "report" || tags[1] != "2024" {
+		t.Fatalf("tags = %q", tags)
+	}
+
+	if _, err := parseTags(string(make([]byte, maxTagLength+1))); err == nil {
+		t.Fatal("expected error for a too long tag")
+	}
+}
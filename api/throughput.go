@@ -0,0 +1,39 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// throughputWeight - вага нового виміру в ковзному середньому швидкості
+const throughputWeight = 0.2
+
+// throughput - ковзне (експоненційне) середнє швидкості відправки chunks
+// одним worker у байтах за секунду
+type throughput struct {
+	mu   sync.Mutex
+	rate float64 // 0, поки не відправлено жодного chunk
+}
+
+// observe враховує chunk розміром size, відправлений за elapsed
+func (t *throughput) observe(size int64, elapsed time.Duration) {
+	if size <= 0 || elapsed <= 0 {
+		return
+	}
+	rate := float64(size) / elapsed.Seconds()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate == 0 {
+		t.rate = rate
+		return
+	}
+	t.rate += throughputWeight * (rate - t.rate)
+}
+
+// bytesPerSecond повертає поточну середню швидкість, 0 - ще невідома
+func (t *throughput) bytesPerSecond() float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.rate
+}
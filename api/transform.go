@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/rs/zerolog/log"
+)
+
+// Transformer створює із завантаженого файлу похідний, наприклад мініатюру
+// зображення чи нормалізований текст. Похідний файл зберігається як окремий
+// файл того самого власника з посиланням на вихідний (DerivedFrom)
+type Transformer interface {
+	// Name - назва перетворення, записується в похідний файл
+	Name() string
+	// Transform повертає похідний файл або nil, якщо file цьому
+	// перетворенню не підходить
+	Transform(file db.File, data []byte) (*DerivedFile, error)
+}
+
+// DerivedFile - результат перетворення
+type DerivedFile struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// AddTransformer підключає перетворення, яке запускається для кожного
+// завершеного завантаження. Викликається до Start
+func (a *API) AddTransformer(t Transformer) {
+	a.transformers = append(a.transformers, t)
+}
+
+// startTransforms запускає перетворення completed файлу у фоні, щоб не
+// займати worker. Як і запит завантаження, воно рахується в shutdown.writes,
+// бо ставить chunks похідних файлів у чергу
+func (a *API) startTransforms(fileID uint) {
+	if len(a.transformers) == 0 {
+		return
+	}
+
+	a.shutdown.mu.RLock()
+	defer a.shutdown.mu.RUnlock()
+	if a.shutdown.stopping {
+		// файл лишається не позначеним, тож перетворення ще можна запустити
+		log.Warn().Uint("fileID", fileID).Msg("сервер зупиняється, перетворення файлу пропущено")
+		return
+	}
+	a.shutdown.writes.Add(1)
+	go func() {
+		defer a.shutdown.writes.Done()
+		a.transformFile(fileID)
+	}()
+}
+
+// transformFile передає дані файлу кожному перетворенню і зберігає їх
+// результати. Файл перетворюється лише раз, навіть якщо його статус
+// перераховано кілька разів
+func (a *API) transformFile(fileID uint) {
+	claimed, err := a.db.ClaimFileTransform(fileID)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка запуску перетворень файлу")
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка отримання файлу для перетворень")
+		return
+	}
+	if a.config.TransformMaxSize > 0 && file.Size > a.config.TransformMaxSize {
+		log.Debug().Uint("fileID", fileID).Int64("size", file.Size).Msg("файл завеликий для перетворень")
+		return
+	}
+	data, err := a.readFile(file)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка читання файлу для перетворень")
+		return
+	}
+
+	for _, t := range a.transformers {
+		derived, err := t.Transform(file, data)
+		if err != nil {
+			log.Err(err).Uint("fileID", fileID).Str("transform", t.Name()).Msg("перетворення файлу не вдалось")
+			continue
+		}
+		if derived == nil {
+			continue
+		}
+		a.storeDerived(file, t.Name(), derived)
+	}
+}
+
+// storeDerived зберігає результат перетворення transform файлу source як
+// новий файл. Його chunks ідуть у чергу з низьким пріоритетом, щоб не
+// затримувати завантаження клієнтів
+func (a *API) storeDerived(source db.File, transform string, derived *DerivedFile) {
+	fileID, err := a.db.CreateDerivedFile(source, transform, derived.FileName)
+	if err != nil {
+		log.Err(err).Uint("fileID", source.ID).Str("transform", transform).Msg("помилка створення похідного файлу")
+		return
+	}
+	if contentType, ok := normalizeContentType(derived.ContentType); ok {
+		if err := a.db.SetFileContentType(fileID, contentType); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження типу файлу")
+		}
+	}
+	sum := sha256.Sum256(derived.Data)
+	if err := a.db.SetFileChecksum(fileID, hex.EncodeToString(sum[:])); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка збереження checksum файлу")
+	}
+
+	total, positions, err := a.bufferPart(source.OwnerAPIKey, fileID, derived.FileName, bytes.NewReader(derived.Data), 1, db.PriorityLow, nil)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка нарізки похідного файлу")
+		a.failFile(fileID)
+		return
+	}
+	if err := a.db.UpdateFileMetadata(fileID, derived.FileName, total, len(positions)); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення метаданих файлу")
+	}
+	a.recomputeFileStatus(fileID)
+	log.Info().
+		Uint("fileID", fileID).
+		Uint("source", source.ID).
+		Str("transform", transform).
+		Msg("створено похідний файл")
+}
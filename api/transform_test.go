@@ -0,0 +1,94 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+// upperTransformer - перетворення тексту у верхній регістр, інші файли пропускає
+type upperTransformer struct{}
+
+func (upperTransformer) Name() string { return "upper" }
+
+func (upperTransformer) Transform(file db.File, data []byte) (*DerivedFile, error) {
+	if !strings.HasSuffix(file.FileName, ".txt") {
+		return nil, nil
+	}
+	return &DerivedFile{
+		FileName:    strings.TrimSuffix(file.FileName, ".txt") + ".upper.txt",
+		ContentType: "text/plain",
+		Data:        bytes.ToUpper(data),
+	}, nil
+}
+
+func TestTransformCreatesDerivedFile(t *testing.T) {
+	a, _, key := newTestAPI(t)
+	a.AddTransformer(upperTransformer{})
+
+	for _, upload := range []struct{ name, data string }{
+		{"note.txt", "hello"},
+		{"photo.jpg", "jpeg"},
+	} {
+		resp, err := a.app.Test(newUploadRequest(t, key, upload.name, []byte(upload.data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 202 {
+			t.Fatalf("upload status = %d", resp.StatusCode)
+		}
+	}
+
+	// похідний файл з'являється у фоні, після завершення вихідного
+	var derived db.File
+	deadline := time.Now().Add(10 * time.Second)
+	for derived.ID == 0 {
+		files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			if file.DerivedFrom != nil && file.Status == "completed" {
+				derived = file
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("files = %+v, want a completed derived file", files)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	source, err := a.db.GetFileByID(*derived.DerivedFrom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source.FileName != "note.txt" || derived.FileName != "note.upper.txt" || derived.Transform != "upper" {
+		t.Fatalf("derived = %+v from %+v", derived, source)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/download/%d", derived.ID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "HELLO" {
+		t.Fatalf("derived content = %q, want HELLO", body)
+	}
+
+	// ні jpg, ні сам похідний файл не перетворюються
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("files = %+v, want two uploads and one derived file", files)
+	}
+}
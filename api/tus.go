@@ -0,0 +1,289 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// Підмножина протоколу tus 1.0.0 (core + creation): POST створює
+// завантаження, HEAD повертає зсув, PATCH дописує дані з цього зсуву.
+// Дані ріжуться на ті самі chunks, що й у /upload, і йдуть у ту саму чергу
+const (
+	tusVersion          = "1.0.0"
+	tusPatchContentType = "application/offset+octet-stream"
+)
+
+// tusUpload - стан незавершеного tus завантаження між PATCH запитами
+type tusUpload struct {
+	mu     sync.Mutex
+	offset int64  // скільки байтів прийнято
+	next   int    // позиція наступного chunk
+	tail   []byte // дані, яких ще не набралось на повний chunk
+	// parity рахується лише поки стан живий: після перезапуску частина
+	// даних вже недоступна, і parity chunk для такого файлу не створюється
+	parity   []byte
+	noParity bool
+	done     bool
+}
+
+// handleTusCreate створює файл розміром Upload-Length і повертає його адресу
+func (a *API) handleTusCreate(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	length, err := strconv.ParseInt(c.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "valid Upload-Length is required")
+	}
+	meta, err := parseTusMetadata(c.Get("Upload-Metadata"))
+	if err != nil {
+		return err
+	}
+	contentType, _ := normalizeContentType(meta["filetype"])
+
+	reason, err := a.checkUpload(key, uploadMeta{
+		FileName:    meta["filename"],
+		ContentType: contentType,
+		Size:        length,
+	})
+	if err != nil {
+		log.Err(err).Msg("помилка перевірки завантаження")
+		return fiber.NewError(fiber.StatusInternalServerError, "failed to validate upload")
+	}
+	if reason != "" {
+		return rejectionError(reason)
+	}
+
+	fileID, err := a.requestDB(c).CreateNewFile(meta["filename"], length, key, 0)
+	if err != nil {
+		log.Err(err).Msg("помилка створення файлу")
+		return dbError(err, "failed to create file")
+	}
+	if contentType != "" {
+		if err := a.db.SetFileContentType(fileID, contentType); err != nil {
+			log.Err(err).Uint("fileID", fileID).Msg("помилка збереження типу файлу")
+		}
+	}
+
+	upload := &tusUpload{next: 1}
+	a.tusUploads.Store(fileID, upload)
+	if length == 0 {
+		a.finishTusUpload(key, fileID, meta["filename"], upload)
+	}
+	a.updateKeyUsage(key)
+
+	c.Set("Location", fmt.Sprintf("/tus/%d", fileID))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// handleTusHead повертає, скільки байтів завантаження вже прийнято
+func (a *API) handleTusHead(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	c.Set("Cache-Control", "no-store")
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		return err
+	}
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	// після останнього PATCH дані вже прийнято, навіть якщо chunks ще відправляються
+	offset := file.Size
+	if file.Status != "completed" && file.Status != "processing" {
+		upload, err := a.tusState(file)
+		if err != nil {
+			return err
+		}
+		upload.mu.Lock()
+		offset = upload.offset
+		upload.mu.Unlock()
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+	c.Set("Upload-Length", strconv.FormatInt(file.Size, 10))
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// handleTusPatch дописує тіло запиту з Upload-Offset, який має збігатися
+// з поточним зсувом. Повні chunks одразу йдуть у чергу відправки
+func (a *API) handleTusPatch(c *fiber.Ctx) error {
+	c.Set("Tus-Resumable", tusVersion)
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+	if c.Get("Content-Type") != tusPatchContentType {
+		return fiber.NewError(fiber.StatusUnsupportedMediaType, "Content-Type must be "+tusPatchContentType)
+	}
+	offset, err := strconv.ParseInt(c.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "valid Upload-Offset is required")
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+	if file.Status == "completed" || file.Status == "processing" {
+		return fiber.NewError(fiber.StatusConflict, "upload is already complete")
+	}
+	upload, err := a.tusState(file)
+	if err != nil {
+		return err
+	}
+
+	// тіло запиту належить fasthttp, тому в chunks йде копія
+	data := c.Body()
+	if err := checkContentRange(c.Get("Content-Range"), offset, int64(len(data)), file.Size); err != nil {
+		return err
+	}
+
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.done {
+		return fiber.NewError(fiber.StatusConflict, "upload is already complete")
+	}
+	if offset != upload.offset {
+		c.Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+		return fiber.NewError(fiber.StatusConflict, "Upload-Offset does not match the current offset")
+	}
+	if offset+int64(len(data)) > file.Size {
+		return fiber.NewError(fiber.StatusRequestEntityTooLarge, "data exceeds Upload-Length")
+	}
+
+	for len(data) > 0 {
+		space := a.chunkSize - len(upload.tail)
+		n := min(space, len(data))
+		upload.tail = append(upload.tail, data[:n]...)
+		data = data[n:]
+		upload.offset += int64(n)
+		if len(upload.tail) == a.chunkSize {
+			a.enqueueTusChunk(key, file.ID, upload)
+		}
+	}
+
+	if upload.offset == file.Size {
+		a.finishTusUpload(key, file.ID, file.FileName, upload)
+		a.updateKeyUsage(key)
+	}
+
+	c.Set("Upload-Offset", strconv.FormatInt(upload.offset, 10))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// tusState повертає стан незавершеного завантаження. Після перезапуску
+// сервера він відновлюється з уже збережених chunks, а недописаний хвіст
+// клієнт надсилає ще раз з меншого Upload-Offset
+func (a *API) tusState(file db.File) (*tusUpload, error) {
+	if upload, ok := a.tusUploads.Load(file.ID); ok {
+		return upload.(*tusUpload), nil
+	}
+	if file.Status != "uploading" {
+		return nil, fiber.NewError(fiber.StatusGone, "upload is "+file.Status)
+	}
+
+	chunks, err := a.db.GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return nil, dbError(err, "failed to get chunks")
+	}
+	// workers зберігають chunks у довільному порядку, тому рахується лише
+	// суцільний префікс: chunks після пропуску клієнт надішле ще раз
+	upload := &tusUpload{next: 1, noParity: true}
+	for _, chunk := range chunks {
+		if chunk.Parity {
+			continue
+		}
+		if chunk.Position != upload.next {
+			break
+		}
+		upload.offset += chunk.Size
+		upload.next++
+	}
+	actual, _ := a.tusUploads.LoadOrStore(file.ID, upload)
+	return actual.(*tusUpload), nil
+}
+
+// enqueueTusChunk ставить накопичений хвіст у чергу як наступний chunk
+func (a *API) enqueueTusChunk(owner string, fileID uint, upload *tusUpload) {
+	if a.config.Parity && !upload.noParity {
+		upload.parity = xorInto(upload.parity, upload.tail)
+	}
+	a.enqueue(owner, &db.Chunk{
+		FileID:   fileID,
+		Position: upload.next,
+		Size:     int64(len(upload.tail)),
+		Data:     upload.tail,
+	}, nil)
+	upload.next++
+	upload.tail = nil
+}
+
+// finishTusUpload відправляє останній неповний chunk і parity та позначає файл завершеним
+func (a *API) finishTusUpload(owner string, fileID uint, filename string, upload *tusUpload) {
+	if len(upload.tail) > 0 {
+		a.enqueueTusChunk(owner, fileID, upload)
+	}
+	if len(upload.parity) > 0 {
+		a.enqueue(owner, &db.Chunk{
+			FileID: fileID,
+			Parity: true,
+			Size:   int64(len(upload.parity)),
+			Data:   upload.parity,
+		}, nil)
+	}
+	if err := a.db.UpdateFileMetadata(fileID, filename, upload.offset, upload.next-1); err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення метаданих файлу")
+	}
+	a.recomputeFileStatus(fileID)
+	upload.done = true
+	a.tusUploads.Delete(fileID)
+	log.Info().Uint("fileID", fileID).Int64("size", upload.offset).Msg("tus upload finished")
+}
+
+// parseTusMetadata розбирає Upload-Metadata: пари "ключ base64" через кому
+func parseTusMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		name, encoded, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if name == "" || err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "invalid Upload-Metadata")
+		}
+		meta[name] = string(value)
+	}
+	return meta, nil
+}
+
+// checkContentRange перевіряє необов'язковий Content-Range "bytes start-end/total"
+// на узгодженість з Upload-Offset, розміром тіла і Upload-Length
+func checkContentRange(header string, offset, size, length int64) error {
+	if header == "" {
+		return nil
+	}
+	var start, end, total int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "invalid Content-Range")
+	}
+	if start != offset || end-start+1 != size || total != length {
+		return fiber.NewError(fiber.StatusBadRequest, "Content-Range does not match Upload-Offset, body or Upload-Length")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestTusCreatePatchHead(t *testing.T) {
+	const chunkSize = 4096
+	a, _, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChunkSize = chunkSize
+	})
+	data := bytes.Repeat([]byte("0123456789"), (chunkSize+1000)/10)
+
+	do := func(req *http.Request) *http.Response {
+		t.Helper()
+		req.Header.Set("X-API-Key", key)
+		req.Header.Set("Tus-Resumable", tusVersion)
+		resp, err := a.app.Test(req, -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	patch := func(location string, offset int, body []byte) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest("PATCH", location, bytes.NewReader(body))
+		req.Header.Set("Content-Type", tusPatchContentType)
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		return do(req)
+	}
+	head := func(location string) int {
+		t.Helper()
+		resp := do(httptest.NewRequest("HEAD", location, nil))
+		if resp.StatusCode != 200 {
+			t.Fatalf("HEAD status = %d", resp.StatusCode)
+		}
+		offset, err := strconv.Atoi(resp.Header.Get("Upload-Offset"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return offset
+	}
+
+	req := httptest.NewRequest("POST", "/tus", nil)
+	req.Header.Set("Upload-Length", strconv.Itoa(len(data)))
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("big.bin")))
+	resp := do(req)
+	if resp.StatusCode != 201 {
+		t.Fatalf("create status = %d", resp.StatusCode)
+	}
+	location := resp.Header.Get("Location")
+	var fileID uint
+	if _, err := fmt.Sscanf(location, "/tus/%d", &fileID); err != nil {
+		t.Fatalf("location = %q", location)
+	}
+	if offset := head(location); offset != 0 {
+		t.Fatalf("initial offset = %d", offset)
+	}
+
+	// перший chunk і ще 100 байтів
+	resp = patch(location, 0, data[:chunkSize+100])
+	if resp.StatusCode != 204 || resp.Header.Get("Upload-Offset") != strconv.Itoa(chunkSize+100) {
+		t.Fatalf("patch status = %d, offset = %s", resp.StatusCode, resp.Header.Get("Upload-Offset"))
+	}
+	if offset := head(location); offset != chunkSize+100 {
+		t.Fatalf("offset = %d", offset)
+	}
+	if resp := patch(location, 0, data[:10]); resp.StatusCode != 409 {
+		t.Fatalf("patch with stale offset status = %d, want 409", resp.StatusCode)
+	}
+
+	// після перезапуску стан відновлюється з chunks, хвіст треба надіслати ще раз
+	waitForChunks(t, a, fileID, 1)
+	a.tusUploads.Delete(fileID)
+	offset := head(location)
+	if offset != chunkSize {
+		t.Fatalf("offset after restart = %d, want %d", offset, chunkSize)
+	}
+
+	req = httptest.NewRequest("PATCH", location, bytes.NewReader(data[offset:]))
+	req.Header.Set("Content-Type", tusPatchContentType)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, len(data)-1, len(data)))
+	if resp := do(req); resp.StatusCode != 204 {
+		t.Fatalf("resumed patch status = %d", resp.StatusCode)
+	}
+	if offset := head(location); offset != len(data) {
+		t.Fatalf("final offset = %d", offset)
+	}
+
+	file := waitForStatus(t, a, fileID, "completed")
+	if file.TotalChunks != 2 || file.FileName != "big.bin" || file.OwnerAPIKey != db.HashKey(key) {
+		t.Fatalf("file = %+v", file)
+	}
+
+	resp = do(httptest.NewRequest("GET", fmt.Sprintf("/download/%d", fileID), nil))
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatalf("downloaded %d bytes, want the uploaded %d", len(body), len(data))
+	}
+}
@@ -1,9 +1,22 @@
 package api
 
 import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"math/rand/v2"
+	"runtime/debug"
+	"strings"
 	"time"
+	"unicode/utf8"
 
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
 	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
 )
 
 type Task struct {
@@ -13,22 +26,304 @@ type Task struct {
 }
 
 func (a *API) uploaderWorker() {
-	for {
-		chunk := <-a.queue
+	defer a.workers.Done()
 
-		TelegramFileID, err := a.tgbot.SendFile("noname.txt", chunk.Data)
-		if err != nil {
-			// TODO: зробити нормальну обробку
-			panic(err)
+	for {
+		chunk, ok := a.nextChunk()
+		if !ok {
+			return
 		}
-		chunk.TelegramFileID = TelegramFileID
+		release := a.holdChunk(chunk)
+		a.processChunkSafe(chunk)
+		release()
+		a.chunkDone(chunk)
+	}
+}
+
+// processChunkSafe обробляє chunk так, щоб паніка не зупинила worker (якщо
+// RECOVER_WORKER_PANICS): chunk, на якому вона сталась, зберігається failed
+func (a *API) processChunkSafe(chunk *db.Chunk) {
+	if a.config.RecoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				a.failPanickedChunk(chunk, r)
+			}
+		}()
+	}
+	a.processChunk(chunk)
+}
+
+// failPanickedChunk зберігає chunk, обробка якого впала з панікою, як failed
+// з текстом паніки в LastError, щоб він не губився непоміченим
+func (a *API) failPanickedChunk(chunk *db.Chunk, r any) {
+	log.Error().
+		Uint("fileID", chunk.FileID).
+		Int("position", chunk.Position).
+		Str("panic", fmt.Sprint(r)).
+		Bytes("stack", debug.Stack()).
+		Msg("паніка при відправці chunk, chunk позначено failed")
+
+	chunk.Status = "failed"
+	chunk.LastError = fmt.Sprintf("panic: %v", r)
+	chunk.Data = nil
+	if err := a.db.AddChunkToFile(chunk); err != nil {
+		log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка збереження chunk")
+		return
+	}
+	a.recomputeFileStatus(chunk.FileID)
+}
+
+// nextChunk забирає наступний chunk зі спільної черги, якщо її увімкнено, інакше з черги в пам'яті
+func (a *API) nextChunk() (*db.Chunk, bool) {
+	if a.shared != nil {
+		return a.shared.pop()
+	}
+	return a.queue.pop()
+}
+
+// holdChunk продовжує взяття chunk зі спільної черги, поки він обробляється
+func (a *API) holdChunk(chunk *db.Chunk) func() {
+	if a.shared == nil {
+		return func() {}
+	}
+	return a.shared.hold(chunk)
+}
+
+// processChunk відправляє chunk у сховище і зберігає його в базі
+func (a *API) processChunk(chunk *db.Chunk) {
+	// chunk з маніфесту вже має алгоритм, з яким клієнт рахував checksum
+	if chunk.ChecksumAlgorithm == "" {
+		chunk.ChecksumAlgorithm = checksum.Normalize(a.config.ChecksumAlgorithm)
+	}
+	h := a.newHash(chunk.ChecksumAlgorithm)
+	h.Write(chunk.Data)
+	chunk.Checksum = hex.EncodeToString(h.Sum(nil))
+
+	if a.config.DedupChunks && a.reuseChunk(chunk) {
 		chunk.Data = nil
+		if err := a.db.AddChunkToFile(chunk); err != nil {
+			log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка збереження chunk")
+			return
+		}
+		a.recomputeFileStatus(chunk.FileID)
+		return
+	}
 
+	a.compressChunk(chunk)
+	err := a.encryptChunk(chunk)
+	data := chunk.Data
+	var TelegramFileID string
+	if err == nil {
+		started := a.clock.Now()
+		TelegramFileID, err = a.sendChunk(chunk, a.chunkCaption(chunk))
+		if err == nil {
+			a.throughput.observe(int64(len(chunk.Data)), a.clock.Now().Sub(started))
+		}
+	}
+	if err != nil {
+		log.Err(err).
+			Uint("fileID", chunk.FileID).
+			Int("position", chunk.Position).
+			Str("class", string(tgbot.ClassifyError(err))).
+			Msg("не вдалося відправити chunk")
+		chunk.Status = "failed"
+	} else {
+		chunk.TelegramFileID = TelegramFileID
+		chunk.StoredSize = int64(len(chunk.Data))
+		chunk.Status = "completed"
 		log.Debug().Uint("fileID", chunk.FileID).Msg("файл було завантажено")
+	}
+	chunk.Data = nil
+	a.metrics.countChunk(chunk.Status)
 
-		if err := a.db.AddChunkToFile(chunk); err != nil {
-			panic(err)
+	// тимчасові збої (flood control, мережа) ще може виправити фоновий retrier,
+	// тож файл з таким chunk не вважається failed
+	if chunk.Status == "failed" && a.config.RetryQueue && tgbot.ClassifyError(err).Retryable() {
+		err := a.db.SaveChunkForRetry(chunk, data, a.clock.Now().Add(retryBackoff(0)))
+		if err == nil {
+			return
+		}
+		log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка додавання chunk у чергу повторів")
+	}
+
+	if err := a.db.AddChunkToFile(chunk); err != nil {
+		log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка збереження chunk")
+		return
+	}
+	// без failed chunk файл не зібрати, тож він стає failed, а не лишається "uploading"
+	a.recomputeFileStatus(chunk.FileID)
+}
+
+// recomputeFileStatus оновлює статус файлу після зміни його chunks
+func (a *API) recomputeFileStatus(fileID uint) {
+	status, err := a.db.RecomputeFileStatus(fileID)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка оновлення статусу файлу")
+		return
+	}
+	if status != "completed" {
+		return
+	}
+	// completed рахується за кількістю chunks, тож повтор позиції міг
+	// приховати відсутню
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка отримання файлу")
+		return
+	}
+	mismatch, err := a.checkStoredChunkOrder(fileID, file.TotalChunks)
+	if err != nil {
+		log.Err(err).Uint("fileID", fileID).Msg("помилка перевірки позицій chunks")
+		return
+	}
+	if mismatch != nil {
+		return
+	}
+	a.startTransforms(fileID)
+}
+
+// reuseChunk шукає вже відправлений chunk з тими самими даними і, якщо знайде,
+// позначає chunk completed з тим самим файлом у сховищі
+func (a *API) reuseChunk(chunk *db.Chunk) bool {
+	existing, err := a.db.FindCompletedChunk(chunk.ChecksumAlgorithm, chunk.Checksum)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка пошуку однакового chunk")
+		}
+		return false
+	}
+
+	chunk.TelegramFileID = existing.TelegramFileID
+	chunk.SubParts = existing.SubParts
+	chunk.MessageID = existing.MessageID
+	chunk.SubPartMessages = existing.SubPartMessages
+	chunk.StoredSize = existing.StoredSize
+	chunk.Compressed = existing.Compressed
+	chunk.Nonce = existing.Nonce
+	chunk.Status = "completed"
+	log.Debug().
+		Uint("fileID", chunk.FileID).
+		Int("position", chunk.Position).
+		Uint("sameAs", existing.ID).
+		Msg("chunk з такими даними вже є в сховищі")
+	return true
+}
+
+// newHash створює hash.Hash для алгоритму, перевіреного при завантаженні конфігу
+func (a *API) newHash(algorithm string) hash.Hash {
+	h, err := checksum.New(algorithm)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// chunkName повертає ім'я файлу chunk у сховищі: ім'я файлу з номером
+// chunk, щоб канал сховища можна було переглядати. З DedupChunks воно
+// залежить лише від даних, тому однакові chunks мають однакові імена
+func (a *API) chunkName(chunk *db.Chunk) string {
+	if a.config.DedupChunks && chunk.Checksum != "" {
+		return chunk.Checksum + ".bin"
+	}
+	name := chunk.FileName
+	if name == "" {
+		// chunks з маніфесту, tus і спільної черги до появи FileName
+		file, err := a.db.GetFileByID(chunk.FileID)
+		if err != nil {
+			log.Err(err).Uint("fileID", chunk.FileID).Msg("помилка отримання імені файлу для chunk")
+		}
+		name = file.FileName
+	}
+	return partName(name, chunk.Position, chunk.Parity)
+}
+
+// maxDocumentName - найдовше ім'я документа в сховищі в байтах
+const maxDocumentName = 255
+
+// partName повертає ім'я документа для chunk position файлу filename:
+// {filename}.part{position}, а для parity - {filename}.parity
+func partName(filename string, position int, parity bool) string {
+	suffix := fmt.Sprintf(".part%d", position)
+	if parity {
+		suffix = ".parity"
+	}
+	return documentName(filename, maxDocumentName-len(suffix)) + suffix
+}
+
+// documentName прибирає з імені те, що Telegram не приймає в імені документа
+// або сприймає як шлях (керівні символи, роздільники каталогів, невалідний
+// UTF-8), і обрізає його до limit байтів по межі символу
+func documentName(name string, limit int) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '/' || r == '\\' || r == utf8.RuneError {
+			return '_'
+		}
+		return r
+	}, name)
+	for len(name) > limit {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "noname"
+	}
+	return name
+}
+
+// chunkCaption повертає підпис chunk для сховища, якщо підписи увімкнено
+func (a *API) chunkCaption(chunk *db.Chunk) string {
+	if !a.config.ChunkCaptions {
+		return ""
+	}
+	return tgbot.ChunkCaption{
+		FileID:    chunk.FileID,
+		Position:  chunk.Position,
+		Checksum:  chunk.Checksum,
+		Algorithm: chunk.ChecksumAlgorithm,
+	}.String()
+}
+
+// sendBackoff повертає паузу перед повтором attempt (з 1): base, яка
+// подвоюється з кожною спробою, плюс випадкова добавка до половини паузи,
+// щоб кілька workers не повторювали одночасно
+func sendBackoff(base time.Duration, attempt int) time.Duration {
+	delay := base << (attempt - 1)
+	if delay <= 0 {
+		return 0
+	}
+	return delay + rand.N(delay/2+1)
+}
+
+// sendWithRetry повторює відправку, поки помилка тимчасова (flood control, мережа),
+// але не більше MaxRetries разів. Кількість повторів і остання помилка
+// записуються в chunk, щоб клієнт бачив, чому завантаження не вдалось
+func (a *API) sendWithRetry(chunk *db.Chunk, data []byte, caption string) (string, int, error) {
+	name := a.chunkName(chunk)
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		telegramFileID, messageID, err := storage.Send(a.storage, name, data, caption)
+		a.metrics.observeStorage("send", time.Since(started))
+		if err == nil {
+			return telegramFileID, messageID, nil
+		}
+		chunk.LastError = err.Error()
+
+		class := tgbot.ClassifyError(err)
+		if !class.Retryable() || chunk.RetryCount >= a.config.MaxRetries {
+			return "", 0, err
+		}
+		chunk.RetryCount++
+
+		wait := tgbot.RetryAfter(err)
+		if wait == 0 {
+			wait = sendBackoff(a.config.RetryDelay, attempt)
 		}
-		time.Sleep(2 * time.Second)
+		log.Warn().Err(err).
+			Str("class", string(class)).
+			Int("attempt", attempt).
+			Dur("wait", wait).
+			Msg("тимчасова помилка відправки chunk, повторюємо")
+		a.clock.Sleep(wait)
 	}
 }
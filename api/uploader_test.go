@@ -0,0 +1,338 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+)
+
+func TestProcessChunkRecordsRetries(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	a.config.MaxRetries = 2
+	storage.sendErr = &tgbot.HTTPStatusError{StatusCode: 502, Status: "502 Bad Gateway"}
+
+	fileID, err := a.db.CreateNewFile("broken.bin", 4, db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+	chunk := chunks[0]
+	if chunk.Status != "failed" || chunk.RetryCount != 2 || chunk.LastError != storage.sendErr.Error() {
+		t.Fatalf("chunk = status %q, retries %d, last error %q", chunk.Status, chunk.RetryCount, chunk.LastError)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/status", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var status FileStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.FailedChunks) != 1 || status.FailedChunks[0].RetryCount != 2 || status.FailedChunks[0].LastError == "" {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.Status != "failed" {
+		t.Fatalf("file status = %q, want failed", status.Status)
+	}
+}
+
+func TestProcessChunkRetriesWithBackoff(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.MaxRetries = 3
+		cfg.RetryDelay = time.Second
+	})
+	unavailable := &tgbot.HTTPStatusError{StatusCode: 502, Status: "502 Bad Gateway"}
+	storage.sendErrs = []error{unavailable, unavailable}
+
+	fileID, err := a.db.CreateNewFile("flaky.bin", 4, db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := a.clock.(*clock.Fake)
+	start := fake.Now()
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "completed" || chunk.RetryCount != 2 {
+		t.Fatalf("chunk = status %q, retries %d", chunk.Status, chunk.RetryCount)
+	}
+	file, err := a.db.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != "completed" {
+		t.Fatalf("file status = %q", file.Status)
+	}
+
+	// 1 с і 2 с, кожна плюс до половини випадкової добавки
+	if waited := fake.Now().Sub(start); waited < 3*time.Second || waited > 4500*time.Millisecond {
+		t.Fatalf("waited %s between attempts, want 3s..4.5s", waited)
+	}
+}
+
+func TestProcessChunkDoesNotRetryPermanentErrors(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+	a.config.MaxRetries = 5
+	storage.sendErr = &tgbot.HTTPStatusError{StatusCode: 401, Status: "401 Unauthorized"}
+
+	fileID, err := a.db.CreateNewFile("broken.bin", 4, db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: 4, Data: []byte("data")})
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "failed" || chunk.RetryCount != 0 {
+		t.Fatalf("chunk = status %q, retries %d", chunk.Status, chunk.RetryCount)
+	}
+}
+
+func TestProcessChunkSplitsOversizedChunk(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.MaxPartSize = 4
+	})
+
+	data := []byte("0123456789")
+	fileID, err := a.db.CreateNewFile("big.bin", int64(len(data)), db.HashKey(key), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: int64(len(data)), Data: append([]byte(nil), data...)})
+
+	chunk, err := a.db.GetChunk(fileID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chunk.Status != "completed" || len(chunk.SubParts) != 3 {
+		t.Fatalf("chunk = status %q, sub parts %v", chunk.Status, chunk.SubParts)
+	}
+	for _, id := range chunk.SubParts {
+		if len(storage.files[id]) > 4 {
+			t.Fatalf("part %s is %d bytes, limit is 4", id, len(storage.files[id]))
+		}
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/get_file?file_id=%d", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatalf("downloaded %q, want %q", body, data)
+	}
+}
+
+func TestProcessChunkDedup(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.DedupChunks = true
+	})
+
+	data := []byte("same content")
+	var chunks []db.Chunk
+	for _, name := range []string{"a.txt", "b.txt"} {
+		fileID, err := a.db.CreateNewFile(name, int64(len(data)), db.HashKey(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: int64(len(data)), Data: append([]byte(nil), data...)})
+
+		chunk, err := a.db.GetChunk(fileID, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	if len(storage.names) != 1 {
+		t.Fatalf("sent %d times, want 1", len(storage.names))
+	}
+	if want := sha256Hex(data) + ".bin"; storage.names[0] != want {
+		t.Fatalf("chunk name = %q, want %q", storage.names[0], want)
+	}
+	if a.chunkName(&chunks[0]) != a.chunkName(&chunks[1]) {
+		t.Fatal("identical chunks got different names")
+	}
+	if chunks[1].Status != "completed" || chunks[1].TelegramFileID != chunks[0].TelegramFileID {
+		t.Fatalf("second chunk = status %q, id %q; first id %q", chunks[1].Status, chunks[1].TelegramFileID, chunks[0].TelegramFileID)
+	}
+}
+
+func TestProcessChunkChecksumAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{checksum.SHA256, checksum.BLAKE3, checksum.SHA1} {
+		t.Run(algorithm, func(t *testing.T) {
+			a, _, key := newTestAPI(t, func(cfg *config.Config) {
+				cfg.ChecksumAlgorithm = algorithm
+			})
+
+			data := []byte("checksummed")
+			fileID, err := a.db.CreateNewFile("sum.bin", int64(len(data)), db.HashKey(key), 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			a.processChunk(&db.Chunk{FileID: fileID, Position: 1, Size: int64(len(data)), Data: append([]byte(nil), data...)})
+
+			chunk, err := a.db.GetChunk(fileID, 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := checksum.Sum(algorithm, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if chunk.ChecksumAlgorithm != algorithm || chunk.Checksum != want {
+				t.Fatalf("chunk checksum = %s:%s, want %s:%s", chunk.ChecksumAlgorithm, chunk.Checksum, algorithm, want)
+			}
+		})
+	}
+}
+
+// panickingStorage падає з панікою при відправці, поки panics не false
+type panickingStorage struct {
+	*fakeStorage
+	panics atomic.Bool
+}
+
+func (s *panickingStorage) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	if s.panics.Load() {
+		panic("storage exploded")
+	}
+	return s.fakeStorage.SendFileMessage(fileName, data, caption)
+}
+
+func TestWorkerRecoversFromPanic(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage := &panickingStorage{fakeStorage: newFakeStorage()}
+	storage.panics.Store(true)
+	cfg := config.Config{ChunkSize: 1024, UploadWorkers: 1, RecoverPanics: true}
+	a := newAPI(cfg, storage, database, clock.NewFake(time.Now()), nil)
+	t.Cleanup(func() {
+		a.Stop(context.Background())
+	})
+
+	upload := func(name string) uint {
+		t.Helper()
+		resp, err := a.app.Test(newUploadRequest(t, key, name, []byte("data of "+name)), -1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 202 {
+			t.Fatalf("upload %s status = %d", name, resp.StatusCode)
+		}
+		files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files[len(files)-1].ID
+	}
+
+	fileID := upload("boom.bin")
+	waitForStatus(t, a, fileID, "failed")
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 1 || chunks[0].Status != "failed" || chunks[0].LastError != "panic: storage exploded" {
+		t.Fatalf("chunks = %+v, want one failed chunk with the panic message", chunks)
+	}
+
+	// той самий єдиний worker живий і відправляє наступні chunks
+	storage.panics.Store(false)
+	waitForStatus(t, a, upload("fine.bin"), "completed")
+}
+
+func TestChunkDocumentNames(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.ChunkSize = 1024
+		cfg.Parity = true
+	})
+
+	resp, err := a.app.Test(newUploadRequest(t, key, "звіт 2024.pdf", make([]byte, 3000)), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("upload status = %d", resp.StatusCode)
+	}
+	files, err := a.db.ListFilesByOwner(db.HashKey(key), db.FileFilter{})
+	if err != nil || len(files) != 1 {
+		t.Fatalf("files = %+v, err = %v", files, err)
+	}
+	waitForStatus(t, a, files[0].ID, "completed")
+
+	storage.mu.Lock()
+	names := slices.Sorted(slices.Values(storage.names))
+	storage.mu.Unlock()
+	want := []string{"звіт 2024.pdf.parity", "звіт 2024.pdf.part1", "звіт 2024.pdf.part2", "звіт 2024.pdf.part3"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("document names = %q, want %q", names, want)
+	}
+}
+
+func TestDocumentName(t *testing.T) {
+	tests := []struct {
+		name  string
+		limit int
+		want  string
+	}{
+		{"report.pdf", 255, "report.pdf"},
+		{"a/b\\c.txt", 255, "a_b_c.txt"},
+		{"tab\there\n", 255, "tab_here_"},
+		{"bad\xffutf8", 255, "bad_utf8"},
+		{"   ", 255, "noname"},
+		{"", 255, "noname"},
+		// обрізається по межі символу: "ї" займає два байти
+		{"abcї", 4, "abc"},
+	}
+	for _, tt := range tests {
+		if got := documentName(tt.name, tt.limit); got != tt.want {
+			t.Errorf("documentName(%q, %d) = %q, want %q", tt.name, tt.limit, got, tt.want)
+		}
+	}
+	if got := partName(strings.Repeat("x", 300), 12, false); len(got) != maxDocumentName || !strings.HasSuffix(got, ".part12") {
+		t.Errorf("long partName = %q (%d bytes)", got, len(got))
+	}
+}
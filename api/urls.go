@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+// directURLTTL - скільки секунд Telegram гарантує, що пряме посилання діє
+const directURLTTL = 3600
+
+// handleGetFileURLs віддає прямі посилання на chunks файлу за порядком
+// позицій, щоб клієнт міг завантажити їх паралельно сам
+func (a *API) handleGetFileURLs(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+	if file.Status != "completed" {
+		return fiber.NewError(fiber.StatusConflict, "file is not completely uploaded")
+	}
+
+	chunks, err := a.requestDB(c).GetChunksByFileID(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка отримання chunks")
+		return dbError(err, "failed to get chunks")
+	}
+
+	result := FileURLs{FileID: file.ID, ExpiresIn: directURLTTL, Chunks: []ChunkURLs{}}
+	for _, chunk := range chunks {
+		if chunk.Parity {
+			continue
+		}
+		ids := chunk.SubParts
+		if len(ids) == 0 {
+			ids = []string{chunk.TelegramFileID}
+		}
+
+		urls := make([]string, len(ids))
+		for i, id := range ids {
+			urls[i], err = storage.DirectURL(a.storage, id)
+			if errors.Is(err, storage.ErrNoDirectURL) {
+				return fiber.NewError(fiber.StatusNotImplemented, "storage backend has no direct urls")
+			}
+			if err != nil {
+				return storageError(err)
+			}
+		}
+
+		result.Chunks = append(result.Chunks, ChunkURLs{
+			Position:          chunk.Position,
+			Size:              chunk.Size,
+			Compressed:        chunk.Compressed,
+			Encrypted:         len(chunk.Nonce) > 0,
+			Checksum:          chunk.Checksum,
+			ChecksumAlgorithm: checksum.Normalize(chunk.ChecksumAlgorithm),
+			URLs:              urls,
+		})
+	}
+	return c.JSON(result)
+}
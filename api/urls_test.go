@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestGetFileURLsInPositionOrder(t *testing.T) {
+	a, storage, key := newTestAPI(t, func(cfg *config.Config) {
+		cfg.DirectURLs = true
+	})
+
+	fileID, err := a.db.CreateNewFile("data.bin", 9, db.HashKey(key), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// chunks записані в базу не за порядком, parity посилань не має
+	ids := map[int]string{}
+	for _, position := range []int{3, 1, 2, 0} {
+		id, err := storage.SendFile("chunk", []byte("abc"), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[position] = id
+		err = a.db.AddChunkToFile(&db.Chunk{
+			FileID:         fileID,
+			Position:       position,
+			Parity:         position == 0,
+			Size:           3,
+			Status:         "completed",
+			TelegramFileID: id,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := a.db.UpdateFileMetadata(fileID, "data.bin", 9, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", fmt.Sprintf("/files/%d/urls", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	var urls FileURLs
+	if err := json.NewDecoder(resp.Body).Decode(&urls); err != nil {
+		t.Fatal(err)
+	}
+	if urls.ExpiresIn != directURLTTL || len(urls.Chunks) != 3 {
+		t.Fatalf("urls = %+v", urls)
+	}
+	for i, chunk := range urls.Chunks {
+		want := "https://files.test/" + ids[i+1]
+		if chunk.Position != i+1 || len(chunk.URLs) != 1 || chunk.URLs[0] != want {
+			t.Fatalf("chunk %d = %+v, want position %d with %s", i, chunk, i+1, want)
+		}
+	}
+
+	// посилання видаються лише власнику
+	otherKey, err := a.db.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = httptest.NewRequest("GET", fmt.Sprintf("/files/%d/urls", fileID), nil)
+	req.Header.Set("X-API-Key", otherKey)
+	if resp, _ := a.app.Test(req); resp.StatusCode == 200 {
+		t.Fatal("another key got the urls")
+	}
+}
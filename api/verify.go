@@ -0,0 +1,87 @@
+package api
+
+import (
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	verifyOK          = "ok"
+	verifyMismatch    = "mismatch"
+	verifyUnavailable = "unavailable"
+	// verifyUnverified - у chunk немає checksum (наприклад, chunk ще не відправлено)
+	verifyUnverified = "unverified"
+)
+
+// VerifyFile завантажує зі сховища кожен chunk файлу і звіряє його checksum
+// з базою. Дані клієнту не віддаються, тому перевірка дешева для нього
+func (a *API) VerifyFile(fileID uint) (VerifyReport, error) {
+	report := VerifyReport{FileID: fileID, OK: true, Chunks: []ChunkVerification{}}
+
+	chunks, err := a.db.GetChunksByFileID(fileID)
+	if err != nil {
+		return report, err
+	}
+	for _, chunk := range chunks {
+		result := ChunkVerification{Position: chunk.Position, Parity: chunk.Parity}
+
+		if chunk.Checksum == "" || chunk.TelegramFileID == "" {
+			result.Status = verifyUnverified
+			report.Chunks = append(report.Chunks, result)
+			continue
+		}
+
+		// перевіряється саме сховище, а не копія в кеші
+		a.uncache(chunk)
+		data, err := a.loadChunk(chunk)
+		if err != nil {
+			log.Warn().Err(err).
+				Uint("fileID", fileID).
+				Int("position", chunk.Position).
+				Str("class", string(tgbot.ClassifyError(err))).
+				Msg("chunk недоступний при перевірці")
+			result.Status = verifyUnavailable
+			result.Error = err.Error()
+		} else if ok, err := checksum.Verify(chunk.ChecksumAlgorithm, data, chunk.Checksum); err != nil {
+			result.Status = verifyUnverified
+			result.Error = err.Error()
+		} else if !ok {
+			log.Warn().
+				Uint("fileID", fileID).
+				Int("position", chunk.Position).
+				Msg("checksum chunk не збігається")
+			result.Status = verifyMismatch
+		} else {
+			result.Status = verifyOK
+		}
+
+		if result.Status == verifyMismatch || result.Status == verifyUnavailable {
+			report.OK = false
+		}
+		report.Chunks = append(report.Chunks, result)
+	}
+	return report, nil
+}
+
+func (a *API) handleVerifyFile(c *fiber.Ctx) error {
+	key, err := a.validateAPIKey(c)
+	if err != nil {
+		log.Warn().Err(err).Msg("невалідний API ключ")
+		return err
+	}
+
+	file, err := a.ownedFile(c, key)
+	if err != nil {
+		return err
+	}
+
+	report, err := a.VerifyFile(file.ID)
+	if err != nil {
+		log.Err(err).Uint("fileID", file.ID).Msg("помилка перевірки файлу")
+		return dbError(err, "failed to verify file")
+	}
+	log.Info().Uint("fileID", file.ID).Bool("ok", report.OK).Msg("файл перевірено")
+	return c.JSON(report)
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/db"
+)
+
+func TestVerifyFileReportsCorruptedChunk(t *testing.T) {
+	a, storage, key := newTestAPI(t)
+
+	fileID, err := a.db.CreateNewFile("audit.bin", 10, db.HashKey(key), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range []string{"first", "second"} {
+		a.processChunk(&db.Chunk{FileID: fileID, Position: i + 1, Size: int64(len(data)), Data: []byte(data)})
+	}
+
+	corrupted, err := a.db.GetChunk(fileID, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.files[corrupted.TelegramFileID] = []byte("sec0nd")
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/files/%d/verify", fileID), nil)
+	req.Header.Set("X-API-Key", key)
+	resp, err := a.app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	var report VerifyReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Fatal(err)
+	}
+	if report.OK || len(report.Chunks) != 2 {
+		t.Fatalf("report = %+v, want failing report with 2 chunks", report)
+	}
+	if report.Chunks[0].Status != verifyOK || report.Chunks[1].Status != verifyMismatch {
+		t.Fatalf("chunks = %+v, want ok and mismatch", report.Chunks)
+	}
+}
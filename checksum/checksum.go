@@ -0,0 +1,106 @@
+// Package checksum рахує контрольні суми chunks алгоритмом, вибраним у налаштуваннях
+package checksum
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"sync"
+
+	"lukechampine.com/blake3"
+)
+
+const (
+	SHA256 = "sha256"
+	BLAKE3 = "blake3"
+	SHA1   = "sha1" // лише для сумісності зі старими клієнтами
+)
+
+// Default - алгоритм для порожнього імені, ним пораховані chunks,
+// збережені до появи вибору алгоритму
+const Default = SHA256
+
+var (
+	mu      sync.RWMutex
+	hashers = map[string]func() hash.Hash{
+		SHA256: sha256.New,
+		BLAKE3: func() hash.Hash { return blake3.New(32, nil) },
+		SHA1:   sha1.New,
+	}
+)
+
+// Register додає алгоритм або замінює існуючий
+func Register(name string, factory func() hash.Hash) {
+	mu.Lock()
+	defer mu.Unlock()
+	hashers[name] = factory
+}
+
+// Names повертає усі зареєстровані алгоритми
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(hashers))
+	for name := range hashers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Normalize повертає ім'я алгоритму, "" - Default
+func Normalize(name string) string {
+	if name == "" {
+		return Default
+	}
+	return name
+}
+
+// Validate перевіряє, що алгоритм зареєстровано
+func Validate(name string) error {
+	_, err := New(name)
+	return err
+}
+
+// New створює hash.Hash для алгоритму name
+func New(name string) (hash.Hash, error) {
+	mu.RLock()
+	factory, ok := hashers[Normalize(name)]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("невідомий алгоритм checksum %q, можливі значення: %s", name, strings.Join(Names(), ", "))
+	}
+	return factory(), nil
+}
+
+// Sum рахує checksum data у hex
+func Sum(name string, data []byte) (string, error) {
+	h, err := New(name)
+	if err != nil {
+		return "", err
+	}
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Verify перевіряє, що checksum data збігається з expected
+func Verify(name string, data []byte, expected string) (bool, error) {
+	sum, err := Sum(name, data)
+	if err != nil {
+		return false, err
+	}
+	return sum == strings.ToLower(expected), nil
+}
+
+// HexLen повертає довжину checksum алгоритму в hex
+func HexLen(name string) (int, error) {
+	h, err := New(name)
+	if err != nil {
+		return 0, err
+	}
+	return 2 * h.Size(), nil
+}
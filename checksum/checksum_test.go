@@ -0,0 +1,70 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"strings"
+	"testing"
+)
+
+func TestSumAndVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{SHA256, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{BLAKE3, "6437b3ac38465133ffb63b75273a8db548c558465d79db03fd359c6cd5bd9d85"},
+		{SHA1, "a9993e364706816aba3e25717850c26c9cd0d89d"},
+	}
+	for _, tt := range tests {
+		t.Run(Normalize(tt.name), func(t *testing.T) {
+			sum, err := Sum(tt.name, []byte("abc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sum != tt.want {
+				t.Fatalf("Sum = %s, want %s", sum, tt.want)
+			}
+
+			ok, err := Verify(tt.name, []byte("abc"), strings.ToUpper(tt.want))
+			if err != nil || !ok {
+				t.Fatalf("Verify = %v, %v", ok, err)
+			}
+			if ok, _ := Verify(tt.name, []byte("abd"), tt.want); ok {
+				t.Fatal("Verify accepted different data")
+			}
+
+			length, err := HexLen(tt.name)
+			if err != nil || length != len(tt.want) {
+				t.Fatalf("HexLen = %d, %v", length, err)
+			}
+		})
+	}
+}
+
+func TestUnknownAlgorithm(t *testing.T) {
+	err := Validate("md4")
+	if err == nil {
+		t.Fatal("expected error for unknown algorithm")
+	}
+	if !strings.Contains(err.Error(), "blake3, sha1, sha256") {
+		t.Fatalf("error %q doesn't list algorithms", err)
+	}
+}
+
+func TestRegister(t *testing.T) {
+	Register("md5", md5.New)
+	t.Cleanup(func() {
+		mu.Lock()
+		delete(hashers, "md5")
+		mu.Unlock()
+	})
+
+	sum, err := Sum("md5", []byte("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != "900150983cd24fb0d6963f7d28e17f72" {
+		t.Fatalf("md5 = %s", sum)
+	}
+}
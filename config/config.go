@@ -0,0 +1,579 @@
+// Package config збирає налаштування сервісу зі змінних оточення
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/checksum"
+	"github.com/joho/godotenv"
+	"github.com/rs/zerolog/log"
+)
+
+// Config - налаштування сервера
+type Config struct {
+	// ChunkCaptions - додавати до кожного chunk в телеграмі підпис з id файлу,
+	// позицією і checksum, щоб chunks можна було впізнати навіть без бази
+	ChunkCaptions bool
+	// Parity - зберігати для кожного файлу додатковий XOR chunk,
+	// з якого можна відновити один втрачений chunk
+	Parity bool
+	// VerifyChunkOrder - після завантаження перевіряти, що позиції chunks - рівно
+	// 1..TotalChunks, і позначати файл failed, якщо ні
+	VerifyChunkOrder bool
+	// UploadMinRate - мінімальна швидкість завантаження в байт/с,
+	// повільніші завантаження обриваються з 408 (0 - без обмеження)
+	UploadMinRate int64
+	// ChecksumAlgorithm - алгоритм checksum chunks: sha256, blake3 або sha1
+	ChecksumAlgorithm string
+	// DedupChunks - називати chunks у сховищі за їх sha256 і не відправляти
+	// повторно дані, які вже є в сховищі
+	DedupChunks bool
+	// CompressChunks - стискати chunks перед відправкою, якщо це зменшує їх розмір
+	CompressChunks bool
+	// StorageKey - 32-байтний ключ AES-256-GCM, яким chunks шифруються перед
+	// відправкою в сховище (порожній - без шифрування)
+	StorageKey []byte
+	// StreamUploads - відправляти chunks у сховище прямо з потоку запиту,
+	// без буферизації в пам'яті (не працює разом з Parity)
+	StreamUploads bool
+	// StorageBackend - куди зберігати chunks: telegram або fs
+	StorageBackend string
+	// StorageDir - директорія для бекенду fs
+	StorageDir string
+
+	// StorageConcurrency - скільки операцій зі сховищем (відправок і завантажень
+	// разом) може виконуватись одночасно (0 - без обмеження)
+	StorageConcurrency int
+	// UploadWorkers - скільки goroutines одночасно відправляють chunks з черги
+	UploadWorkers int
+	// RecoverPanics - не давати паніці при відправці chunk зупинити сервер:
+	// worker продовжує роботу, а chunk стає failed з текстом паніки
+	RecoverPanics bool
+	// FairQueue - видавати workers chunks різних ключів по черзі, а не в
+	// порядку надходження, щоб велике завантаження не затримувало інші
+	FairQueue bool
+	// SharedQueue - тримати чергу відправки в базі, а не в пам'яті: chunks
+	// з неї може забрати будь-який сервер зі спільною базою, і вони не
+	// губляться при перезапуску. FairQueue тоді не діє
+	SharedQueue bool
+	// InstanceID - ім'я цього сервера, яким він позначає взяті з черги chunks
+	InstanceID string
+	// QueueClaimTimeout - через скільки chunk, взятий сервером, що так і не
+	// зберіг результат (наприклад, упав), знову може взяти інший
+	QueueClaimTimeout time.Duration
+	// QueuePollInterval - як часто workers перевіряють спільну чергу, коли вона порожня
+	QueuePollInterval time.Duration
+	// TelegramRate - скільки запитів до Telegram на хвилину дозволено кожному
+	// боту пулу, усім workers разом (0 - без обмеження), TelegramBurst - скільки
+	// з них можна зробити підряд без паузи
+	TelegramRate  int
+	TelegramBurst int
+	// MaxConcurrentParts - скільки файлів з одного multipart запиту можуть
+	// одночасно чекати на відправку своїх chunks (1 - по одному)
+	MaxConcurrentParts int
+	// ChunkSize - розмір chunk, на які ріжуться файли, в байтах
+	ChunkSize int
+	// ChunkCacheBytes - скільки байтів завантажених зі сховища chunks тримати
+	// в пам'яті для повторних завантажень (0 - без кешу)
+	ChunkCacheBytes int64
+	// MaxPartSize - найбільший розмір одного файлу в сховищі, більші chunks
+	// діляться на частини при відправці (0 - не ділити)
+	MaxPartSize int64
+	// FilenameHeaderLimit - найбільша довжина закодованого імені файлу в
+	// Content-Disposition, довші імена обрізаються (0 - без обмеження)
+	FilenameHeaderLimit int
+
+	// MaxUploadSize - найбільший розмір файлу в байтах (0 - без обмеження)
+	MaxUploadSize int64
+	// MinFreeDisk - скільки байтів має лишатись вільними на диску бази (і
+	// STORAGE_DIR для fs), щоб приймати нові завантаження (0 - не перевіряти)
+	MinFreeDisk int64
+	// RejectWhenStorageDown - відхиляти нові завантаження з 503, поки сховище
+	// не відповідає, замість того щоб накопичувати chunks у черзі.
+	// Результат перевірки тримається StorageCheckTTL
+	RejectWhenStorageDown bool
+	StorageCheckTTL       time.Duration
+	// AllowedContentTypes - дозволені типи файлів ("image/*" можна), порожній - усі
+	AllowedContentTypes []string
+	// SniffContentType - визначати тип файлу, надісланого без Content-Type,
+	// за першими байтами під час завантаження і зберігати його з файлом
+	SniffContentType bool
+	// DuplicatePolicy - що робити з файлом, ім'я якого вже є в ключа: allow або reject
+	DuplicatePolicy string
+	// KeyDeletionPolicy - що робити з файлами відкликаного ключа: retain
+	// (лишаються в базі без власника, адмін може їх передати) або cascade (видаляються)
+	KeyDeletionPolicy string
+	// AbortedUploadPolicy - що робити з файлом, клієнт якого відключився, не
+	// передавши жодного chunk: delete (порожній запис видаляється) або fail
+	// (лишається зі статусом failed)
+	AbortedUploadPolicy string
+	// TransformMaxSize - найбільший файл у байтах, який передається
+	// перетворенням (API.AddTransformer), бо він читається в пам'ять цілком
+	// (0 - без обмеження)
+	TransformMaxSize int64
+
+	// MaxRetries - скільки разів повторювати відправку chunk при тимчасових помилках
+	MaxRetries int
+	// RetryDelay - пауза перед першим повтором, далі подвоюється (з випадковим
+	// додатком до половини паузи), якщо Telegram сам не сказав, скільки чекати
+	RetryDelay time.Duration
+
+	// RetryQueue - зберігати в базі chunks, які не вдалося відправити,
+	// і повторювати відправку у фоні з довшими паузами
+	RetryQueue bool
+	// RetryMaxAttempts - скільки разів фоновий retrier пробує відправити chunk
+	RetryMaxAttempts int
+
+	// ExportConcurrency - скільки chunks одночасно завантажувати для zip експорту
+	ExportConcurrency int
+	// DownloadConcurrency - скільки chunks файлу завантажувати зі сховища
+	// наперед і одночасно, віддаючи файл
+	DownloadConcurrency int
+
+	// AdminToken - токен для адмінських ендпоінтів (заголовок X-Admin-Token),
+	// порожній вимикає їх
+	AdminToken string
+	// AllowPublicKeyCreation - дозволити створювати ключі через /get_api_key
+	// без адмінського токена
+	AllowPublicKeyCreation bool
+	// ReadOnly - відхиляти з 403 усі запити, що змінюють дані (завантаження,
+	// видалення, створення ключів), лишаючи списки і скачування
+	ReadOnly bool
+	// ResumeSecret - ключ підпису токенів продовження завантаження,
+	// порожній - випадковий при кожному запуску
+	ResumeSecret string
+	// Pprof - підключити /debug/pprof за адмінським токеном
+	Pprof bool
+	// DebugBodies - логувати обрізані тіла запитів і відповідей (крім файлів)
+	DebugBodies bool
+
+	// SweepInterval - інтервал фонових задач за замовчуванням
+	SweepInterval time.Duration
+	// StaleUploadsInterval - як часто шукати завислі завантаження (0 - вимкнено)
+	StaleUploadsInterval time.Duration
+	// RetryInterval - як часто фоновий retrier перевіряє чергу (0 - вимкнено)
+	RetryInterval time.Duration
+	// PurgeInterval - як часто остаточно видаляти м'яко видалені файли (0 - вимкнено)
+	PurgeInterval time.Duration
+	// PurgeDeletedAfter - через скільки після видалення файл видаляється остаточно
+	PurgeDeletedAfter time.Duration
+	// StaleUploadAfter - через скільки без оновлень завантаження вважається завислим
+	StaleUploadAfter time.Duration
+	// SlowUploadAfter - через скільки після початку запиту завантаження про нього
+	// сповіщається SlowUploadWebhook (0 - вимкнено)
+	SlowUploadAfter time.Duration
+	// SlowUploadWebhook - URL, куди POST-ом надсилається SlowUploadAlert
+	SlowUploadWebhook string
+	// SlowUploadsInterval - як часто шукати надто довгі завантаження
+	SlowUploadsInterval time.Duration
+
+	// DirectURLs - віддавати на /files/:fileID/urls прямі посилання Telegram на
+	// chunks. Посилання містять токен бота, тому вимкнено за замовчуванням
+	DirectURLs bool
+
+	// KeyMetrics - віддавати на /metrics використання сховища по ключах
+	KeyMetrics bool
+	// KeyMetricsLimit - для скількох ключів найбільше є мітки (0 - без обмеження)
+	KeyMetricsLimit int
+
+	// DBQueryTimeout - найдовший час одного запиту до бази (0 - без обмеження)
+	DBQueryTimeout time.Duration
+	// ShutdownTimeout - скільки при зупинці чекати на розпочаті завантаження
+	// і відправку chunks з черги
+	ShutdownTimeout time.Duration
+}
+
+const (
+	// DefaultChunkSize - розмір chunk, якщо CHUNK_SIZE не задано
+	DefaultChunkSize = 20 * 1024 * 1024
+	// TelegramDocumentLimit - найбільший документ, який бот може відправити в Telegram
+	TelegramDocumentLimit = 50 * 1024 * 1024
+)
+
+// значення DUPLICATE_POLICY
+const (
+	DuplicateAllow  = "allow"
+	DuplicateReject = "reject"
+)
+
+// значення KEY_DELETION_POLICY
+const (
+	KeyDeletionRetain  = "retain"
+	KeyDeletionCascade = "cascade"
+)
+
+// значення ABORTED_UPLOAD_POLICY
+const (
+	AbortedUploadDelete = "delete"
+	AbortedUploadFail   = "fail"
+)
+
+// Load читає налаштування з оточення
+func Load() (Config, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Err(err).Msg(".env file not found, using system env")
+	}
+
+	cfg := Config{
+		StorageBackend: stringEnv("STORAGE_BACKEND", "telegram"),
+		StorageDir:     stringEnv("STORAGE_DIR", "data"),
+		AdminToken:     stringEnv("ADMIN_TOKEN", ""),
+		ResumeSecret:   stringEnv("RESUME_SECRET", ""),
+	}
+	var err error
+
+	if cfg.ChunkCaptions, err = boolEnv("CHUNK_CAPTIONS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.Parity, err = boolEnv("PARITY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.VerifyChunkOrder, err = boolEnv("VERIFY_CHUNK_ORDER", true); err != nil {
+		return Config{}, err
+	}
+	cfg.ChecksumAlgorithm = stringEnv("CHECKSUM_ALGORITHM", checksum.Default)
+	if err := checksum.Validate(cfg.ChecksumAlgorithm); err != nil {
+		return Config{}, err
+	}
+	if cfg.DedupChunks, err = boolEnv("DEDUP_CHUNKS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.CompressChunks, err = boolEnv("COMPRESS_CHUNKS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StorageKey, err = storageKey(stringEnv("STORAGE_KEY", "")); err != nil {
+		return Config{}, err
+	}
+	if cfg.StreamUploads, err = boolEnv("STREAM_UPLOADS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.UploadMinRate, err = intEnv("UPLOAD_MIN_RATE", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.UploadMinRate < 0 {
+		return Config{}, fmt.Errorf("UPLOAD_MIN_RATE не може бути від'ємним")
+	}
+
+	storageConcurrency, err := intEnv("STORAGE_CONCURRENCY", 8)
+	if err != nil {
+		return Config{}, err
+	}
+	if storageConcurrency < 0 {
+		return Config{}, fmt.Errorf("STORAGE_CONCURRENCY не може бути від'ємним")
+	}
+	cfg.StorageConcurrency = int(storageConcurrency)
+
+	uploadWorkers, err := intEnv("UPLOAD_WORKERS", 4)
+	if err != nil {
+		return Config{}, err
+	}
+	if uploadWorkers < 1 {
+		return Config{}, fmt.Errorf("UPLOAD_WORKERS має бути не менше 1")
+	}
+	cfg.UploadWorkers = int(uploadWorkers)
+	if cfg.RecoverPanics, err = boolEnv("RECOVER_WORKER_PANICS", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.FairQueue, err = boolEnv("FAIR_QUEUE", true); err != nil {
+		return Config{}, err
+	}
+	if cfg.SharedQueue, err = boolEnv("SHARED_QUEUE", false); err != nil {
+		return Config{}, err
+	}
+	hostname, _ := os.Hostname()
+	cfg.InstanceID = stringEnv("INSTANCE_ID", hostname)
+	if cfg.SharedQueue && cfg.InstanceID == "" {
+		return Config{}, fmt.Errorf("INSTANCE_ID обов'язковий для SHARED_QUEUE")
+	}
+	if cfg.QueueClaimTimeout, err = durationEnv("QUEUE_CLAIM_TIMEOUT", 10*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.QueueClaimTimeout <= 0 {
+		return Config{}, fmt.Errorf("QUEUE_CLAIM_TIMEOUT має бути додатнім")
+	}
+	if cfg.QueuePollInterval, err = durationEnv("QUEUE_POLL_INTERVAL", time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.QueuePollInterval <= 0 {
+		return Config{}, fmt.Errorf("QUEUE_POLL_INTERVAL має бути додатнім")
+	}
+
+	telegramRate, err := intEnv("TELEGRAM_RATE", 20)
+	if err != nil {
+		return Config{}, err
+	}
+	telegramBurst, err := intEnv("TELEGRAM_BURST", 5)
+	if err != nil {
+		return Config{}, err
+	}
+	if telegramRate < 0 || telegramBurst < 1 {
+		return Config{}, fmt.Errorf("TELEGRAM_RATE не може бути від'ємним, а TELEGRAM_BURST - меншим за 1")
+	}
+	cfg.TelegramRate = int(telegramRate)
+	cfg.TelegramBurst = int(telegramBurst)
+
+	maxConcurrentParts, err := intEnv("MAX_CONCURRENT_PARTS", 1)
+	if err != nil {
+		return Config{}, err
+	}
+	if maxConcurrentParts < 1 {
+		return Config{}, fmt.Errorf("MAX_CONCURRENT_PARTS має бути не менше 1")
+	}
+	cfg.MaxConcurrentParts = int(maxConcurrentParts)
+
+	chunkSize, err := intEnv("CHUNK_SIZE", DefaultChunkSize)
+	if err != nil {
+		return Config{}, err
+	}
+	if chunkSize <= 0 {
+		return Config{}, fmt.Errorf("CHUNK_SIZE має бути додатним, отримано %d", chunkSize)
+	}
+	if cfg.StorageBackend == "telegram" && chunkSize > TelegramDocumentLimit {
+		return Config{}, fmt.Errorf("CHUNK_SIZE %d більший за ліміт документа Telegram (%d байт)", chunkSize, TelegramDocumentLimit)
+	}
+	cfg.ChunkSize = int(chunkSize)
+
+	if cfg.ChunkCacheBytes, err = intEnv("CHUNK_CACHE_BYTES", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.ChunkCacheBytes < 0 {
+		return Config{}, fmt.Errorf("CHUNK_CACHE_BYTES не може бути від'ємним")
+	}
+
+	if cfg.MaxPartSize, err = intEnv("MAX_PART_SIZE", 20*1024*1024); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxPartSize < 0 {
+		return Config{}, fmt.Errorf("MAX_PART_SIZE не може бути від'ємним")
+	}
+	filenameHeaderLimit, err := intEnv("FILENAME_HEADER_LIMIT", 1024)
+	if err != nil {
+		return Config{}, err
+	}
+	if filenameHeaderLimit < 0 {
+		return Config{}, fmt.Errorf("FILENAME_HEADER_LIMIT не може бути від'ємним")
+	}
+	cfg.FilenameHeaderLimit = int(filenameHeaderLimit)
+
+	if cfg.MaxUploadSize, err = intEnv("MAX_UPLOAD_SIZE", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MaxUploadSize < 0 {
+		return Config{}, fmt.Errorf("MAX_UPLOAD_SIZE не може бути від'ємним")
+	}
+	if cfg.MinFreeDisk, err = intEnv("MIN_FREE_DISK", 0); err != nil {
+		return Config{}, err
+	}
+	if cfg.MinFreeDisk < 0 {
+		return Config{}, fmt.Errorf("MIN_FREE_DISK не може бути від'ємним")
+	}
+	if cfg.RejectWhenStorageDown, err = boolEnv("REJECT_WHEN_STORAGE_DOWN", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.StorageCheckTTL, err = durationEnv("STORAGE_CHECK_TTL", 30*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.StorageCheckTTL < 0 {
+		return Config{}, fmt.Errorf("STORAGE_CHECK_TTL не може бути від'ємним")
+	}
+	cfg.AllowedContentTypes = listEnv("ALLOWED_CONTENT_TYPES")
+	if cfg.SniffContentType, err = boolEnv("SNIFF_CONTENT_TYPE", true); err != nil {
+		return Config{}, err
+	}
+	cfg.DuplicatePolicy = stringEnv("DUPLICATE_POLICY", DuplicateAllow)
+	if cfg.DuplicatePolicy != DuplicateAllow && cfg.DuplicatePolicy != DuplicateReject {
+		return Config{}, fmt.Errorf("невідомий DUPLICATE_POLICY %q, можливі значення: %s, %s", cfg.DuplicatePolicy, DuplicateAllow, DuplicateReject)
+	}
+	cfg.KeyDeletionPolicy = stringEnv("KEY_DELETION_POLICY", KeyDeletionRetain)
+	if cfg.KeyDeletionPolicy != KeyDeletionRetain && cfg.KeyDeletionPolicy != KeyDeletionCascade {
+		return Config{}, fmt.Errorf("невідомий KEY_DELETION_POLICY %q, можливі значення: %s, %s", cfg.KeyDeletionPolicy, KeyDeletionRetain, KeyDeletionCascade)
+	}
+	cfg.AbortedUploadPolicy = stringEnv("ABORTED_UPLOAD_POLICY", AbortedUploadDelete)
+	if cfg.AbortedUploadPolicy != AbortedUploadDelete && cfg.AbortedUploadPolicy != AbortedUploadFail {
+		return Config{}, fmt.Errorf("невідомий ABORTED_UPLOAD_POLICY %q, можливі значення: %s, %s", cfg.AbortedUploadPolicy, AbortedUploadDelete, AbortedUploadFail)
+	}
+	if cfg.TransformMaxSize, err = intEnv("TRANSFORM_MAX_SIZE", 100*1024*1024); err != nil {
+		return Config{}, err
+	}
+	if cfg.TransformMaxSize < 0 {
+		return Config{}, fmt.Errorf("TRANSFORM_MAX_SIZE не може бути від'ємним")
+	}
+
+	maxRetries, err := intEnv("MAX_RETRIES", 2)
+	if err != nil {
+		return Config{}, err
+	}
+	if maxRetries < 0 {
+		return Config{}, fmt.Errorf("MAX_RETRIES не може бути від'ємним")
+	}
+	cfg.MaxRetries = int(maxRetries)
+	if cfg.RetryDelay, err = durationEnv("RETRY_DELAY", time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.RetryDelay < 0 {
+		return Config{}, fmt.Errorf("RETRY_DELAY не може бути від'ємним")
+	}
+
+	if cfg.RetryQueue, err = boolEnv("RETRY_QUEUE", false); err != nil {
+		return Config{}, err
+	}
+	retryMaxAttempts, err := intEnv("RETRY_MAX_ATTEMPTS", 10)
+	if err != nil {
+		return Config{}, err
+	}
+	if retryMaxAttempts < 1 {
+		return Config{}, fmt.Errorf("RETRY_MAX_ATTEMPTS має бути додатнім")
+	}
+	cfg.RetryMaxAttempts = int(retryMaxAttempts)
+
+	exportConcurrency, err := intEnv("EXPORT_CONCURRENCY", 4)
+	if err != nil {
+		return Config{}, err
+	}
+	if exportConcurrency < 1 {
+		return Config{}, fmt.Errorf("EXPORT_CONCURRENCY має бути додатнім")
+	}
+	cfg.ExportConcurrency = int(exportConcurrency)
+	downloadConcurrency, err := intEnv("DOWNLOAD_CONCURRENCY", 4)
+	if err != nil {
+		return Config{}, err
+	}
+	if downloadConcurrency < 1 {
+		return Config{}, fmt.Errorf("DOWNLOAD_CONCURRENCY має бути додатнім")
+	}
+	cfg.DownloadConcurrency = int(downloadConcurrency)
+
+	if cfg.AllowPublicKeyCreation, err = boolEnv("ALLOW_PUBLIC_KEY_CREATION", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.ReadOnly, err = boolEnv("READ_ONLY", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.Pprof, err = boolEnv("PPROF", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.DebugBodies, err = boolEnv("DEBUG_BODIES", false); err != nil {
+		return Config{}, err
+	}
+
+	if cfg.SweepInterval, err = durationEnv("SWEEP_INTERVAL", 5*time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.StaleUploadsInterval, err = durationEnv("STALE_UPLOADS_INTERVAL", cfg.SweepInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.RetryInterval, err = durationEnv("RETRY_INTERVAL", cfg.SweepInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.PurgeInterval, err = durationEnv("PURGE_INTERVAL", cfg.SweepInterval); err != nil {
+		return Config{}, err
+	}
+	if cfg.PurgeDeletedAfter, err = durationEnv("PURGE_DELETED_AFTER", 30*24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	if cfg.StaleUploadAfter, err = durationEnv("STALE_UPLOAD_AFTER", 24*time.Hour); err != nil {
+		return Config{}, err
+	}
+	if cfg.SlowUploadAfter, err = durationEnv("SLOW_UPLOAD_AFTER", 0); err != nil {
+		return Config{}, err
+	}
+	cfg.SlowUploadWebhook = os.Getenv("SLOW_UPLOAD_WEBHOOK")
+	if cfg.SlowUploadsInterval, err = durationEnv("SLOW_UPLOADS_INTERVAL", time.Minute); err != nil {
+		return Config{}, err
+	}
+	if cfg.DirectURLs, err = boolEnv("DIRECT_URLS", false); err != nil {
+		return Config{}, err
+	}
+	if cfg.KeyMetrics, err = boolEnv("KEY_METRICS", false); err != nil {
+		return Config{}, err
+	}
+	keyMetricsLimit, err := intEnv("KEY_METRICS_LIMIT", 100)
+	if err != nil {
+		return Config{}, err
+	}
+	if keyMetricsLimit < 0 {
+		return Config{}, fmt.Errorf("KEY_METRICS_LIMIT не може бути від'ємним")
+	}
+	cfg.KeyMetricsLimit = int(keyMetricsLimit)
+
+	if cfg.DBQueryTimeout, err = durationEnv("DB_QUERY_TIMEOUT", 10*time.Second); err != nil {
+		return Config{}, err
+	}
+	if cfg.ShutdownTimeout, err = durationEnv("SHUTDOWN_TIMEOUT", 2*time.Minute); err != nil {
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+func stringEnv(name, def string) string {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def
+	}
+	return value
+}
+
+// listEnv розбирає список через кому, порожні елементи пропускаються
+func listEnv(name string) []string {
+	var res []string
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+func boolEnv(name string, def bool) (bool, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def, nil
+	}
+	res, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("некоректне значення %s: %w", name, err)
+	}
+	return res, nil
+}
+
+func intEnv(name string, def int64) (int64, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def, nil
+	}
+	res, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("некоректне значення %s: %w", name, err)
+	}
+	return res, nil
+}
+
+func durationEnv(name string, def time.Duration) (time.Duration, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || value == "" {
+		return def, nil
+	}
+	res, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("некоректне значення %s: %w", name, err)
+	}
+	return res, nil
+}
+
+// storageKey розбирає STORAGE_KEY - 32 байти в hex, порожній - без шифрування
+func storageKey(value string) ([]byte, error) {
+	if value == "" {
+		return nil, nil
+	}
+	key, err := hex.DecodeString(value)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("STORAGE_KEY має бути 32 байти в hex (64 символи)")
+	}
+	return key, nil
+}
@@ -1,6 +1,10 @@
 package db
 
 import (
+	"path/filepath"
+	"slices"
+	"strings"
+
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -9,8 +13,32 @@ type DataBase struct {
 	DB *gorm.DB
 }
 
+// Dir повертає каталог, у якому лежить файл бази
+func (db *DataBase) Dir() string {
+	dsn := db.DB.Dialector.(*sqlite.Dialector).DSN
+	dsn = strings.TrimPrefix(dsn, "file:")
+	if i := strings.IndexByte(dsn, '?'); i >= 0 {
+		dsn = dsn[:i]
+	}
+	return filepath.Dir(dsn)
+}
+
+// Ping перевіряє, що з'єднання з базою живе
+func (db *DataBase) Ping() error {
+	sqlDB, err := db.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Ping()
+}
+
 func ConnectDB() (*DataBase, error) {
-	gormDatabase, err := gorm.Open(sqlite.Open("test.db"), &gorm.Config{})
+	return Open("test.db")
+}
+
+// Open відкриває sqlite базу за шляхом dsn і створює таблиці
+func Open(dsn string) (*DataBase, error) {
+	gormDatabase, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
 		return nil, err
 	}
@@ -18,6 +46,12 @@ func ConnectDB() (*DataBase, error) {
 	if err := CreateTables(gormDatabase); err != nil {
 		panic(err)
 	}
+	if err := migrateKeyHashes(gormDatabase); err != nil {
+		return nil, err
+	}
+	if err := migrateKeyQuota(gormDatabase); err != nil {
+		return nil, err
+	}
 
 	db := &DataBase{DB: gormDatabase}
 
@@ -25,5 +59,52 @@ func ConnectDB() (*DataBase, error) {
 }
 
 func CreateTables(db *gorm.DB) error {
-	return db.AutoMigrate(&File{}, &Key{}, &Chunk{})
+	return db.AutoMigrate(&File{}, &Key{}, &Chunk{}, &Tag{}, &RetryTask{})
+}
+
+// migrateKeyQuota переносить квоти зі старої колонки quota в quota_bytes,
+// яку вже створив AutoMigrate, і видаляє стару колонку
+func migrateKeyQuota(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Key{}, "quota") {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE keys SET quota_bytes = quota").Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&Key{}, "quota")
+	})
+}
+
+// migrateKeyHashes замінює сирі ключі зі старих баз їх hash, і в таблиці
+// ключів, і серед власників файлів, після чого видаляє колонку з ключами
+func migrateKeyHashes(db *gorm.DB) error {
+	columns, err := db.Migrator().ColumnTypes(&Key{})
+	if err != nil {
+		return err
+	}
+	if !slices.ContainsFunc(columns, func(c gorm.ColumnType) bool { return c.Name() == "key" }) {
+		return nil
+	}
+
+	var legacy []struct {
+		ID  uint
+		Key string
+	}
+	if err := db.Table("keys").Select("id, key").Where("key <> ''").Scan(&legacy).Error; err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, k := range legacy {
+			hash := HashKey(k.Key)
+			if err := tx.Table("keys").Where("id = ?", k.ID).Update("hash", hash).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&File{}).Where("owner_api_key = ?", k.Key).Update("owner_api_key", hash).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Migrator().DropColumn(&Key{}, "key")
+	})
 }
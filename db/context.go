@@ -0,0 +1,61 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const cancelKey = "infinity:cancel"
+
+// WithContext повертає копію бази, запити якої виконуються з ctx, тож
+// скасування запиту клієнта чи дедлайн обривають і запити до бази
+func (db *DataBase) WithContext(ctx context.Context) *DataBase {
+	return &DataBase{DB: db.DB.WithContext(ctx)}
+}
+
+// SetQueryTimeout обмежує час кожного запиту до бази (0 - без обмеження),
+// щоб заблокована база не тримала запит клієнта нескінченно
+func (db *DataBase) SetQueryTimeout(d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	before := func(tx *gorm.DB) {
+		ctx, cancel := context.WithTimeout(tx.Statement.Context, d)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(cancelKey, cancel)
+	}
+	after := func(tx *gorm.DB) {
+		if cancel, ok := tx.InstanceGet(cancelKey); ok {
+			cancel.(context.CancelFunc)()
+		}
+	}
+
+	// Row не обгортається: рядки читаються вже після колбеків
+	callbacks := db.DB.Callback()
+	for _, err := range []error{
+		callbacks.Create().Before("*").Register("infinity:timeout", before),
+		callbacks.Create().After("*").Register("infinity:timeout_cancel", after),
+		callbacks.Query().Before("*").Register("infinity:timeout", before),
+		callbacks.Query().After("*").Register("infinity:timeout_cancel", after),
+		callbacks.Update().Before("*").Register("infinity:timeout", before),
+		callbacks.Update().After("*").Register("infinity:timeout_cancel", after),
+		callbacks.Delete().Before("*").Register("infinity:timeout", before),
+		callbacks.Delete().After("*").Register("infinity:timeout_cancel", after),
+		callbacks.Raw().Before("*").Register("infinity:timeout", before),
+		callbacks.Raw().After("*").Register("infinity:timeout_cancel", after),
+	} {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// IsTimeout перевіряє, чи запит обірвано через дедлайн або скасування контексту
+func IsTimeout(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
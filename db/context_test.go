@@ -0,0 +1,46 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryAbortsOnCancelledContext(t *testing.T) {
+	database := openTestDB(t)
+	fileID, err := database.CreateNewFile("a.txt", 1, "key", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := database.WithContext(ctx).GetFileByID(fileID); !IsTimeout(err) {
+		t.Fatalf("err = %v, want context error", err)
+	}
+	if _, err := database.GetFileByID(fileID); err != nil {
+		t.Fatalf("query without context failed: %v", err)
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	database := openTestDB(t)
+	if err := database.SetQueryTimeout(50 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+
+	// нескінченний рекурсивний запит має обірватись по таймауту
+	var count int64
+	started := time.Now()
+	err := database.DB.Raw("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c").Find(&count).Error
+	if !IsTimeout(err) {
+		t.Fatalf("err = %v, want timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Fatalf("query took %s", elapsed)
+	}
+
+	if _, err := database.CreateNewFile("a.txt", 1, "key", 1); err != nil {
+		t.Fatalf("fast query failed: %v", err)
+	}
+}
@@ -1,13 +1,31 @@
 package db
 
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AddChunkToFile зберігає chunk, існуючий запис (з ID) оновлюється
 func (db *DataBase) AddChunkToFile(c *Chunk) error {
-	res := db.DB.Create(c)
+	res := db.DB.Save(c)
 	if res.Error != nil {
 		return res.Error
 	}
 	return nil
 }
 
+// ChunkBatchSize - скільки chunks вставляється одним INSERT. Так запит
+// лишається в межах ліміту змінних sqlite навіть з усіма колонками Chunk
+const ChunkBatchSize = 100
+
+// AddChunks створює нові chunks пачками по ChunkBatchSize в одній транзакції,
+// що для файлів з багатьма chunks набагато швидше за AddChunkToFile для кожного
+func (db *DataBase) AddChunks(chunks []Chunk) error {
+	return db.DB.CreateInBatches(chunks, ChunkBatchSize).Error
+}
+
 func (db *DataBase) WriteNewFile(file File) (uint, error) {
 	res := db.DB.Create(&file)
 	if res.Error != nil {
@@ -31,23 +49,25 @@ func (db *DataBase) CreateNewFile(filename string, size int64, key string, total
 	return file.ID, nil
 }
 
+// UpdateFileMetadata записує метадані файлу, дані якого вже повністю прийнято.
+// Файл стає processing, а completed - лише коли всі його chunks справді
+// відправлено (одразу, якщо так уже є). failed файл лишається failed
 func (db *DataBase) UpdateFileMetadata(fileID uint, filename string, size int64, totalChunks int) error {
-	var file File
-	res := db.DB.First(&file, fileID)
-	if res.Error != nil {
-		return res.Error
-	}
-
-	file.FileName = filename
-	file.Size = size
-	file.TotalChunks = totalChunks
-	file.Status = "completed" // Assuming metadata update means file is completed
-
-	res = db.DB.Save(&file)
-	if res.Error != nil {
-		return res.Error
-	}
-	return nil
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&File{}).Where("id = ?", fileID).Updates(map[string]any{
+			"file_name":    filename,
+			"size":         size,
+			"total_chunks": totalChunks,
+			"status":       gorm.Expr("CASE WHEN status = 'failed' THEN 'failed' ELSE 'processing' END"),
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Model(&File{}).Where("id = ?", fileID).Update("status", gorm.Expr(recomputeStatusSQL, false)).Error
+	})
 }
 
 func (db *DataBase) GetFilesListByKey(key string) []File {
@@ -65,8 +85,347 @@ func (db *DataBase) GetFileByID(fileID uint) (File, error) {
 	return file, nil
 }
 
-func (db *DataBase) GetChunksByFileID(fileID uint) []Chunk {
+// GetChunksByFileID повертає chunks файлу, впорядковані за Position
+// (parity chunk з позицією 0 - першим)
+func (db *DataBase) GetChunksByFileID(fileID uint) ([]Chunk, error) {
 	var chunks []Chunk
-	db.DB.Where(&Chunk{FileID: fileID}).Find(&chunks)
-	return chunks
+	err := db.DB.Where(&Chunk{FileID: fileID}).Order("position").Find(&chunks).Error
+	return chunks, err
+}
+
+// MarkStaleUploadsFailed позначає failed файли, які лишились у статусі
+// uploading і не оновлювались з before, і повертає їх кількість
+func (db *DataBase) MarkStaleUploadsFailed(before time.Time) (int64, error) {
+	res := db.DB.Model(&File{}).
+		Where("status = ? AND updated_at < ?", "uploading", before).
+		Update("status", "failed")
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return res.RowsAffected, nil
+}
+
+// StoredSize повертає, скільки байтів файл реально займає в сховищі.
+// Chunks, повторно використані через dedup, посилаються на те саме
+// повідомлення, тож кожен telegram_file_id рахується один раз. Chunks без
+// id (ще не відправлені) рахуються окремо
+func (db *DataBase) StoredSize(fileID uint) (int64, error) {
+	stored := db.DB.Model(&Chunk{}).
+		Where("file_id = ?", fileID).
+		Select("MAX(stored_size) AS stored_size").
+		Group("COALESCE(NULLIF(telegram_file_id, ''), 'chunk:' || id)")
+
+	var size int64
+	res := db.DB.Table("(?) AS stored", stored).
+		Select("COALESCE(SUM(stored_size), 0)").
+		Scan(&size)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return size, nil
+}
+
+// CreateFileWithChunks створює файл разом з очікуваними (pending) chunks
+func (db *DataBase) CreateFileWithChunks(file File, chunks []Chunk) (uint, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&file).Error; err != nil {
+			return err
+		}
+		for i := range chunks {
+			chunks[i].FileID = file.ID
+		}
+		return tx.CreateInBatches(&chunks, ChunkBatchSize).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return file.ID, nil
+}
+
+func (db *DataBase) GetChunk(fileID uint, position int) (Chunk, error) {
+	var chunk Chunk
+	res := db.DB.Where("file_id = ? AND position = ? AND parity = ?", fileID, position, false).First(&chunk)
+	if res.Error != nil {
+		return chunk, res.Error
+	}
+	return chunk, nil
+}
+
+// FileNameExists - чи є в ключа файл з таким ім'ям, який не провалився
+func (db *DataBase) FileNameExists(key, filename string) (bool, error) {
+	var count int64
+	res := db.DB.Model(&File{}).
+		Where("owner_api_key = ? AND file_name = ? AND status <> ?", key, filename, "failed").
+		Count(&count)
+	return count > 0, res.Error
+}
+
+// FindCompletedChunk повертає вже відправлений chunk з таким самим checksum,
+// щоб не відправляти однакові дані двічі
+func (db *DataBase) FindCompletedChunk(algorithm, checksum string) (Chunk, error) {
+	// chunks без алгоритму пораховані sha256
+	algorithms := []string{algorithm}
+	if algorithm == "sha256" {
+		algorithms = append(algorithms, "")
+	}
+
+	var chunk Chunk
+	res := db.DB.Where("checksum = ? AND checksum_algorithm IN ? AND status = ? AND telegram_file_id <> ''", checksum, algorithms, "completed").
+		Order("id").
+		First(&chunk)
+	return chunk, res.Error
+}
+
+// SetChunkStatus атомарно змінює статус chunk з from на to,
+// false означає, що chunk вже не в статусі from
+func (db *DataBase) SetChunkStatus(chunkID uint, from, to string) (bool, error) {
+	res := db.DB.Model(&Chunk{}).
+		Where("id = ? AND status = ?", chunkID, from).
+		Update("status", to)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// CountCompletedChunks повертає, скільки chunks файлу вже збережено в сховищі.
+// Parity chunk не рахується, тож результат порівнюється з TotalChunks
+func (db *DataBase) CountCompletedChunks(fileID uint) (int, error) {
+	var count int64
+	err := db.DB.Model(&Chunk{}).
+		Where("file_id = ? AND status = ? AND parity = ?", fileID, "completed", false).
+		Count(&count).Error
+	return int(count), err
+}
+
+func (db *DataBase) CountChunksByStatus(fileID uint, status string) (int64, error) {
+	var count int64
+	res := db.DB.Model(&Chunk{}).Where("file_id = ? AND status = ?", fileID, status).Count(&count)
+	if res.Error != nil {
+		return 0, res.Error
+	}
+	return count, nil
+}
+
+func (db *DataBase) UpdateFileStatus(fileID uint, status string) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Update("status", status).Error
+}
+
+// SetFileClient запам'ятовує User-Agent і IP клієнта, який завантажує файл.
+// Порожні значення лишаються NULL
+func (db *DataBase) SetFileClient(fileID uint, userAgent, ip string) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Updates(map[string]any{
+		"upload_user_agent": nullString(userAgent),
+		"upload_ip":         nullString(ip),
+	}).Error
+}
+
+// SetFileDeclaredSize запам'ятовує розмір, який клієнт оголосив до завантаження
+func (db *DataBase) SetFileDeclaredSize(fileID uint, size int64) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Update("declared_size", size).Error
+}
+
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// MarkFileFailed позначає файл failed, наприклад коли його завантаження
+// обірвалось. Такі файли можна знайти через список з фільтром за статусом
+func (db *DataBase) MarkFileFailed(fileID uint) error {
+	return db.UpdateFileStatus(fileID, "failed")
+}
+
+// recomputeStatusSQL виводить статус файлу з його chunks. failed лишається
+// failed, бо файл могли відхилити й тоді, коли жоден chunk не впав, а chunk,
+// що чекає в черзі повторів, ще не вважається failed
+const recomputeStatusSQL = `CASE
+	WHEN status = 'failed' OR EXISTS (
+		SELECT 1 FROM chunks c WHERE c.file_id = files.id AND c.deleted_at IS NULL AND c.status = 'failed'
+		AND NOT EXISTS (SELECT 1 FROM retry_tasks r WHERE r.chunk_id = c.id AND r.deleted_at IS NULL)
+	) THEN 'failed'
+	WHEN status = 'uploading' AND total_chunks = 0 THEN 'uploading'
+	WHEN (
+		SELECT COUNT(*) FROM chunks c WHERE c.file_id = files.id AND c.deleted_at IS NULL AND c.status = 'completed' AND c.parity = ?
+	) >= total_chunks AND NOT EXISTS (
+		SELECT 1 FROM chunks c WHERE c.file_id = files.id AND c.deleted_at IS NULL AND c.status <> 'completed'
+	) THEN 'completed'
+	WHEN status = 'uploading' THEN 'uploading'
+	ELSE 'processing'
+END`
+
+// RecomputeFileStatus зберігає і повертає статус файлу за станом його chunks:
+// failed, якщо якийсь chunk не вдалося відправити, completed, якщо відправлено
+// всі TotalChunks, uploading, поки файл ще приймається, і processing, поки
+// прийняті chunks ще відправляються. Статус рахується одним UPDATE, щоб
+// workers, які закінчують chunks одночасно, не записали застарілий
+func (db *DataBase) RecomputeFileStatus(fileID uint) (string, error) {
+	res := db.DB.Model(&File{}).Where("id = ?", fileID).Update("status", gorm.Expr(recomputeStatusSQL, false))
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		return "", gorm.ErrRecordNotFound
+	}
+
+	var file File
+	if err := db.DB.Select("status").First(&file, fileID).Error; err != nil {
+		return "", err
+	}
+	return file.Status, nil
+}
+
+// CreateDerivedFile створює файл filename, отриманий з source перетворенням
+// transform, з тим самим власником
+func (db *DataBase) CreateDerivedFile(source File, transform, filename string) (uint, error) {
+	file := File{
+		FileName:    filename,
+		Status:      "uploading",
+		OwnerAPIKey: source.OwnerAPIKey,
+		DerivedFrom: &source.ID,
+		Transform:   transform,
+	}
+	if err := db.DB.Create(&file).Error; err != nil {
+		return 0, err
+	}
+	return file.ID, nil
+}
+
+// ClaimFileTransform позначає, що перетворення completed файлу запущено, і
+// повертає false, якщо його вже запустили або файл сам похідний
+func (db *DataBase) ClaimFileTransform(fileID uint) (bool, error) {
+	res := db.DB.Model(&File{}).
+		Where("id = ? AND status = 'completed' AND NOT transformed AND derived_from IS NULL", fileID).
+		Update("transformed", true)
+	return res.RowsAffected == 1, res.Error
+}
+
+// SetFileChecksum зберігає SHA-256 усього файлу
+func (db *DataBase) SetFileChecksum(fileID uint, checksum string) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Update("checksum", checksum).Error
+}
+
+// SetFileContentType змінює MIME тип, з яким файл віддається при завантаженні
+func (db *DataBase) SetFileContentType(fileID uint, contentType string) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Update("content_type", contentType).Error
+}
+
+// RenameFile змінює ім'я файлу, не чіпаючи решту його полів
+func (db *DataBase) RenameFile(fileID uint, name string) error {
+	return db.DB.Model(&File{}).Where("id = ?", fileID).Update("file_name", name).Error
+}
+
+var (
+	ErrKeyNotFound = errors.New("api ключ не знайдено")
+	ErrNotOwner    = errors.New("файл належить іншому ключу")
+)
+
+// RetainedOwner - власник файлів відкликаного ключа, які збережені
+// (KEY_DELETION_POLICY=retain) і чекають, поки адмін передасть їх іншому ключу
+const RetainedOwner = "retained"
+
+// TransferFile передає файл від ключа fromKey до toKey (відкриті значення),
+// обидва ключі мають існувати. Порожній fromKey передає збережений файл
+// відкликаного ключа (RetainedOwner)
+func (db *DataBase) TransferFile(fileID uint, fromKey, toKey string) error {
+	fromOwner := RetainedOwner
+	keys := []string{toKey}
+	if fromKey != "" {
+		fromOwner = HashKey(fromKey)
+		keys = append(keys, fromKey)
+	}
+	for _, key := range keys {
+		exists, err := db.isAPIKeyExist(key)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrKeyNotFound
+		}
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var file File
+		if err := tx.First(&file, fileID).Error; err != nil {
+			return err
+		}
+		if file.OwnerAPIKey != fromOwner {
+			return ErrNotOwner
+		}
+		return tx.Model(&file).Update("owner_api_key", HashKey(toKey)).Error
+	})
+}
+
+// DeletedOlderThan повертає id файлів, м'яко видалених більше ніж d до now
+func (db *DataBase) DeletedOlderThan(now time.Time, d time.Duration) ([]uint, error) {
+	var ids []uint
+	err := db.DB.Unscoped().Model(&File{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", now.Add(-d)).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// PurgeFile остаточно видаляє файл, зокрема м'яко видалений, разом з його
+// chunks, мітками і задачами повторів
+func (db *DataBase) PurgeFile(fileID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return purgeFiles(tx, []uint{fileID})
+	})
+}
+
+// DeleteFile остаточно видаляє файл разом з його chunks, мітками і задачами повторів
+func (db *DataBase) DeleteFile(fileID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var file File
+		if err := tx.Select("id").First(&file, fileID).Error; err != nil {
+			return err
+		}
+		return purgeFiles(tx, []uint{fileID})
+	})
+}
+
+// purgeFiles видаляє з бази файли ids і все, що на них посилається
+func purgeFiles(tx *gorm.DB, ids []uint) error {
+	chunkIDs := tx.Unscoped().Model(&Chunk{}).Select("id").Where("file_id IN ?", ids)
+	if err := tx.Unscoped().Where("chunk_id IN (?)", chunkIDs).Delete(&RetryTask{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Unscoped().Where("file_id IN ?", ids).Delete(&Chunk{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Table("file_tags").Where("file_id IN ?", ids).Delete(nil).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&File{}, ids).Error
+}
+
+// SharedStorageIDs повертає ті з telegramIDs, на які посилаються chunks
+// інших файлів (зокрема видалених, але ще не очищених), наприклад після дедуплікації
+func (db *DataBase) SharedStorageIDs(fileID uint, telegramIDs []string) (map[string]bool, error) {
+	shared := make(map[string]bool)
+	if len(telegramIDs) == 0 {
+		return shared, nil
+	}
+	var ids []string
+	err := db.DB.Unscoped().Model(&Chunk{}).
+		Where("telegram_file_id IN ? AND file_id <> ?", telegramIDs, fileID).
+		Distinct().Pluck("telegram_file_id", &ids).Error
+	for _, id := range ids {
+		shared[id] = true
+	}
+	return shared, err
+}
+
+// UsedBytes повертає сумарний розмір файлів власника (hash ключа), з якого
+// рахується квота. Failed файли не рахуються: їх не завантажити, а завантаження,
+// обірване через квоту, не повинне її займати
+func (db *DataBase) UsedBytes(key string) (int64, error) {
+	var used int64
+	res := db.DB.Model(&File{}).
+		Select("COALESCE(SUM(size), 0)").
+		Where("owner_api_key = ? AND status <> ?", key, "failed").
+		Scan(&used)
+	return used, res.Error
 }
@@ -0,0 +1,546 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ZaViBiS/infinity-storage/clock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func openTestDB(t testing.TB) *DataBase {
+	t.Helper()
+
+	database, err := Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return database
+}
+
+func TestStoredSize(t *testing.T) {
+	database := openTestDB(t)
+
+	fileID, err := database.CreateNewFile("log.txt", 300, "key", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// стиснені chunks займають менше, ніж логічний розмір
+	for i, stored := range []int64{40, 25} {
+		err := database.AddChunkToFile(&Chunk{FileID: fileID, Position: i + 1, Size: 150, StoredSize: stored})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size, err := database.StoredSize(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 65 {
+		t.Fatalf("StoredSize = %d, want 65", size)
+	}
+
+	// два однакові chunks після dedup лежать в одному повідомленні
+	dedupID, err := database.CreateNewFile("twice.txt", 300, "key", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for position := 1; position <= 2; position++ {
+		err := database.AddChunkToFile(&Chunk{FileID: dedupID, Position: position, Size: 150, StoredSize: 150, TelegramFileID: "same"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size, err := database.StoredSize(dedupID); err != nil || size != 150 {
+		t.Fatalf("StoredSize with a deduplicated chunk = %d, err = %v, want 150", size, err)
+	}
+
+	size, err = database.StoredSize(dedupID + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 0 {
+		t.Fatalf("StoredSize of unknown file = %d, want 0", size)
+	}
+}
+
+func TestTransferFile(t *testing.T) {
+	database := openTestDB(t)
+
+	oldKey, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fileID, err := database.CreateNewFile("a.txt", 1, HashKey(oldKey), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := database.TransferFile(fileID, oldKey, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("transfer to unknown key err = %v", err)
+	}
+	if err := database.TransferFile(fileID, newKey, oldKey); !errors.Is(err, ErrNotOwner) {
+		t.Fatalf("transfer from non-owner err = %v", err)
+	}
+
+	if err := database.TransferFile(fileID, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := database.ListFilesByOwner(HashKey(oldKey), FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("old key still lists %d files", len(files))
+	}
+	files, err = database.ListFilesByOwner(HashKey(newKey), FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].ID != fileID {
+		t.Fatalf("new key files = %+v", files)
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	setup := func(t *testing.T) (*DataBase, string, uint) {
+		database := openTestDB(t)
+		key, err := database.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileID, err := database.CreateNewFile("a.txt", 1, HashKey(key), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return database, key, fileID
+	}
+
+	t.Run("retain", func(t *testing.T) {
+		database, key, fileID := setup(t)
+		files, err := database.RevokeAPIKey(HashKey(key), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != 1 {
+			t.Fatalf("retained %d files, want 1", files)
+		}
+		revoked, err := database.GetAPIKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !revoked.Revoked {
+			t.Fatal("key was not revoked")
+		}
+		file, err := database.GetFileByID(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if file.OwnerAPIKey != RetainedOwner {
+			t.Fatalf("owner = %q, want %q", file.OwnerAPIKey, RetainedOwner)
+		}
+
+		// збережений файл адмін передає без старого ключа
+		newKey, err := database.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := database.TransferFile(fileID, "", newKey); err != nil {
+			t.Fatal(err)
+		}
+		if file, _ := database.GetFileByID(fileID); file.OwnerAPIKey != HashKey(newKey) {
+			t.Fatal("retained file was not transferred")
+		}
+	})
+
+	t.Run("cascade", func(t *testing.T) {
+		database, key, fileID := setup(t)
+		if err := database.AddChunkToFile(&Chunk{FileID: fileID, Position: 1}); err != nil {
+			t.Fatal(err)
+		}
+		files, err := database.RevokeAPIKey(HashKey(key), true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if files != 1 {
+			t.Fatalf("deleted %d files, want 1", files)
+		}
+		if _, err := database.GetFileByID(fileID); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Fatalf("file after cascade err = %v", err)
+		}
+		// файл з chunks прибирає звичайна очистка видалених
+		deleted, err := database.DeletedOlderThan(time.Now(), -time.Hour)
+		if err != nil || len(deleted) != 1 || deleted[0] != fileID {
+			t.Fatalf("deleted = %v, err = %v", deleted, err)
+		}
+		if err := database.PurgeFile(fileID); err != nil {
+			t.Fatal(err)
+		}
+		chunks, err := database.GetChunksByFileID(fileID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) != 0 {
+			t.Fatalf("%d chunks left", len(chunks))
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		database := openTestDB(t)
+		if _, err := database.RevokeAPIKey(HashKey("missing"), true); !errors.Is(err, ErrKeyNotFound) {
+			t.Fatalf("err = %v, want ErrKeyNotFound", err)
+		}
+	})
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	database := openTestDB(t)
+	// час м'якого видалення теж береться з fake clock
+	fake := clock.NewFake(time.Now())
+	database.DB.Config.NowFunc = fake.Now
+
+	oldID, err := database.CreateFileWithChunks(File{FileName: "old.txt"}, []Chunk{{Position: 1}, {Position: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.TagFile(oldID, []string{"report"}); err != nil {
+		t.Fatal(err)
+	}
+	recentID, err := database.CreateFileWithChunks(File{FileName: "recent.txt"}, []Chunk{{Position: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// один файл видалено 40 днів тому, другий - щойно
+	if err := database.DB.Delete(&File{}, oldID).Error; err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(40 * 24 * time.Hour)
+	if err := database.DB.Delete(&File{}, recentID).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	deleted, err := database.DeletedOlderThan(fake.Now(), 30*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 1 || deleted[0] != oldID {
+		t.Fatalf("deleted older than 30 days = %v, want [%d]", deleted, oldID)
+	}
+	if err := database.PurgeFile(oldID); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	database.DB.Unscoped().Model(&File{}).Where("id = ?", oldID).Count(&count)
+	if count != 0 {
+		t.Fatal("old file is still in the database")
+	}
+	database.DB.Unscoped().Model(&Chunk{}).Where("file_id = ?", oldID).Count(&count)
+	if count != 0 {
+		t.Fatalf("%d chunks of the old file remain", count)
+	}
+	database.DB.Unscoped().Model(&File{}).Where("id = ?", recentID).Count(&count)
+	if count != 1 {
+		t.Fatal("recently deleted file was purged")
+	}
+}
+
+func TestCreateTablesMigratesChunks(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTables(gormDB); err != nil {
+		t.Fatal(err)
+	}
+
+	migrator := gormDB.Migrator()
+	if !migrator.HasTable("chunks") {
+		t.Fatal("chunks table was not created")
+	}
+	for _, column := range []string{"file_id", "position", "size", "status", "checksum", "telegram_file_id"} {
+		if !migrator.HasColumn(&Chunk{}, column) {
+			t.Fatalf("chunks table has no %s column", column)
+		}
+	}
+}
+
+func TestAPIKeysStoredHashed(t *testing.T) {
+	database := openTestDB(t)
+
+	key, err := database.NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stored Key
+	if err := database.DB.First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Hash != HashKey(key) || stored.Hash == key {
+		t.Fatalf("stored hash = %q", stored.Hash)
+	}
+
+	found, err := database.GetAPIKey(key)
+	if err != nil || found.ID != stored.ID {
+		t.Fatalf("GetAPIKey = %+v, %v", found, err)
+	}
+	if _, err := database.GetAPIKey(stored.Hash); err == nil {
+		t.Fatal("the stored hash works as a key")
+	}
+}
+
+func TestMigrateKeyHashes(t *testing.T) {
+	database := openTestDB(t)
+
+	// стара схема: сирий ключ у колонці key і у власниках файлів
+	if err := database.DB.Exec("ALTER TABLE keys ADD COLUMN `key` text").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Exec("INSERT INTO keys (key, hash, revoked, quota_bytes) VALUES ('legacy-key', '', false, 0)").Error; err != nil {
+		t.Fatal(err)
+	}
+	fileID, err := database.CreateNewFile("old.txt", 1, "legacy-key", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateKeyHashes(database.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := database.GetAPIKey("legacy-key"); err != nil {
+		t.Fatalf("legacy key no longer works: %v", err)
+	}
+	file, err := database.GetFileByID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.OwnerAPIKey != HashKey("legacy-key") {
+		t.Fatalf("owner = %q, want key hash", file.OwnerAPIKey)
+	}
+	columns, err := database.DB.Migrator().ColumnTypes(&Key{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, column := range columns {
+		if column.Name() == "key" {
+			t.Fatal("raw key column was not dropped")
+		}
+	}
+}
+
+func TestMigrateKeyQuota(t *testing.T) {
+	database := openTestDB(t)
+
+	// стара схема: квота в колонці quota
+	if err := database.DB.Exec("ALTER TABLE keys ADD COLUMN `quota` integer").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Exec("INSERT INTO keys (hash, revoked, quota) VALUES (?, false, 500)", HashKey("old-key")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := migrateKeyQuota(database.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := database.GetAPIKey("old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.QuotaBytes != 500 {
+		t.Fatalf("quota = %d, want 500", key.QuotaBytes)
+	}
+	if database.DB.Migrator().HasColumn(&Key{}, "quota") {
+		t.Fatal("old quota column was not dropped")
+	}
+}
+
+func TestGetChunksByFileIDOrdersByPosition(t *testing.T) {
+	database := openTestDB(t)
+	fileID, err := database.CreateNewFile("a.bin", 3, "owner", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, position := range []int{3, 1, 2} {
+		if err := database.AddChunkToFile(&Chunk{FileID: fileID, Position: position, Size: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chunks, err := database.GetChunksByFileID(fileID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks", len(chunks))
+	}
+	for i, chunk := range chunks {
+		if chunk.Position != i+1 {
+			t.Fatalf("chunk %d has position %d", i, chunk.Position)
+		}
+	}
+}
+
+func TestRecomputeFileStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      string // статус файлу до перерахунку
+		totalChunks int
+		chunks      []string
+		retry       bool // перший chunk чекає в черзі повторів
+		want        string
+	}{
+		{name: "still receiving", status: "uploading", chunks: []string{"completed"}, want: "uploading"},
+		{name: "manifest in progress", status: "uploading", totalChunks: 2, chunks: []string{"completed", "pending"}, want: "uploading"},
+		{name: "manifest done", status: "uploading", totalChunks: 2, chunks: []string{"completed", "completed"}, want: "completed"},
+		{name: "received, sending", status: "completed", totalChunks: 2, chunks: []string{"completed"}, want: "processing"},
+		{name: "all sent", status: "processing", totalChunks: 2, chunks: []string{"completed", "completed"}, want: "completed"},
+		{name: "empty file", status: "completed", want: "completed"},
+		{name: "failed chunk", status: "processing", totalChunks: 2, chunks: []string{"failed", "completed"}, want: "failed"},
+		{name: "chunk awaiting retry", status: "processing", totalChunks: 2, chunks: []string{"failed", "completed"}, retry: true, want: "processing"},
+		{name: "failed stays failed", status: "failed", totalChunks: 1, chunks: []string{"completed"}, want: "failed"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			database := openTestDB(t)
+			fileID, err := database.CreateNewFile("a.bin", 0, "owner", tc.totalChunks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := database.UpdateFileStatus(fileID, tc.status); err != nil {
+				t.Fatal(err)
+			}
+			for i, status := range tc.chunks {
+				chunk := &Chunk{FileID: fileID, Position: i + 1, Status: status}
+				if i == 0 && tc.retry {
+					err = database.SaveChunkForRetry(chunk, []byte("data"), time.Now())
+				} else {
+					err = database.AddChunkToFile(chunk)
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// parity chunk не рахується до TotalChunks
+			if err := database.AddChunkToFile(&Chunk{FileID: fileID, Parity: true, Status: "completed"}); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := database.RecomputeFileStatus(fileID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			file, err := database.GetFileByID(fileID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want || file.Status != tc.want {
+				t.Fatalf("status = %q, stored %q, want %q", got, file.Status, tc.want)
+			}
+		})
+	}
+
+	if _, err := openTestDB(t).RecomputeFileStatus(42); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("missing file err = %v", err)
+	}
+}
+
+func TestUpdateFileMetadataWaitsForChunks(t *testing.T) {
+	database := openTestDB(t)
+
+	fileID, err := database.CreateNewFile("", 0, "owner", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.AddChunkToFile(&Chunk{FileID: fileID, Position: 1, Status: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateFileMetadata(fileID, "a.bin", 8, 2); err != nil {
+		t.Fatal(err)
+	}
+	file, err := database.GetFileByID(fileID)
+	if err != nil || file.Status != "processing" || file.FileName != "a.bin" || file.TotalChunks != 2 {
+		t.Fatalf("file = %+v, err = %v", file, err)
+	}
+	if completed, err := database.CountCompletedChunks(fileID); err != nil || completed != 1 {
+		t.Fatalf("completed = %d, err = %v", completed, err)
+	}
+
+	// відхилений файл не оживає від запису метаданих
+	if err := database.UpdateFileStatus(fileID, "failed"); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.UpdateFileMetadata(fileID, "a.bin", 8, 1); err != nil {
+		t.Fatal(err)
+	}
+	if file, _ := database.GetFileByID(fileID); file.Status != "failed" {
+		t.Fatalf("status = %q, want failed", file.Status)
+	}
+}
+
+// benchmarkInsertChunks зберігає chunks файлу з 1000 chunks по одному або пачками
+func benchmarkInsertChunks(b *testing.B, batched bool) {
+	database := openTestDB(b)
+
+	for range b.N {
+		b.StopTimer()
+		fileID, err := database.CreateNewFile("big.bin", 0, "owner", 1000)
+		if err != nil {
+			b.Fatal(err)
+		}
+		chunks := make([]Chunk, 1000)
+		for i := range chunks {
+			chunks[i] = Chunk{FileID: fileID, Position: i + 1, Size: 1024, Status: "completed", TelegramFileID: "tg"}
+		}
+		b.StartTimer()
+
+		if batched {
+			err = database.AddChunks(chunks)
+		} else {
+			for i := range chunks {
+				if err = database.AddChunkToFile(&chunks[i]); err != nil {
+					break
+				}
+			}
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsertChunksSingle(b *testing.B)  { benchmarkInsertChunks(b, false) }
+func BenchmarkInsertChunksBatched(b *testing.B) { benchmarkInsertChunks(b, true) }
+
+func TestAddChunksInBatches(t *testing.T) {
+	database := openTestDB(t)
+
+	// кілька пачок і неповна остання
+	chunks := make([]Chunk, 2*ChunkBatchSize+50)
+	for i := range chunks {
+		chunks[i] = Chunk{FileID: 1, Position: i + 1, Status: "completed"}
+	}
+	if err := database.AddChunks(chunks); err != nil {
+		t.Fatal(err)
+	}
+	for _, chunk := range chunks {
+		if chunk.ID == 0 {
+			t.Fatalf("chunk %d has no id", chunk.Position)
+		}
+	}
+	if completed, err := database.CountCompletedChunks(1); err != nil || completed != len(chunks) {
+		t.Fatalf("saved %d chunks, err = %v, want %d", completed, err, len(chunks))
+	}
+}
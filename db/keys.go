@@ -2,12 +2,33 @@ package db
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+// HashKey повертає hash ключа, за яким ключ зберігається в базі
+// і який записується власником його файлів
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// NewAPIKey створює безстроковий ключ і повертає його. Зберігається лише
+// hash, тому отримати ключ вдруге неможливо
 func (db *DataBase) NewAPIKey() (string, error) {
+	return db.newAPIKey(nil)
+}
+
+// NewExpiringAPIKey створює ключ, який перестає діяти в expiresAt
+func (db *DataBase) NewExpiringAPIKey(expiresAt time.Time) (string, error) {
+	return db.newAPIKey(&expiresAt)
+}
+
+func (db *DataBase) newAPIKey(expiresAt *time.Time) (string, error) {
 	newKey, err := keyGenerator()
 	if err != nil {
 		return "", err
@@ -15,7 +36,7 @@ func (db *DataBase) NewAPIKey() (string, error) {
 
 	res, err := db.isAPIKeyExist(newKey)
 	if res {
-		return db.NewAPIKey()
+		return db.newAPIKey(expiresAt)
 	}
 
 	if !res {
@@ -24,25 +45,84 @@ func (db *DataBase) NewAPIKey() (string, error) {
 		}
 	}
 
-	result := db.DB.Create(&Key{Key: newKey})
+	result := db.DB.Create(&Key{Hash: HashKey(newKey), ExpiresAt: expiresAt})
 	if result.Error != nil {
 		return "", result.Error
 	}
 	return newKey, nil
 }
 
+// GetAPIKey шукає ключ за його відкритим значенням
 func (db *DataBase) GetAPIKey(key string) (Key, error) {
+	return db.GetKeyByHash(HashKey(key))
+}
+
+// GetKeyByHash шукає ключ за hash, наприклад за власником файлу
+func (db *DataBase) GetKeyByHash(hash string) (Key, error) {
 	var foundKey Key
-	result := db.DB.Where("key = ?", key).First(&foundKey)
+	result := db.DB.Where("hash = ?", hash).First(&foundKey)
 	if result.Error != nil {
 		return Key{}, result.Error
 	}
 	return foundKey, nil
 }
 
+// RevokeAPIKey відкликає ключ за його hash і повертає, скільки файлів ключа
+// оброблено: з cascade вони м'яко видаляються (і згодом janitor прибирає їх
+// разом з chunks у сховищі), інакше переходять до RetainedOwner
+func (db *DataBase) RevokeAPIKey(hash string, cascade bool) (int64, error) {
+	var files int64
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Key{}).Where("hash = ?", hash).Update("revoked", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrKeyNotFound
+		}
+
+		owned := tx.Where("owner_api_key = ?", hash)
+		if cascade {
+			res = owned.Delete(&File{})
+		} else {
+			res = owned.Model(&File{}).Update("owner_api_key", RetainedOwner)
+		}
+		files = res.RowsAffected
+		return res.Error
+	})
+	return files, err
+}
+
+// KeyUsage - скільки файлів і байтів зберігає ключ
+type KeyUsage struct {
+	Key   string `gorm:"column:owner_api_key"`
+	Bytes int64
+	Files int64
+}
+
+// UsageByOwner повертає використання сховища кожним ключем, що має файли
+func (db *DataBase) UsageByOwner() ([]KeyUsage, error) {
+	var usage []KeyUsage
+	res := db.DB.Model(&File{}).
+		Select("owner_api_key, COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files").
+		Group("owner_api_key").
+		Scan(&usage)
+	return usage, res.Error
+}
+
+// KeyUsage повертає використання сховища одним ключем
+func (db *DataBase) KeyUsage(key string) (bytes int64, files int64, err error) {
+	var usage KeyUsage
+	res := db.DB.Model(&File{}).
+		Select("COALESCE(SUM(size), 0) AS bytes, COUNT(*) AS files").
+		Where("owner_api_key = ?", key).
+		Scan(&usage)
+	return usage.Bytes, usage.Files, res.Error
+}
+
 func (db *DataBase) isAPIKeyExist(key string) (bool, error) {
 	var foundKey Key
-	result := db.DB.Where("key = ?", key).First(&foundKey)
+	result := db.DB.Where("hash = ?", HashKey(key)).First(&foundKey)
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
 			return false, nil
@@ -0,0 +1,85 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// пріоритети відправки chunks (Chunk.Priority)
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// claimAttempts - скільки разів ClaimPendingChunk шукає інший chunk, якщо
+// знайдений встиг забрати інший сервер
+const claimAttempts = 5
+
+// QueueChunk зберігає chunk разом з даними як queued, щоб його відправив
+// будь-який сервер зі спільною базою
+func (db *DataBase) QueueChunk(c *Chunk) error {
+	c.Status = "queued"
+	c.ClaimedBy = ""
+	c.ClaimedAt = nil
+	return db.DB.Save(c).Error
+}
+
+// ClaimPendingChunk атомарно забирає найстаріший queued chunk з найвищим
+// пріоритетом для instance і повертає його з даними. Chunk, взятий до staleBefore, вважається
+// покинутим і теж може бути забраний. Якщо забирати нічого,
+// повертає gorm.ErrRecordNotFound
+func (db *DataBase) ClaimPendingChunk(instance string, now, staleBefore time.Time) (Chunk, error) {
+	claimable := func(tx *gorm.DB) *gorm.DB {
+		return tx.Where("status = ? AND (claimed_at IS NULL OR claimed_at < ?)", "queued", staleBefore)
+	}
+
+	for range claimAttempts {
+		var candidate Chunk
+		err := db.DB.Model(&Chunk{}).Scopes(claimable).Select("id").Order("priority DESC, id").First(&candidate).Error
+		if err != nil {
+			return Chunk{}, err
+		}
+
+		// умова повторюється в UPDATE: якщо між пошуком і оновленням chunk
+		// забрав інший сервер, рядок не зміниться
+		res := db.DB.Model(&Chunk{}).Scopes(claimable).
+			Where("id = ?", candidate.ID).
+			Updates(map[string]any{"claimed_by": instance, "claimed_at": now})
+		if res.Error != nil {
+			return Chunk{}, res.Error
+		}
+		if res.RowsAffected == 1 {
+			var chunk Chunk
+			err := db.DB.First(&chunk, candidate.ID).Error
+			return chunk, err
+		}
+	}
+	return Chunk{}, gorm.ErrRecordNotFound
+}
+
+// RenewChunkClaim оновлює час, коли instance взяв chunk, щоб довга відправка
+// не виглядала покинутою. false - chunk уже не queued або його забрав інший сервер
+func (db *DataBase) RenewChunkClaim(chunkID uint, instance string, now time.Time) (bool, error) {
+	res := db.DB.Model(&Chunk{}).
+		Where("id = ? AND status = ? AND claimed_by = ?", chunkID, "queued", instance).
+		Update("claimed_at", now)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ReleaseChunkClaims повертає в чергу chunks, взяті instance, наприклад
+// після його перезапуску, щоб не чекати, поки вони стануть покинутими
+func (db *DataBase) ReleaseChunkClaims(instance string) (int64, error) {
+	res := db.DB.Model(&Chunk{}).
+		Where("status = ? AND claimed_by = ?", "queued", instance).
+		Updates(map[string]any{"claimed_by": "", "claimed_at": nil})
+	return res.RowsAffected, res.Error
+}
+
+// CountQueuedChunks повертає кількість chunks, що чекають у спільній черзі
+func (db *DataBase) CountQueuedChunks() (int64, error) {
+	var count int64
+	err := db.DB.Model(&Chunk{}).Where("status = ? AND claimed_at IS NULL", "queued").Count(&count).Error
+	return count, err
+}
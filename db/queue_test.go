@@ -0,0 +1,156 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func TestClaimPendingChunkDisjoint(t *testing.T) {
+	// два сервери зі спільною базою - два окремі з'єднання з одним файлом
+	path := filepath.Join(t.TempDir(), "shared.db")
+	first, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const total = 30
+	fileID, err := first.CreateNewFile("big.bin", total, "key", total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for position := 1; position <= total; position++ {
+		if err := first.QueueChunk(&Chunk{FileID: fileID, Position: position, Data: []byte{byte(position)}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	var mu sync.Mutex
+	claimed := map[uint]string{}
+	var wg sync.WaitGroup
+	for instance, database := range map[string]*DataBase{"a": first, "b": second} {
+		for range 2 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for {
+					chunk, err := database.ClaimPendingChunk(instance, now, now.Add(-time.Hour))
+					if errors.Is(err, gorm.ErrRecordNotFound) {
+						return
+					}
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if len(chunk.Data) != 1 || chunk.ClaimedBy != instance {
+						t.Errorf("claimed chunk = %+v", chunk)
+					}
+
+					mu.Lock()
+					if other, ok := claimed[chunk.ID]; ok {
+						t.Errorf("chunk %d claimed by both %s and %s", chunk.ID, other, instance)
+					}
+					claimed[chunk.ID] = instance
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	if len(claimed) != total {
+		t.Fatalf("claimed %d chunks, want %d", len(claimed), total)
+	}
+	if count, err := second.CountQueuedChunks(); err != nil || count != 0 {
+		t.Fatalf("queued = %d, err = %v", count, err)
+	}
+}
+
+func TestClaimPendingChunkReclaim(t *testing.T) {
+	database := openTestDB(t)
+
+	chunk := Chunk{FileID: 1, Position: 1}
+	if err := database.QueueChunk(&chunk); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := database.ClaimPendingChunk("a", now, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// поки claim свіжий, chunk нікому не видається
+	if _, err := database.ClaimPendingChunk("b", now, now.Add(-time.Hour)); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("claim of a claimed chunk err = %v", err)
+	}
+	// покинутий сервером, що впав, chunk забирає інший
+	later := now.Add(2 * time.Hour)
+	reclaimed, err := database.ClaimPendingChunk("b", later, later.Add(-time.Hour))
+	if err != nil || reclaimed.ID != chunk.ID || reclaimed.ClaimedBy != "b" {
+		t.Fatalf("reclaimed = %+v, err = %v", reclaimed, err)
+	}
+
+	// після перезапуску сервер повертає свої chunks у чергу одразу
+	released, err := database.ReleaseChunkClaims("b")
+	if err != nil || released != 1 {
+		t.Fatalf("released = %d, err = %v", released, err)
+	}
+	if _, err := database.ClaimPendingChunk("b", later, later.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRenewChunkClaim(t *testing.T) {
+	database := openTestDB(t)
+
+	chunk := Chunk{FileID: 1, Position: 1}
+	if err := database.QueueChunk(&chunk); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	if _, err := database.ClaimPendingChunk("a", now, now.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// "a" ще відправляє chunk і продовжує claim, тож за годину він не покинутий
+	later := now.Add(2 * time.Hour)
+	if held, err := database.RenewChunkClaim(chunk.ID, "a", later.Add(-time.Minute)); err != nil || !held {
+		t.Fatalf("renew = %v, err = %v", held, err)
+	}
+	if _, err := database.ClaimPendingChunk("b", later, later.Add(-time.Hour)); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("claim of a renewed chunk err = %v", err)
+	}
+
+	// чужий claim продовжити не можна
+	if held, err := database.RenewChunkClaim(chunk.ID, "b", later); err != nil || held {
+		t.Fatalf("renew by another instance = %v, err = %v", held, err)
+	}
+}
+
+func TestClaimPendingChunkPriority(t *testing.T) {
+	database := openTestDB(t)
+
+	low := Chunk{FileID: 1, Position: 1, Priority: PriorityLow}
+	high := Chunk{FileID: 2, Position: 1, Priority: PriorityHigh}
+	for _, chunk := range []*Chunk{&low, &high} {
+		if err := database.QueueChunk(chunk); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now := time.Now()
+	for _, want := range []uint{high.ID, low.ID} {
+		chunk, err := database.ClaimPendingChunk("a", now, now.Add(-time.Hour))
+		if err != nil || chunk.ID != want {
+			t.Fatalf("claimed = %+v, err = %v, want chunk %d", chunk, err, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package db
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EnqueueRetry додає chunk у чергу повторної відправки (або оновлює існуючий запис)
+func (db *DataBase) EnqueueRetry(chunkID uint, data []byte, next time.Time) error {
+	task := RetryTask{ChunkID: chunkID}
+	if err := db.DB.Where(RetryTask{ChunkID: chunkID}).FirstOrInit(&task).Error; err != nil {
+		return err
+	}
+	task.Data = data
+	task.NextAttemptAt = next
+	return db.DB.Save(&task).Error
+}
+
+// SaveChunkForRetry зберігає chunk, який не вдалося відправити, і в тій самій
+// транзакції ставить його в чергу повторів, щоб RecomputeFileStatus ніколи
+// не побачив його failed без задачі повтору
+func (db *DataBase) SaveChunkForRetry(c *Chunk, data []byte, next time.Time) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(c).Error; err != nil {
+			return err
+		}
+		task := RetryTask{ChunkID: c.ID}
+		if err := tx.Where(RetryTask{ChunkID: c.ID}).FirstOrInit(&task).Error; err != nil {
+			return err
+		}
+		task.Data = data
+		task.NextAttemptAt = next
+		return tx.Save(&task).Error
+	})
+}
+
+// DueRetries повертає до limit задач, час яких настав до now
+func (db *DataBase) DueRetries(now time.Time, limit int) ([]RetryTask, error) {
+	var tasks []RetryTask
+	res := db.DB.Where("next_attempt_at <= ?", now).
+		Order("next_attempt_at").
+		Limit(limit).
+		Find(&tasks)
+	return tasks, res.Error
+}
+
+// SaveRetry зберігає кількість спроб і час наступної спроби
+func (db *DataBase) SaveRetry(task *RetryTask) error {
+	return db.DB.Save(task).Error
+}
+
+// DeleteRetry видаляє задачу з черги разом з даними chunk
+func (db *DataBase) DeleteRetry(id uint) error {
+	return db.DB.Unscoped().Delete(&RetryTask{}, id).Error
+}
+
+// GetChunkByID повертає chunk за його id
+func (db *DataBase) GetChunkByID(chunkID uint) (Chunk, error) {
+	var chunk Chunk
+	res := db.DB.First(&chunk, chunkID)
+	return chunk, res.Error
+}
@@ -2,6 +2,8 @@
 package db
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -13,8 +15,33 @@ type File struct {
 	FileName    string `json:"filename"`
 	Size        int64  `json:"size"`
 	TotalChunks int
-	Status      string // uploading/completed/failed
+	ContentType string `json:"content_type"` // порожній - application/octet-stream
+	// Checksum - SHA-256 (hex) усього файлу, порахований при завантаженні.
+	// Порожній, якщо файл завантажено частинами, які сервер не бачив разом
+	Checksum    string `json:"checksum,omitempty"`
+	Status      string // uploading/processing/completed/failed
 	OwnerAPIKey string `gorm:"index"`
+	Tags        []Tag  `gorm:"many2many:file_tags;" json:"tags"`
+	// UploadUserAgent і UploadIP - клієнт, який завантажив файл, для аудиту.
+	// Віддаються лише адмінським ендпоінтам, тож у JSON файлу їх немає
+	UploadUserAgent *string `json:"-"`
+	UploadIP        *string `json:"-"`
+	// DeclaredSize - розмір з X-Total-Size, оголошений до завантаження,
+	// nil - клієнт його не оголосив
+	DeclaredSize *int64 `json:"-"`
+	// DerivedFrom - файл, з якого цей створено перетворенням Transform,
+	// nil - файл завантажив клієнт
+	DerivedFrom *uint  `gorm:"index" json:"derived_from,omitempty"`
+	Transform   string `json:"transform,omitempty"`
+	// Transformed - перетворення файлу вже запущено, тож похідні файли
+	// не створюються вдруге
+	Transformed bool `json:"-"`
+}
+
+// Tag - мітка, якою клієнт позначає файли для фільтрації
+type Tag struct {
+	ID   uint   `gorm:"primaryKey" json:"-"`
+	Name string `gorm:"uniqueIndex" json:"name"`
 }
 
 // Chunk - зберігає id файлу і його позицію в основному файлі
@@ -26,15 +53,64 @@ type Chunk struct {
 	FileID         uint
 	Position       int
 	Size           int64
-	Status         string // pending/uploading/completed/failed
+	StoredSize     int64  // скільки байтів chunk займає в сховищі (після стиснення тощо)
+	Status         string // pending/queued/uploading/completed/failed
+	Checksum       string `gorm:"index"` // checksum даних chunk у hex
+	Parity         bool   // XOR усіх chunks файлу, Position у нього 0
+	RetryCount     int    // скільки разів відправку повторювали
+	LastError      string // остання помилка відправки
 	TelegramFileID string
-	Data           []byte
+	// MessageID - id повідомлення з chunk у чаті сховища, за яким його
+	// видаляють. 0 - невідомий (chunks, збережені до появи цього поля)
+	MessageID int
+	// ChecksumAlgorithm - яким алгоритмом пораховано Checksum, порожній - sha256
+	ChecksumAlgorithm string
+	// Compressed - chunk у сховищі стиснений zstd, Checksum рахується до стиснення
+	Compressed bool
+	// Nonce - nonce AES-GCM, яким chunk зашифровано перед відправкою (після
+	// стиснення). Порожній - chunk у сховищі не зашифрований
+	Nonce []byte
+	// SubParts - id частин у сховищі, якщо chunk був більший за ліміт
+	// сховища і його довелось розділити при відправці
+	SubParts []string `gorm:"serializer:json;type:text"`
+	// SubPartMessages - id повідомлень частин SubParts у тому самому порядку
+	SubPartMessages []int `gorm:"serializer:json;type:text"`
+	// Priority - пріоритет відправки з черги (PriorityHigh/Normal/Low)
+	Priority int
+	// FileName - ім'я файлу, з якого chunk, для імені документа в сховищі.
+	// Порожнє - ім'я береться з запису файлу
+	FileName string
+	// ClaimedBy і ClaimedAt - який сервер і коли взяв queued chunk зі спільної черги
+	ClaimedBy string
+	ClaimedAt *time.Time `gorm:"index"`
+	// Data - дані chunk, поки він чекає у спільній черзі, потім очищаються
+	Data []byte
 }
 
 // Key - зберігає api ключи для перевірки
 // Key - saves api keys for auth
 type Key struct {
-	// TODO: зробити hash суму замість сирого ключа
 	gorm.Model
-	Key string
+	// Hash - sha256 ключа в hex, сам ключ не зберігається. Hash же записується
+	// в File.OwnerAPIKey як власник файлів
+	Hash      string `gorm:"index"`
+	Revoked   bool
+	ExpiresAt *time.Time // nil - ключ безстроковий
+	// QuotaBytes - скільки байтів можна зберігати, 0 - без обмеження
+	QuotaBytes int64
+}
+
+// Active - ключ не відкликаний і не прострочений на момент now
+func (k Key) Active(now time.Time) bool {
+	return !k.Revoked && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// RetryTask - chunk, який не вдалося відправити, разом з його даними,
+// щоб фоновий retrier міг повторити відправку пізніше
+type RetryTask struct {
+	gorm.Model
+	ChunkID       uint `gorm:"uniqueIndex"`
+	Attempts      int
+	NextAttemptAt time.Time `gorm:"index"`
+	Data          []byte
 }
@@ -0,0 +1,80 @@
+package db
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// FileFilter - умови вибірки файлів ключа, порожні поля не фільтрують
+type FileFilter struct {
+	Tag    string
+	Status string
+	// Columns - колонки files, які треба прочитати (id читається завжди).
+	// Порожній - усі колонки
+	Columns []string
+	// SkipTags - не завантажувати мітки файлів
+	SkipTags bool
+}
+
+// TagFile додає файлу мітки, яких ще немає в базі - створює
+func (db *DataBase) TagFile(fileID uint, names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		tags := make([]Tag, len(names))
+		for i, name := range names {
+			if err := tx.Where(Tag{Name: name}).FirstOrCreate(&tags[i]).Error; err != nil {
+				return err
+			}
+		}
+
+		file := File{Model: gorm.Model{ID: fileID}}
+		return tx.Model(&file).Association("Tags").Append(tags)
+	})
+}
+
+// ListFilesByOwner повертає файли ключа разом з мітками
+func (db *DataBase) ListFilesByOwner(key string, filter FileFilter) ([]File, error) {
+	var files []File
+	if err := db.filesByOwner(key, filter).Find(&files).Error; err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// EachFileByOwner передає файли ключа (з мітками) у fn частинами по batchSize
+// за зростанням id, не завантажуючи весь список у пам'ять. Помилка fn зупиняє обхід
+func (db *DataBase) EachFileByOwner(key string, filter FileFilter, batchSize int, fn func([]File) error) error {
+	var files []File
+	return db.filesByOwner(key, filter).FindInBatches(&files, batchSize, func(_ *gorm.DB, _ int) error {
+		return fn(files)
+	}).Error
+}
+
+func (db *DataBase) filesByOwner(key string, filter FileFilter) *gorm.DB {
+	query := db.DB.Where("owner_api_key = ?", key)
+	if !filter.SkipTags {
+		query = query.Preload("Tags")
+	}
+	if len(filter.Columns) > 0 {
+		columns := filter.Columns
+		if !slices.Contains(columns, "id") {
+			// id потрібен для порядку FindInBatches і для Preload міток
+			columns = append([]string{"id"}, columns...)
+		}
+		query = query.Select(columns)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Tag != "" {
+		query = query.Where("id IN (?)", db.DB.Table("file_tags").
+			Select("file_tags.file_id").
+			Joins("JOIN tags ON tags.id = file_tags.tag_id").
+			Where("tags.name = ?", filter.Tag))
+	}
+	return query
+}
@@ -0,0 +1,90 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestListFilesByTag(t *testing.T) {
+	database := openTestDB(t)
+
+	report, err := database.CreateNewFile("report.pdf", 1, "key", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo, err := database.CreateNewFile("photo.jpg", 1, "key", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign, err := database.CreateNewFile("foreign.pdf", 1, "other", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for fileID, tags := range map[uint][]string{
+		report:  {"report", "2024"},
+		photo:   {"2024"},
+		foreign: {"report"},
+	} {
+		if err := database.TagFile(fileID, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := database.ListFilesByOwner("key", FileFilter{Tag: "report"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].ID != report || len(files[0].Tags) != 2 {
+		t.Fatalf("files tagged report = %+v", files)
+	}
+
+	files, err = database.ListFilesByOwner("key", FileFilter{Tag: "2024"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files tagged 2024, want 2", len(files))
+	}
+
+	files, err = database.ListFilesByOwner("key", FileFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files without filter, want 2", len(files))
+	}
+}
+
+func TestEachFileByOwnerInBatches(t *testing.T) {
+	database := openTestDB(t)
+
+	var want []uint
+	for i := range 5 {
+		fileID, err := database.CreateNewFile(fmt.Sprintf("%d.txt", i), 1, "key", 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, fileID)
+	}
+	if _, err := database.CreateNewFile("foreign.txt", 1, "other", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []uint
+	var batches int
+	err := database.EachFileByOwner("key", FileFilter{}, 2, func(files []File) error {
+		batches++
+		for _, file := range files {
+			got = append(got, file.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batches != 3 || !slices.Equal(got, want) {
+		t.Fatalf("got %v in %d batches, want %v in 3", got, batches, want)
+	}
+}
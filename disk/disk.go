@@ -0,0 +1,12 @@
+// Package disk повідомляє, скільки вільного місця на диску з файлом
+package disk
+
+import "errors"
+
+// ErrUnsupported - на цій платформі вільне місце дізнатись не можна
+var ErrUnsupported = errors.New("перевірка вільного місця не підтримується на цій платформі")
+
+// Free повертає, скільки байтів на диску з path доступно непривілейованому процесу
+func Free(path string) (uint64, error) {
+	return free(path)
+}
@@ -0,0 +1,7 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package disk
+
+func free(string) (uint64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,22 @@
+package disk
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFree(t *testing.T) {
+	free, err := Free(t.TempDir())
+	if errors.Is(err, ErrUnsupported) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if free == 0 {
+		t.Fatal("no free space reported for the temp dir")
+	}
+	if _, err := Free("/no/such/dir"); err == nil {
+		t.Fatal("missing dir did not fail")
+	}
+}
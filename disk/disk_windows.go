@@ -0,0 +1,17 @@
+//go:build windows
+
+package disk
+
+import "golang.org/x/sys/windows"
+
+func free(path string) (uint64, error) {
+	name, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err := windows.GetDiskFreeSpaceEx(name, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
 	"github.com/ZaViBiS/infinity-storage/api"
+	"github.com/ZaViBiS/infinity-storage/config"
 	"github.com/ZaViBiS/infinity-storage/db"
-	"github.com/ZaViBiS/infinity-storage/tgbot"
+	"github.com/ZaViBiS/infinity-storage/recovery"
+	"github.com/ZaViBiS/infinity-storage/storage"
+	"github.com/rs/zerolog/log"
 )
 
 func main() {
-	tgbot, err := tgbot.BotInit()
+	rebuild := flag.Bool("rebuild", false, "відновити записи бази з підписів chunks, пересланих у чат сховища, і вийти")
+	flag.Parse()
+
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+
+	backend, err := storage.New(cfg)
 	if err != nil {
 		panic(err)
 	}
@@ -16,7 +34,39 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	if err := db.SetQueryTimeout(cfg.DBQueryTimeout); err != nil {
+		panic(err)
+	}
+
+	if *rebuild {
+		source, ok := backend.(recovery.MessageSource)
+		if !ok {
+			panic(fmt.Errorf("відновлення підтримується лише для бекенду %s", storage.Telegram))
+		}
+		if _, err := recovery.Rebuild(db, source, cfg); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	server := api.NewServer(cfg, backend, db, nil)
+	go func() {
+		if err := server.Start(); err != nil {
+			log.Fatal().Err(err).Msg("помилка запуску http серверу")
+		}
+	}()
 
-	server := api.NewServer(tgbot, db)
-	server.Start()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Info().Msg("зупинка сервера, чекаємо на завантаження")
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Stop(ctx); err != nil {
+		log.Err(err).Msg("частина chunks з черги не встигла відправитись")
+	}
+	if err := server.Shutdown(ctx); err != nil {
+		log.Err(err).Msg("помилка зупинки http серверу")
+	}
 }
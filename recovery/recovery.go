@@ -0,0 +1,191 @@
+// Package recovery відновлює записи бази з підписів chunks, які бот отримав
+// як оновлення. Свої ж відправлені chunks бот так не бачить, тому це не
+// резервна копія бази: відновлюється лише те, що в чат сховища переслали
+package recovery
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+)
+
+// MessageSource - джерело історії повідомлень чату сховища
+type MessageSource interface {
+	ChunkMessages() ([]tgbotapi.Message, error)
+}
+
+// Report - підсумок відновлення
+type Report struct {
+	Files   int `json:"files"`   // створено записів File
+	Chunks  int `json:"chunks"`  // створено записів Chunk
+	Skipped int `json:"skipped"` // повідомлення без підпису chunk
+}
+
+// ErrUnsupportedConfig - chunks можуть бути збережені у вигляді, який з підпису
+// не відновити: nonce шифрування, ознака стиснення і частини поділеного chunk
+// у підпис не пишуться
+var ErrUnsupportedConfig = errors.New("відновлення не підтримує STORAGE_KEY, COMPRESS_CHUNKS і MAX_PART_SIZE, менший за CHUNK_SIZE")
+
+// checkConfig перевіряє, що chunks, збережені з cfg, можна відновити з підписів
+func checkConfig(cfg config.Config) error {
+	chunkSize := int64(cfg.ChunkSize)
+	if chunkSize <= 0 {
+		chunkSize = config.DefaultChunkSize
+	}
+	if len(cfg.StorageKey) > 0 || cfg.CompressChunks || (cfg.MaxPartSize > 0 && cfg.MaxPartSize < chunkSize) {
+		return ErrUnsupportedConfig
+	}
+	return nil
+}
+
+// Rebuild сканує повідомлення з source і створює записи File і Chunk,
+// яких немає в базі. Ім'я файлу і власник не зберігаються в підписі,
+// тому відновлені файли отримують ім'я recovered-<id> і порожнього власника.
+// З cfg, за якого chunks зберігаються не як є, Rebuild нічого не робить і
+// повертає ErrUnsupportedConfig
+func Rebuild(database *db.DataBase, source MessageSource, cfg config.Config) (Report, error) {
+	if err := checkConfig(cfg); err != nil {
+		return Report{}, err
+	}
+
+	messages, err := source.ChunkMessages()
+	if err != nil {
+		return Report{}, fmt.Errorf("помилка отримання повідомлень: %w", err)
+	}
+	if len(messages) == 0 {
+		log.Warn().Msg("бот не отримав жодного документа: відправлені ним самим chunks не видно, їх треба переслати в чат сховища")
+	}
+
+	var report Report
+	files := make(map[uint][]db.Chunk)
+	for _, message := range messages {
+		if message.Document == nil {
+			report.Skipped++
+			continue
+		}
+		caption, err := tgbot.ParseChunkCaption(message.Caption)
+		if err != nil {
+			report.Skipped++
+			continue
+		}
+
+		files[caption.FileID] = append(files[caption.FileID], db.Chunk{
+			FileID:            caption.FileID,
+			Position:          caption.Position,
+			Size:              int64(message.Document.FileSize),
+			Status:            "completed",
+			Checksum:          caption.Checksum,
+			ChecksumAlgorithm: caption.Algorithm,
+			TelegramFileID:    message.Document.FileID,
+			MessageID:         message.MessageID,
+			Parity:            caption.Position == 0,
+		})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for fileID, chunks := range files {
+			created, err := restoreFile(tx, fileID, chunks)
+			if err != nil {
+				return err
+			}
+			if created {
+				report.Files++
+			}
+
+			for _, chunk := range chunks {
+				created, err := restoreChunk(tx, chunk)
+				if err != nil {
+					return err
+				}
+				if created {
+					report.Chunks++
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	log.Info().
+		Int("files", report.Files).
+		Int("chunks", report.Chunks).
+		Int("skipped", report.Skipped).
+		Msg("базу відновлено з телеграму")
+
+	return report, nil
+}
+
+func restoreFile(tx *gorm.DB, fileID uint, chunks []db.Chunk) (bool, error) {
+	var count int64
+	if err := tx.Unscoped().Model(&db.File{}).Where("id = ?", fileID).Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	var data []db.Chunk
+	for _, chunk := range chunks {
+		if !chunk.Parity {
+			data = append(data, chunk)
+		}
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i].Position < data[j].Position
+	})
+
+	var size int64
+	totalChunks := 0
+	complete := len(data) > 0
+	for i, chunk := range data {
+		size += chunk.Size
+		totalChunks = chunk.Position
+		if chunk.Position != i+1 {
+			complete = false
+		}
+	}
+
+	status := "completed"
+	if !complete {
+		status = "failed"
+	}
+
+	file := db.File{
+		Model:       gorm.Model{ID: fileID},
+		FileName:    fmt.Sprintf("recovered-%d", fileID),
+		Size:        size,
+		TotalChunks: totalChunks,
+		Status:      status,
+	}
+	if err := tx.Create(&file).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func restoreChunk(tx *gorm.DB, chunk db.Chunk) (bool, error) {
+	var count int64
+	err := tx.Model(&db.Chunk{}).
+		Where("file_id = ? AND position = ?", chunk.FileID, chunk.Position).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if err := tx.Create(&chunk).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
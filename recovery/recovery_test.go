@@ -0,0 +1,128 @@
+package recovery
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/db"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+type fakeSource []tgbotapi.Message
+
+func (s fakeSource) ChunkMessages() ([]tgbotapi.Message, error) {
+	return s, nil
+}
+
+func chunkMessage(fileID uint, position int, telegramID string, size int) tgbotapi.Message {
+	return tgbotapi.Message{
+		Caption: tgbot.ChunkCaption{FileID: fileID, Position: position, Checksum: "sum-" + telegramID}.String(),
+		Document: &tgbotapi.Document{
+			FileID:   telegramID,
+			FileSize: size,
+		},
+	}
+}
+
+func TestRebuild(t *testing.T) {
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	source := fakeSource{
+		chunkMessage(7, 2, "b", 5),
+		{Text: "hello"},
+		chunkMessage(7, 1, "a", 10),
+		{Caption: "holiday photos", Document: &tgbotapi.Document{FileID: "x"}},
+		chunkMessage(9, 2, "c", 3),
+		chunkMessage(7, 0, "p", 10),
+	}
+
+	report, err := Rebuild(database, source, config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 2 || report.Chunks != 4 || report.Skipped != 2 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	file, err := database.GetFileByID(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Size != 15 || file.TotalChunks != 2 || file.Status != "completed" {
+		t.Fatalf("file 7 = %+v", file)
+	}
+
+	chunks, err := database.GetChunksByFileID(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks for file 7", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if chunk.Checksum != "sum-"+chunk.TelegramFileID {
+			t.Errorf("chunk %d checksum = %q", chunk.Position, chunk.Checksum)
+		}
+	}
+
+	// файл 9 без першого chunk не можна зібрати
+	file, err = database.GetFileByID(9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Status != "failed" {
+		t.Fatalf("file 9 status = %q, want failed", file.Status)
+	}
+
+	// повторний запуск нічого не дублює
+	report, err = Rebuild(database, source, config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 0 || report.Chunks != 0 {
+		t.Fatalf("second rebuild report = %+v", report)
+	}
+}
+
+func TestRebuildRefusesTransformedChunks(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"encryption", config.Config{StorageKey: make([]byte, 32)}},
+		{"compression", config.Config{CompressChunks: true}},
+		{"split parts", config.Config{ChunkSize: 1024, MaxPartSize: 512}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			source := fakeSource{chunkMessage(7, 1, "a", 10)}
+
+			if _, err := Rebuild(database, source, tt.cfg); !errors.Is(err, ErrUnsupportedConfig) {
+				t.Fatalf("err = %v, want ErrUnsupportedConfig", err)
+			}
+			if _, err := database.GetFileByID(7); err == nil {
+				t.Fatal("file was restored despite the unsupported config")
+			}
+		})
+	}
+
+	// поділ не діє, якщо частина не менша за chunk
+	database, err := db.Open(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Config{ChunkSize: 1024, MaxPartSize: 1024}
+	if _, err := Rebuild(database, fakeSource{chunkMessage(7, 1, "a", 10)}, cfg); err != nil {
+		t.Fatalf("rebuild without splitting: %v", err)
+	}
+}
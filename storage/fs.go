@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// FSBackend зберігає chunks у файлах локальної директорії,
+// корисно для розробки і для розгортань без телеграму
+type FSBackend struct {
+	dir string
+}
+
+func NewFSBackend(dir string) (*FSBackend, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("помилка створення директорії сховища: %w", err)
+	}
+	return &FSBackend{dir: dir}, nil
+}
+
+// SendFile записує дані в новий файл і повертає його id,
+// fileName і caption для цього бекенду не потрібні
+func (b *FSBackend) SendFile(fileName string, data []byte, caption string) (string, error) {
+	id, err := newFileID()
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(b.dir, id), data, 0o640); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// SendFileStream копіює r у новий файл і повертає його id
+func (b *FSBackend) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	id, err := newFileID()
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(filepath.Join(b.dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o640)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+func newFileID() (string, error) {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+func (b *FSBackend) GetFileByID(fileID string) ([]byte, error) {
+	// id генерує SendFile, тому він не може містити шлях
+	if fileID == "" || filepath.Base(fileID) != fileID {
+		return nil, fmt.Errorf("некоректний id файлу %q", fileID)
+	}
+	return os.ReadFile(filepath.Join(b.dir, fileID))
+}
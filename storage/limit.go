@@ -0,0 +1,75 @@
+package storage
+
+import "io"
+
+// limitedBackend обмежує кількість одночасних операцій зі сховищем:
+// відправки і завантаження ділять один семафор
+type limitedBackend struct {
+	backend Backend
+	sem     chan struct{}
+}
+
+// limitedStreamBackend - limitedBackend для бекендів з потоковою відправкою
+type limitedStreamBackend struct {
+	*limitedBackend
+	stream StreamSender
+}
+
+// Limit повертає backend, який виконує не більше n операцій одночасно,
+// n <= 0 - без обмеження
+func Limit(backend Backend, n int) Backend {
+	if n <= 0 {
+		return backend
+	}
+	limited := &limitedBackend{backend: backend, sem: make(chan struct{}, n)}
+	if stream, ok := backend.(StreamSender); ok {
+		return &limitedStreamBackend{limitedBackend: limited, stream: stream}
+	}
+	return limited
+}
+
+func (b *limitedBackend) acquire() func() {
+	b.sem <- struct{}{}
+	return func() { <-b.sem }
+}
+
+func (b *limitedBackend) SendFile(fileName string, data []byte, caption string) (string, error) {
+	defer b.acquire()()
+	return b.backend.SendFile(fileName, data, caption)
+}
+
+func (b *limitedBackend) GetFileByID(fileID string) ([]byte, error) {
+	defer b.acquire()()
+	return b.backend.GetFileByID(fileID)
+}
+
+func (b *limitedBackend) DirectURL(fileID string) (string, error) {
+	defer b.acquire()()
+	return DirectURL(b.backend, fileID)
+}
+
+func (b *limitedBackend) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	defer b.acquire()()
+	return Send(b.backend, fileName, data, caption)
+}
+
+func (b *limitedBackend) DeleteFile(fileID string, messageID int) error {
+	defer b.acquire()()
+	return Delete(b.backend, fileID, messageID)
+}
+
+func (b *limitedStreamBackend) SendFileStreamMessage(fileName string, r io.Reader, size int64) (string, int, error) {
+	defer b.acquire()()
+	return SendStream(b.stream, fileName, r, size)
+}
+
+func (b *limitedStreamBackend) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	defer b.acquire()()
+	return b.stream.SendFileStream(fileName, r, size)
+}
+
+// Ping не займає семафор: перевірка доступності не повинна чекати за
+// відправками, інакше зайняте сховище виглядало б недоступним
+func (b *limitedBackend) Ping() error {
+	return Ping(b.backend)
+}
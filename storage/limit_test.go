@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingBackend рахує найбільшу кількість одночасних операцій
+type countingBackend struct {
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func (b *countingBackend) op() {
+	n := b.current.Add(1)
+	for {
+		peak := b.peak.Load()
+		if n <= peak || b.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	b.current.Add(-1)
+}
+
+func (b *countingBackend) SendFile(fileName string, data []byte, caption string) (string, error) {
+	b.op()
+	return "id", nil
+}
+
+func (b *countingBackend) GetFileByID(fileID string) ([]byte, error) {
+	b.op()
+	return nil, nil
+}
+
+func (b *countingBackend) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	b.op()
+	return "id", nil
+}
+
+func TestLimit(t *testing.T) {
+	counting := &countingBackend{}
+	backend := Limit(counting, 3)
+	stream, ok := backend.(StreamSender)
+	if !ok {
+		t.Fatal("limited backend lost SendFileStream")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch i % 3 {
+			case 0:
+				backend.SendFile("a", nil, "")
+			case 1:
+				backend.GetFileByID("id")
+			default:
+				stream.SendFileStream("a", nil, 0)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if peak := counting.peak.Load(); peak > 3 {
+		t.Fatalf("%d concurrent operations, limit is 3", peak)
+	}
+	if peak := counting.peak.Load(); peak < 2 {
+		t.Fatalf("operations did not run concurrently, peak %d", peak)
+	}
+}
+
+// pingBackend - бекенд, доступність якого задає тест
+type pingBackend struct {
+	countingBackend
+	err error
+}
+
+func (b *pingBackend) Ping() error { return b.err }
+
+func TestLimitForwardsPing(t *testing.T) {
+	down := errors.New("telegram is unreachable")
+	if err := Ping(Limit(&pingBackend{err: down}, 3)); err != down {
+		t.Fatalf("Ping through limit = %v, want %v", err, down)
+	}
+	if err := Ping(Limit(&pingBackend{}, 3)); err != nil {
+		t.Fatalf("Ping through limit = %v, want nil", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package storage вибирає бекенд, у якому зберігаються chunks
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+	"github.com/ZaViBiS/infinity-storage/tgbot"
+)
+
+// Backend - сховище, в яке відправляються chunks
+type Backend interface {
+	SendFile(fileName string, data []byte, caption string) (string, error)
+	GetFileByID(fileID string) ([]byte, error)
+}
+
+// DirectLinker - бекенд, який може дати пряме посилання на збережений файл
+type DirectLinker interface {
+	DirectURL(fileID string) (string, error)
+}
+
+// ErrNoDirectURL - бекенд не вміє давати прямі посилання
+var ErrNoDirectURL = errors.New("бекенд не підтримує прямі посилання на файли")
+
+// DirectURL повертає пряме посилання на файл у сховищі або ErrNoDirectURL
+func DirectURL(backend Backend, fileID string) (string, error) {
+	linker, ok := backend.(DirectLinker)
+	if !ok {
+		return "", ErrNoDirectURL
+	}
+	return linker.DirectURL(fileID)
+}
+
+// StreamSender - бекенд, який може відправити chunk прямо з потоку,
+// не тримаючи його повністю в пам'яті
+type StreamSender interface {
+	SendFileStream(fileName string, r io.Reader, size int64) (string, error)
+}
+
+// MessageSender - бекенд, у якому кожен файл лежить в окремому повідомленні.
+// Разом з id файлу повертається id повідомлення, за яким файл видаляється
+type MessageSender interface {
+	SendFileMessage(fileName string, data []byte, caption string) (string, int, error)
+}
+
+// StreamMessageSender - MessageSender для потокової відправки
+type StreamMessageSender interface {
+	SendFileStreamMessage(fileName string, r io.Reader, size int64) (string, int, error)
+}
+
+// Deleter - бекенд, з якого можна видалити повідомлення messageID з файлом fileID
+type Deleter interface {
+	DeleteFile(fileID string, messageID int) error
+}
+
+// Pinger - бекенд, доступність якого можна перевірити без відправки файлу
+type Pinger interface {
+	Ping() error
+}
+
+// Ping перевіряє, що сховище відповідає. Бекенд без Pinger вважається доступним
+func Ping(backend Backend) error {
+	if pinger, ok := backend.(Pinger); ok {
+		return pinger.Ping()
+	}
+	return nil
+}
+
+// ErrNoDelete - бекенд не вміє видаляти файли або id повідомлення невідомий
+var ErrNoDelete = errors.New("файл неможливо видалити зі сховища")
+
+// Send відправляє файл і повертає його id та id повідомлення (0, якщо
+// бекенд не зберігає файли в повідомленнях)
+func Send(backend Backend, fileName string, data []byte, caption string) (string, int, error) {
+	if sender, ok := backend.(MessageSender); ok {
+		return sender.SendFileMessage(fileName, data, caption)
+	}
+	fileID, err := backend.SendFile(fileName, data, caption)
+	return fileID, 0, err
+}
+
+// SendStream - Send для потокової відправки
+func SendStream(sender StreamSender, fileName string, r io.Reader, size int64) (string, int, error) {
+	if messages, ok := sender.(StreamMessageSender); ok {
+		return messages.SendFileStreamMessage(fileName, r, size)
+	}
+	fileID, err := sender.SendFileStream(fileName, r, size)
+	return fileID, 0, err
+}
+
+// Delete видаляє повідомлення з файлом або повертає ErrNoDelete
+func Delete(backend Backend, fileID string, messageID int) error {
+	deleter, ok := backend.(Deleter)
+	if !ok || messageID == 0 {
+		return ErrNoDelete
+	}
+	return deleter.DeleteFile(fileID, messageID)
+}
+
+const (
+	Telegram = "telegram"
+	FS       = "fs"
+)
+
+// Names - усі підтримувані значення STORAGE_BACKEND
+var Names = []string{Telegram, FS}
+
+// Validate перевіряє, що name - відомий бекенд
+func Validate(name string) error {
+	if !slices.Contains(Names, name) {
+		return fmt.Errorf("невідомий STORAGE_BACKEND %q, можливі значення: %s", name, strings.Join(Names, ", "))
+	}
+	return nil
+}
+
+// New створює бекенд, вибраний у cfg.StorageBackend
+func New(cfg config.Config) (Backend, error) {
+	if err := Validate(cfg.StorageBackend); err != nil {
+		return nil, err
+	}
+
+	switch cfg.StorageBackend {
+	case FS:
+		return NewFSBackend(cfg.StorageDir)
+	default:
+		bot, err := tgbot.BotInit()
+		if err != nil {
+			return nil, err
+		}
+		bot.SetRateLimit(cfg.TelegramRate, cfg.TelegramBurst)
+		return bot, nil
+	}
+}
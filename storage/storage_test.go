@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ZaViBiS/infinity-storage/config"
+)
+
+func TestValidate(t *testing.T) {
+	for _, name := range []string{"telegram", "fs"} {
+		if err := Validate(name); err != nil {
+			t.Errorf("Validate(%q) = %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "s3", "Telegram"} {
+		err := Validate(name)
+		if err == nil {
+			t.Fatalf("Validate(%q) expected error", name)
+		}
+		if !strings.Contains(err.Error(), "telegram, fs") {
+			t.Errorf("error %q doesn't list valid backends", err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	backend, err := New(config.Config{StorageBackend: FS, StorageDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := backend.SendFile("a.txt", []byte("data"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := backend.GetFileByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, []byte("data")) {
+		t.Fatalf("got %q", data)
+	}
+
+	if _, err := New(config.Config{StorageBackend: "s3"}); err == nil {
+		t.Fatal("expected error for unknown backend")
+	}
+}
+
+func TestFSSendFileStream(t *testing.T) {
+	backend, err := NewFSBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := backend.SendFileStream("a.txt", strings.NewReader("streamed"), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := backend.GetFileByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "streamed" {
+		t.Fatalf("got %q", data)
+	}
+}
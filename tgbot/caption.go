@@ -0,0 +1,65 @@
+package tgbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const captionPrefix = "infinity-storage"
+
+// ChunkCaption - метадані chunk, які зберігаються в підписі документа,
+// щоб chunks можна було частково впізнати навіть після втрати бази
+type ChunkCaption struct {
+	FileID    uint
+	Position  int    // 0 - parity chunk
+	Checksum  string // у hex
+	Algorithm string // алгоритм checksum, порожній - sha256
+}
+
+// String повертає підпис у форматі
+// "infinity-storage file=<id> pos=<position> <algorithm>=<checksum>"
+func (c ChunkCaption) String() string {
+	algorithm := c.Algorithm
+	if algorithm == "" {
+		algorithm = "sha256"
+	}
+	return fmt.Sprintf("%s file=%d pos=%d %s=%s", captionPrefix, c.FileID, c.Position, algorithm, c.Checksum)
+}
+
+// ParseChunkCaption розбирає підпис, створений ChunkCaption.String
+func ParseChunkCaption(caption string) (ChunkCaption, error) {
+	fields := strings.Fields(caption)
+	if len(fields) != 4 || fields[0] != captionPrefix {
+		return ChunkCaption{}, fmt.Errorf("підпис не є підписом chunk: %q", caption)
+	}
+
+	values := make(map[string]string, 3)
+	for _, field := range fields[1:] {
+		name, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return ChunkCaption{}, fmt.Errorf("некоректне поле підпису: %q", field)
+		}
+		values[name] = value
+	}
+
+	fileID, err := strconv.ParseUint(values["file"], 10, 64)
+	if err != nil {
+		return ChunkCaption{}, fmt.Errorf("некоректний id файлу в підписі: %w", err)
+	}
+	position, err := strconv.Atoi(values["pos"])
+	if err != nil {
+		return ChunkCaption{}, fmt.Errorf("некоректна позиція в підписі: %w", err)
+	}
+	// останнє поле - checksum, назва поля - алгоритм
+	algorithm, checksum, _ := strings.Cut(fields[3], "=")
+	if algorithm == "file" || algorithm == "pos" || checksum == "" {
+		return ChunkCaption{}, fmt.Errorf("в підписі немає checksum")
+	}
+
+	// sha256 - алгоритм за замовчуванням, як у ChunkCaption без Algorithm
+	if algorithm == "sha256" {
+		algorithm = ""
+	}
+	return ChunkCaption{FileID: uint(fileID), Position: position, Checksum: checksum, Algorithm: algorithm}, nil
+}
@@ -0,0 +1,119 @@
+package tgbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ErrorClass - категорія помилки телеграму, за якою викликач вирішує,
+// чи повторювати запит, чи одразу здаватись, чи показувати помилку клієнту
+type ErrorClass string
+
+const (
+	ErrorUnknown     ErrorClass = "unknown"
+	ErrorRateLimited ErrorClass = "rate_limited"
+	ErrorAuth        ErrorClass = "auth"
+	ErrorFileTooBig  ErrorClass = "file_too_big"
+	ErrorTransient   ErrorClass = "transient_network"
+	ErrorNotFound    ErrorClass = "not_found"
+)
+
+// Retryable - чи має сенс повторити запит пізніше
+func (c ErrorClass) Retryable() bool {
+	return c == ErrorRateLimited || c == ErrorTransient
+}
+
+// HTTPStatusError - неуспішна відповідь при завантаженні файлу за прямим URL
+type HTTPStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("помилка завантаження файлу: отримано статус %d %s", e.StatusCode, e.Status)
+}
+
+// ClassifyError визначає категорію помилки SendFile або GetFileByID
+func ClassifyError(err error) ErrorClass {
+	if err == nil {
+		return ""
+	}
+
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return classifyAPIError(apiErr.Code, apiErr.Message, apiErr.RetryAfter)
+	}
+	var apiErrValue tgbotapi.Error
+	if errors.As(err, &apiErrValue) {
+		return classifyAPIError(apiErrValue.Code, apiErrValue.Message, apiErrValue.RetryAfter)
+	}
+
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return classifyStatus(statusErr.StatusCode)
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTransient
+	}
+
+	return ErrorUnknown
+}
+
+// RetryAfter повертає, скільки телеграм просить почекати після flood control
+func RetryAfter(err error) time.Duration {
+	var apiErr *tgbotapi.Error
+	if errors.As(err, &apiErr) {
+		return time.Duration(apiErr.RetryAfter) * time.Second
+	}
+	var apiErrValue tgbotapi.Error
+	if errors.As(err, &apiErrValue) {
+		return time.Duration(apiErrValue.RetryAfter) * time.Second
+	}
+	return 0
+}
+
+func classifyAPIError(code int, message string, retryAfter int) ErrorClass {
+	message = strings.ToLower(message)
+	switch {
+	case retryAfter > 0 || code == 429 || strings.Contains(message, "too many requests"):
+		return ErrorRateLimited
+	case strings.Contains(message, "too big") || strings.Contains(message, "too large"):
+		return ErrorFileTooBig
+	case strings.Contains(message, "file not found") ||
+		strings.Contains(message, "wrong file_id") ||
+		strings.Contains(message, "invalid file_id") ||
+		strings.Contains(message, "message to delete not found"):
+		return ErrorNotFound
+	}
+	return classifyStatus(code)
+}
+
+func classifyStatus(code int) ErrorClass {
+	switch {
+	case code == 429:
+		return ErrorRateLimited
+	case code == 401 || code == 403:
+		return ErrorAuth
+	case code == 404:
+		return ErrorNotFound
+	case code == 413:
+		return ErrorFileTooBig
+	case code >= 500:
+		return ErrorTransient
+	}
+	return ErrorUnknown
+}
@@ -2,57 +2,265 @@
 package tgbot
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
 	"github.com/rs/zerolog/log"
+	"golang.org/x/time/rate"
 )
 
+// TGBot - пул ботів, між якими по колу розподіляються відправки, щоб обійти
+// ліміти Telegram на одного бота і чат. Номер бота записується в id файлу
+// (див. fileRef), тож завантажує і видаляє файл той самий бот, що його відправив
 type TGBot struct {
-	// NOTE: можливо, тут не потрібна структура
-	bot tgbotapi.BotAPI
+	bots []*poolBot
+	next atomic.Uint64
+	// fileEndpoint - шаблон URL для завантаження файлів, порожній - tgbotapi.FileEndpoint
+	fileEndpoint string
 }
 
-func BotInit() (TGBot, error) {
-	if err := godotenv.Load(); err != nil {
-		log.Err(err).Msg(".env file not found, using system env")
+// poolBot - один бот пулу зі своїм чатом сховища
+type poolBot struct {
+	api    tgbotapi.BotAPI
+	chatID int64
+	// limiter - ліміт запитів цього бота, nil - без обмеження
+	limiter *rate.Limiter
+}
+
+// NewLimiter створює ліміт на perMinute запитів на хвилину, з яких burst
+// можна зробити підряд. perMinute 0 - без обмеження (nil)
+func NewLimiter(perMinute, burst int) *rate.Limiter {
+	if perMinute <= 0 {
+		return nil
 	}
+	return rate.NewLimiter(rate.Limit(float64(perMinute)/60), max(burst, 1))
+}
 
-	token, ok := os.LookupEnv("TOKEN")
-	if !ok {
-		return TGBot{}, fmt.Errorf("помилка отримання токену")
+// SetRateLimit задає кожному боту пулу окремий ліміт perMinute запитів на
+// хвилину (burst підряд), бо Telegram обмежує кожного бота окремо
+func (b *TGBot) SetRateLimit(perMinute, burst int) {
+	for _, bot := range b.bots {
+		bot.limiter = NewLimiter(perMinute, burst)
 	}
+}
 
-	bot, err := tgbotapi.NewBotAPI(token)
+// wait чекає на дозвіл ліміту бота перед запитом до Telegram
+func (b *poolBot) wait() {
+	if b.limiter == nil {
+		return
+	}
+	if err := b.limiter.Wait(context.Background()); err != nil {
+		log.Err(err).Msg("помилка очікування ліміту запитів до Telegram")
+	}
+}
+
+// BotInit створює пул ботів з TOKENS і CHATIDS (через кому) або з одного
+// TOKEN і CHATID. Один чат у CHATIDS спільний для всіх ботів
+func BotInit() (*TGBot, error) {
+	tokens, chatIDs, err := botsFromEnv()
 	if err != nil {
-		return TGBot{}, err
+		return nil, err
 	}
 
-	return TGBot{bot: *bot}, nil
+	pool := &TGBot{}
+	for i, token := range tokens {
+		bot, err := tgbotapi.NewBotAPI(token)
+		if err != nil {
+			return nil, fmt.Errorf("бот %d: %w", i, err)
+		}
+		pool.bots = append(pool.bots, &poolBot{api: *bot, chatID: chatIDs[i]})
+	}
+	log.Info().Int("bots", len(pool.bots)).Msg("боти сховища готові")
+	return pool, nil
 }
 
-func (b *TGBot) SendFile(fileName string, data []byte) (string, error) {
-	chatID := GetChatIDFromEnv()
+// botsFromEnv читає токени ботів і чат кожного з них
+func botsFromEnv() ([]string, []int64, error) {
+	tokens := splitEnv("TOKENS")
+	if len(tokens) == 0 {
+		tokens = splitEnv("TOKEN")
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("помилка отримання токену: задайте TOKEN або TOKENS")
+	}
+
+	chats := splitEnv("CHATIDS")
+	if len(chats) == 0 {
+		chats = splitEnv("CHATID")
+	}
+	if len(chats) != 1 && len(chats) != len(tokens) {
+		return nil, nil, fmt.Errorf("CHATIDS має містити один чат або по чату на кожен з %d токенів", len(tokens))
+	}
+
+	chatIDs := make([]int64, len(tokens))
+	for i := range tokens {
+		chat := chats[0]
+		if len(chats) > 1 {
+			chat = chats[i]
+		}
+		id, err := strconv.ParseInt(chat, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("невалідний id чату %q: %w", chat, err)
+		}
+		chatIDs[i] = id
+	}
+	return tokens, chatIDs, nil
+}
 
-	message, err := b.bot.Send(tgbotapi.NewDocument(chatID, tgbotapi.FileBytes{
+// splitEnv повертає непорожні значення змінної оточення, розділені комами
+func splitEnv(name string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// fileRef записує в id файлу номер бота, що його відправив. У файлів першого
+// бота лишається id з Telegram, тож id, збережені до появи пулу, дійсні.
+// Тому порядок TOKENS змінювати не можна, нових ботів додають у кінець
+func fileRef(index int, fileID string) string {
+	if index == 0 {
+		return fileID
+	}
+	return strconv.Itoa(index) + ":" + fileID
+}
+
+// botFor повертає бота, який відправив файл ref, і id файлу в Telegram
+func (b *TGBot) botFor(ref string) (*poolBot, string, error) {
+	index, fileID := 0, ref
+	// id файлів Telegram не містять ":"
+	if prefix, rest, ok := strings.Cut(ref, ":"); ok {
+		n, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, "", fmt.Errorf("невідомий id файлу %q", ref)
+		}
+		index, fileID = n, rest
+	}
+	if index < 0 || index >= len(b.bots) {
+		return nil, "", fmt.Errorf("файл %q відправив бот %d, якого немає в TOKENS", ref, index)
+	}
+	return b.bots[index], fileID, nil
+}
+
+// pick вибирає наступного бота пулу по колу
+func (b *TGBot) pick() (int, *poolBot) {
+	index := int((b.next.Add(1) - 1) % uint64(len(b.bots)))
+	return index, b.bots[index]
+}
+
+// SendFile відправляє дані як документ, caption може бути порожнім
+func (b *TGBot) SendFile(fileName string, data []byte, caption string) (string, error) {
+	fileID, _, err := b.SendFileMessage(fileName, data, caption)
+	return fileID, err
+}
+
+// SendFileMessage - SendFile, який повертає ще й id повідомлення з документом,
+// потрібний, щоб потім видалити його через DeleteFile
+func (b *TGBot) SendFileMessage(fileName string, data []byte, caption string) (string, int, error) {
+	index, bot := b.pick()
+	document := tgbotapi.NewDocument(bot.chatID, tgbotapi.FileBytes{
 		Name:  fileName,
 		Bytes: data,
-	}))
+	})
+	document.Caption = caption
+
+	bot.wait()
+	message, err := bot.api.Send(document)
 	// TODO: тут трохи не дуже з return`ами
 	if err != nil {
-		log.Err(err).Msg("помилка відправки повідомлення")
+		log.Err(err).Int("bot", index).Msg("помилка відправки повідомлення")
+		return "", 0, err
+	}
+	return fileRef(index, message.Document.FileID), message.MessageID, nil
+}
+
+// SendFileStream відправляє документ, читаючи дані прямо з r, без копії в пам'яті.
+// size - очікуваний розмір (-1, якщо невідомий), потрібен лише для логів
+func (b *TGBot) SendFileStream(fileName string, r io.Reader, size int64) (string, error) {
+	fileID, _, err := b.SendFileStreamMessage(fileName, r, size)
+	return fileID, err
+}
+
+// SendFileStreamMessage - SendFileStream, який повертає ще й id повідомлення
+func (b *TGBot) SendFileStreamMessage(fileName string, r io.Reader, size int64) (string, int, error) {
+	index, bot := b.pick()
+	document := tgbotapi.NewDocument(bot.chatID, tgbotapi.FileReader{
+		Name:   fileName,
+		Reader: r,
+	})
+
+	bot.wait()
+	message, err := bot.api.Send(document)
+	if err != nil {
+		log.Err(err).Int("bot", index).Int64("size", size).Msg("помилка потокової відправки повідомлення")
+		return "", 0, err
+	}
+	return fileRef(index, message.Document.FileID), message.MessageID, nil
+}
+
+// DeleteFile видаляє з чату сховища повідомлення з документом fileID
+func (b *TGBot) DeleteFile(fileID string, messageID int) error {
+	bot, _, err := b.botFor(fileID)
+	if err != nil {
+		return err
+	}
+	bot.wait()
+	_, err = bot.api.Request(tgbotapi.NewDeleteMessage(bot.chatID, messageID))
+	return err
+}
+
+// Ping перевіряє, що Telegram відповідає хоч одному боту пулу
+func (b *TGBot) Ping() error {
+	var err error
+	for _, bot := range b.bots {
+		if _, err = bot.api.GetMe(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// DirectURL повертає посилання для завантаження файлу напряму з Telegram.
+// Посилання містить токен бота і діє щонайменше годину
+func (b *TGBot) DirectURL(fileID string) (string, error) {
+	bot, telegramID, err := b.botFor(fileID)
+	if err != nil {
+		return "", err
+	}
+	bot.wait()
+	return b.fileURL(bot, telegramID)
+}
+
+// fileURL отримує шлях файлу в Telegram і будує посилання на нього
+func (b *TGBot) fileURL(bot *poolBot, fileID string) (string, error) {
+	file, err := bot.api.GetFile(tgbotapi.FileConfig{FileID: fileID})
+	if err != nil {
 		return "", err
 	}
-	return message.Document.FileID, nil
+	endpoint := b.fileEndpoint
+	if endpoint == "" {
+		endpoint = tgbotapi.FileEndpoint
+	}
+	return fmt.Sprintf(endpoint, bot.api.Token, file.FilePath), nil
 }
 
 func (b *TGBot) GetFileByID(fileID string) ([]byte, error) {
-	fileURL, err := b.bot.GetFileDirectURL(fileID)
+	bot, telegramID, err := b.botFor(fileID)
+	if err != nil {
+		return nil, err
+	}
+	bot.wait()
+	fileURL, err := b.fileURL(bot, telegramID)
 	if err != nil {
 		log.Err(err).Str("fileID", fileID).Msg("помилка отримання прямого URL файлу")
 		return nil, err
@@ -66,7 +274,7 @@ func (b *TGBot) GetFileByID(fileID string) ([]byte, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("помилка завантаження файлу: отримано статус %d %s", resp.StatusCode, resp.Status)
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	bodyBytes, err := io.ReadAll(resp.Body)
@@ -77,11 +285,68 @@ func (b *TGBot) GetFileByID(fileID string) ([]byte, error) {
 	return bodyBytes, nil
 }
 
-func GetChatIDFromEnv() int64 {
-	chatID := os.Getenv("CHATID")
-	res, err := strconv.ParseInt(chatID, 10, 64)
-	if err != nil {
-		panic(err)
+// ChunkMessages повертає повідомлення з документами з чатів сховища.
+// Bot API не дає читати історію чату, тому тут доступні лише оновлення,
+// які телеграм ще тримає для ботів (до 24 годин і лише без webhook).
+// Про власні повідомлення бот оновлень не отримує, тож частини, які
+// відправив сам сервер, тут не видно - лише документи, які надіслав у чат
+// хтось інший (наприклад, переслав користувач). Отримані оновлення
+// підтверджуються і більше нікому не віддаються.
+// Id документів записуються з номером бота, як при відправці
+func (b *TGBot) ChunkMessages() ([]tgbotapi.Message, error) {
+	type messageKey struct {
+		chatID    int64
+		messageID int
+	}
+	seen := make(map[messageKey]bool)
+
+	var messages []tgbotapi.Message
+	for index, bot := range b.bots {
+		botMessages, err := bot.chunkMessages()
+		if err != nil {
+			return nil, fmt.Errorf("бот %d: %w", index, err)
+		}
+		for _, message := range botMessages {
+			// спільний чат бачать кілька ботів, досить одного id
+			key := messageKey{message.Chat.ID, message.MessageID}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			document := *message.Document
+			document.FileID = fileRef(index, document.FileID)
+			message.Document = &document
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+// chunkMessages повертає повідомлення з документами з чату бота
+func (b *poolBot) chunkMessages() ([]tgbotapi.Message, error) {
+	var messages []tgbotapi.Message
+	offset := 0
+	for {
+		updates, err := b.api.GetUpdates(tgbotapi.UpdateConfig{Offset: offset, Limit: 100})
+		if err != nil {
+			return nil, err
+		}
+		if len(updates) == 0 {
+			return messages, nil
+		}
+
+		for _, update := range updates {
+			offset = update.UpdateID + 1
+
+			message := update.ChannelPost
+			if message == nil {
+				message = update.Message
+			}
+			if message == nil || message.Chat == nil || message.Chat.ID != b.chatID || message.Document == nil {
+				continue
+			}
+			messages = append(messages, *message)
+		}
 	}
-	return res
 }
@@ -1 +1,312 @@
 package tgbot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestChunkCaptionFormat(t *testing.T) {
+	caption := ChunkCaption{FileID: 42, Position: 3, Checksum: "abc123"}
+
+	want := "infinity-storage file=42 pos=3 sha256=abc123"
+	if got := caption.String(); got != want {
+		t.Fatalf("caption = %q, want %q", got, want)
+	}
+
+	parsed, err := ParseChunkCaption(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != caption {
+		t.Fatalf("parsed = %+v, want %+v", parsed, caption)
+	}
+}
+
+func TestChunkCaptionAlgorithm(t *testing.T) {
+	caption := ChunkCaption{FileID: 7, Position: 1, Checksum: "def456", Algorithm: "blake3"}
+
+	want := "infinity-storage file=7 pos=1 blake3=def456"
+	if got := caption.String(); got != want {
+		t.Fatalf("caption = %q, want %q", got, want)
+	}
+	parsed, err := ParseChunkCaption(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed != caption {
+		t.Fatalf("parsed = %+v, want %+v", parsed, caption)
+	}
+}
+
+func TestParseChunkCaptionRejectsForeign(t *testing.T) {
+	for _, caption := range []string{
+		"",
+		"holiday photos",
+		"infinity-storage file=x pos=1 sha256=ab",
+		"infinity-storage file=1 pos=1",
+	} {
+		if _, err := ParseChunkCaption(caption); err == nil {
+			t.Errorf("ParseChunkCaption(%q) expected error", caption)
+		}
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want ErrorClass
+	}{
+		{"flood control", &tgbotapi.Error{Code: 429, Message: "Too Many Requests: retry after 5", ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 5}}, ErrorRateLimited},
+		{"unauthorized", &tgbotapi.Error{Code: 401, Message: "Unauthorized"}, ErrorAuth},
+		{"kicked from chat", &tgbotapi.Error{Code: 403, Message: "Forbidden: bot was kicked from the channel chat"}, ErrorAuth},
+		{"upload too big", &tgbotapi.Error{Code: 413, Message: "Request Entity Too Large"}, ErrorFileTooBig},
+		{"download too big", &tgbotapi.Error{Code: 400, Message: "Bad Request: file is too big"}, ErrorFileTooBig},
+		{"wrong file id", &tgbotapi.Error{Code: 400, Message: "Bad Request: wrong file_id or the file is temporarily unavailable"}, ErrorNotFound},
+		{"bad gateway", &tgbotapi.Error{Code: 502, Message: "Bad Gateway"}, ErrorTransient},
+		{"api error value", fmt.Errorf("send: %w", tgbotapi.Error{Code: 429, Message: "Too Many Requests"}), ErrorRateLimited},
+		{"direct url 404", &HTTPStatusError{StatusCode: 404, Status: "404 Not Found"}, ErrorNotFound},
+		{"direct url 503", fmt.Errorf("wrap: %w", &HTTPStatusError{StatusCode: 503}), ErrorTransient},
+		{"connection reset", &url.Error{Op: "Get", URL: "https://api.telegram.org", Err: &net.OpError{Op: "read", Err: errors.New("connection reset by peer")}}, ErrorTransient},
+		{"short body", fmt.Errorf("read body: %w", io.ErrUnexpectedEOF), ErrorTransient},
+		{"bad request", &tgbotapi.Error{Code: 400, Message: "Bad Request: chat not found"}, ErrorUnknown},
+		{"plain error", errors.New("boom"), ErrorUnknown},
+	}
+
+	for _, tt := range tests {
+		if got := ClassifyError(tt.err); got != tt.want {
+			t.Errorf("%s: ClassifyError = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	err := fmt.Errorf("send: %w", &tgbotapi.Error{Code: 429, ResponseParameters: tgbotapi.ResponseParameters{RetryAfter: 7}})
+	if got := RetryAfter(err); got != 7*time.Second {
+		t.Fatalf("RetryAfter = %v, want 7s", got)
+	}
+	if got := RetryAfter(errors.New("boom")); got != 0 {
+		t.Fatalf("RetryAfter = %v, want 0", got)
+	}
+}
+
+// newTestPool створює пул ботів з tokens, які ходять на тестовий server.
+// Чат бота - його номер у пулі плюс один
+func newTestPool(server *httptest.Server, tokens ...string) *TGBot {
+	pool := &TGBot{fileEndpoint: server.URL + "/file/bot%s/%s"}
+	for i, token := range tokens {
+		bot := &poolBot{api: tgbotapi.BotAPI{Token: token, Client: server.Client()}, chatID: int64(i + 1)}
+		bot.api.SetAPIEndpoint(server.URL + "/bot%s/%s")
+		pool.bots = append(pool.bots, bot)
+	}
+	return pool
+}
+
+func TestSendFileRateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var sent []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		sent = append(sent, time.Now())
+		mu.Unlock()
+		fmt.Fprint(w, `{"ok":true,"result":{"message_id":1,"document":{"file_id":"doc"}}}`)
+	}))
+	defer server.Close()
+
+	bot := newTestPool(server, "token")
+	bot.SetRateLimit(600, 1) // запит кожні 100 мс
+
+	const calls = 4
+	var wg sync.WaitGroup
+	for range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := bot.SendFile("chunk.bin", []byte("data"), ""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(sent) != calls {
+		t.Fatalf("sent %d requests, want %d", len(sent), calls)
+	}
+	slices.SortFunc(sent, time.Time.Compare)
+	// перший запит іде одразу, решта - з інтервалом ліміту
+	if spread := sent[calls-1].Sub(sent[0]); spread < 250*time.Millisecond {
+		t.Fatalf("%d requests took %s, want about 300ms", calls, spread)
+	}
+}
+
+// fakeTelegram - Bot API, у якому файл може отримати лише бот, що його відправив
+type fakeTelegram struct {
+	mu      sync.Mutex
+	files   map[string][]byte
+	owners  map[string]string // id файлу -> токен бота
+	sent    map[string][]string
+	deleted []string // "токен чат повідомлення"
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if path, ok := strings.CutPrefix(r.URL.Path, "/file/bot"); ok {
+		token, filePath, _ := strings.Cut(path, "/")
+		id := strings.TrimPrefix(filePath, "documents/")
+		if f.owners[id] != token {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(f.files[id])
+		return
+	}
+
+	token, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/bot"), "/")
+	switch method {
+	case "sendDocument":
+		file, _, err := r.FormFile("document")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(file)
+		id := fmt.Sprintf("%s-doc-%d", token, len(f.files)+1)
+		f.files[id] = data
+		f.owners[id] = token
+		f.sent[token] = append(f.sent[token], r.FormValue("chat_id"))
+		fmt.Fprintf(w, `{"ok":true,"result":{"message_id":%d,"document":{"file_id":%q}}}`, len(f.files), id)
+	case "getFile":
+		id := r.FormValue("file_id")
+		if f.owners[id] != token {
+			fmt.Fprint(w, `{"ok":false,"error_code":400,"description":"Bad Request: wrong file_id or the file is temporarily unavailable"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"ok":true,"result":{"file_id":%q,"file_path":"documents/%s"}}`, id, id)
+	case "deleteMessage":
+		f.deleted = append(f.deleted, token+" "+r.FormValue("chat_id")+" "+r.FormValue("message_id"))
+		fmt.Fprint(w, `{"ok":true,"result":true}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestBotPoolRoundRobin(t *testing.T) {
+	telegram := &fakeTelegram{files: make(map[string][]byte), owners: make(map[string]string), sent: make(map[string][]string)}
+	server := httptest.NewServer(telegram)
+	defer server.Close()
+	pool := newTestPool(server, "first", "second")
+
+	var ids []string
+	var messages []int
+	for i := range 4 {
+		id, messageID, err := pool.SendFileMessage("chunk.bin", []byte(fmt.Sprintf("chunk %d", i)), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+		messages = append(messages, messageID)
+	}
+
+	// відправки чергуються, і кожен бот пише у свій чат
+	if got := telegram.sent["first"]; !slices.Equal(got, []string{"1", "1"}) {
+		t.Fatalf("first bot sent to chats %v, want two chunks to chat 1", got)
+	}
+	if got := telegram.sent["second"]; !slices.Equal(got, []string{"2", "2"}) {
+		t.Fatalf("second bot sent to chats %v, want two chunks to chat 2", got)
+	}
+	if strings.Contains(ids[0], ":") || !strings.HasPrefix(ids[1], "1:") {
+		t.Fatalf("ids = %v, want the second bot's ids prefixed with its index", ids)
+	}
+
+	// кожен chunk завантажує бот, який його відправив
+	for i, id := range ids {
+		data, err := pool.GetFileByID(id)
+		if err != nil {
+			t.Fatalf("chunk %d (%s): %v", i, id, err)
+		}
+		if want := fmt.Sprintf("chunk %d", i); string(data) != want {
+			t.Fatalf("chunk %d = %q, want %q", i, data, want)
+		}
+	}
+
+	if err := pool.DeleteFile(ids[1], messages[1]); err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("second 2 %d", messages[1]); !slices.Equal(telegram.deleted, []string{want}) {
+		t.Fatalf("deleted %v, want %q", telegram.deleted, want)
+	}
+
+	if _, err := pool.GetFileByID("5:unknown"); err == nil {
+		t.Fatal("file of a bot outside the pool was not rejected")
+	}
+}
+
+func TestBotsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		tokens  []string
+		chatIDs []int64
+		wantErr bool
+	}{
+		{"single token", map[string]string{"TOKEN": "a", "CHATID": "-100"}, []string{"a"}, []int64{-100}, false},
+		{"shared chat", map[string]string{"TOKENS": "a, b", "CHATID": "-100"}, []string{"a", "b"}, []int64{-100, -100}, false},
+		{"chat per bot", map[string]string{"TOKENS": "a,b", "CHATIDS": "1,2"}, []string{"a", "b"}, []int64{1, 2}, false},
+		{"tokens win", map[string]string{"TOKEN": "old", "TOKENS": "a", "CHATIDS": "1"}, []string{"a"}, []int64{1}, false},
+		{"chat count mismatch", map[string]string{"TOKENS": "a,b,c", "CHATIDS": "1,2"}, nil, nil, true},
+		{"no token", map[string]string{"CHATID": "1"}, nil, nil, true},
+		{"bad chat", map[string]string{"TOKEN": "a", "CHATID": "chat"}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"TOKEN", "TOKENS", "CHATID", "CHATIDS"} {
+				t.Setenv(name, tt.env[name])
+			}
+			tokens, chatIDs, err := botsFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(tokens, tt.tokens) || !slices.Equal(chatIDs, tt.chatIDs) {
+				t.Fatalf("tokens = %v, chats = %v, want %v, %v", tokens, chatIDs, tt.tokens, tt.chatIDs)
+			}
+		})
+	}
+}
+
+func TestPing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "/botrevoked/") {
+			fmt.Fprint(w, `{"ok":false,"error_code":401,"description":"Unauthorized"}`)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true,"result":{"id":1,"is_bot":true,"username":"storage_bot"}}`)
+	}))
+
+	// досить, щоб Telegram відповів хоч одному боту пулу
+	if err := newTestPool(server, "revoked", "ok").Ping(); err != nil {
+		t.Fatalf("ping with one working bot: %v", err)
+	}
+	if err := newTestPool(server, "revoked").Ping(); err == nil {
+		t.Fatal("ping with only a revoked bot succeeded")
+	}
+
+	// Telegram не відповідає взагалі
+	server.Close()
+	if err := newTestPool(server, "ok").Ping(); err == nil {
+		t.Fatal("ping of a closed server succeeded")
+	}
+}